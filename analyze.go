@@ -83,11 +83,18 @@ var contexts = map[string]uint{
 	blockCtx{"mgmt"}.key():                             ngxMgmtMainConf,
 }
 
-func enterBlockCtx(stmt *Directive, ctx blockCtx) blockCtx {
+func enterBlockCtx(stmt *Directive, ctx blockCtx, blockContexts []BlockContext) blockCtx {
 	// don't nest because ngxHTTPLocConf just means "location block in http"
 	if len(ctx) > 0 && ctx[0] == "http" && stmt.Directive == "location" {
 		return blockCtx{"http", "location"}
 	}
+	// same for the blocks of the custom contexts collapsing like locations
+	for _, c := range blockContexts {
+		parent, name := c.parent()
+		if c.Collapse && name == stmt.Directive && len(ctx) >= len(parent) && ctx[:len(parent)].key() == parent.key() {
+			return append(parent, name)
+		}
+	}
 	// no other block contexts can be nested like location so just append it
 	return append(ctx, stmt.Directive)
 }
@@ -95,7 +102,11 @@ func enterBlockCtx(stmt *Directive, ctx blockCtx) blockCtx {
 //nolint:gocyclo,funlen,gocognit
 func analyze(fname string, stmt *Directive, term string, ctx blockCtx, options *ParseOptions) error {
 	masks, knownDirective := directives[stmt.Directive]
+	if options.Directives != nil {
+		masks, knownDirective = options.Directives.Match(stmt.Directive)
+	}
 	currCtx, knownContext := contexts[ctx.key()]
+	customContext := !knownContext && options.Directives != nil && hasBlockContext(options.Contexts, ctx)
 
 	if !knownDirective {
 		for _, matchFn := range options.MatchFuncs {
@@ -118,7 +129,7 @@ func analyze(fname string, stmt *Directive, term string, ctx blockCtx, options *
 
 	// if we don't know where this directive is allowed and how
 	// many arguments it can take then don't bother analyzing it
-	if !knownContext || !knownDirective {
+	if (!knownContext && !customContext) || !knownDirective {
 		return nil
 	}
 
@@ -127,6 +138,10 @@ func analyze(fname string, stmt *Directive, term string, ctx blockCtx, options *
 	if options.SkipDirectiveContextCheck {
 		ctxMasks = masks
 	} else {
+		if customContext {
+			// directives are allowed in custom contexts by the specs of the registry
+			ctxMasks = options.Directives.masksIn(stmt.Directive, Context(ctx.key()))
+		}
 		for _, mask := range masks {
 			if (mask & currCtx) != 0 {
 				ctxMasks = append(ctxMasks, mask)
@@ -2556,6 +2571,9 @@ func MatchAppProtectWAFv5(directive string) ([]uint, bool) {
 // LuaDirectives is a list of directives that are used in the Lua module
 // https://github.com/openresty/lua-nginx-module/tree/master?tab=readme-ov-file#directives
 //
+// The Lua code of the *_by_lua_block directives is emitted as a single argument by the
+// Lua lexer, so their bit masks describe the block body as an argument rather than a block.
+//
 //nolint:gochecknoglobals
 var LuaDirectives = map[string][]uint{
 	"lua_load_resty_core": {
@@ -2591,54 +2609,102 @@ var LuaDirectives = map[string][]uint{
 	"init_by_lua_file": {
 		ngxHTTPMainConf | ngxConfTake1,
 	},
+	"init_by_lua_block": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
 	"init_worker_by_lua_file": {
 		ngxHTTPMainConf | ngxConfTake1,
 	},
+	"init_worker_by_lua_block": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
 	"exit_worker_by_lua_file": {
 		ngxHTTPMainConf | ngxConfTake1,
 	},
+	"exit_worker_by_lua_block": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
 	"set_by_lua_file": {
 		ngxHTTPSrvConf | ngxHTTPSifConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConf2More,
 	},
+	"set_by_lua_block": {
+		ngxHTTPSrvConf | ngxHTTPSifConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake2,
+	},
 	"content_by_lua_file": {
 		ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"content_by_lua_block": {
+		ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"server_rewrite_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
 	},
+	"server_rewrite_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
+	},
 	"rewrite_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"rewrite_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"access_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"access_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"header_filter_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"header_filter_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"body_filter_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"body_filter_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"log_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
 	},
+	"log_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfTake1,
+	},
 	"balancer_by_lua_file": {
 		ngxHTTPUpsConf | ngxConfTake1,
 	},
+	"balancer_by_lua_block": {
+		ngxHTTPUpsConf | ngxConfTake1,
+	},
 	"lua_need_request_body": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxHTTPLifConf | ngxConfFlag,
 	},
 	"ssl_client_hello_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
 	},
+	"ssl_client_hello_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
+	},
 	"ssl_certificate_by_lua_file": {
 		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
 	},
+	"ssl_certificate_by_lua_block": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxConfTake1,
+	},
 	"ssl_session_fetch_by_lua_file": {
 		ngxHTTPMainConf | ngxConfTake1,
 	},
+	"ssl_session_fetch_by_lua_block": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
 	"ssl_session_store_by_lua_file": {
 		ngxHTTPMainConf | ngxConfTake1,
 	},
+	"ssl_session_store_by_lua_block": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
 	"lua_shared_dict": {
 		ngxHTTPMainConf | ngxConfTake2,
 	},
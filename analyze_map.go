@@ -7,7 +7,10 @@
 
 package crossplane
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // mapParameterMasks holds bit masks that define the behavior of the body of map-like directives.
 // Some map directives have "special parameter" with different behaviors than the default.
@@ -46,10 +49,90 @@ var mapBodies = map[string]mapParameterMasks{
 	},
 }
 
+// MapBody describes the body of a map-like block directive of a module, whose block has entries made
+// of a key and of values instead of directives, like the body of a map. The entries are added to the
+// payload as directives named after their key, but they are not analyzed as directives.
+type MapBody struct {
+	// Values gives the number of values of the entries.
+	Values MapValues
+	// Parameters gives the number of values of the special entries with another number of values
+	// than the others, by their key, like the "hostnames" parameter of a map which has no values.
+	Parameters map[string]MapValues
+}
+
+// MapValues gives the number of values of the entries of a map-like block.
+type MapValues struct {
+	// Args are the numbers of values an entry can have, from 0 to 7.
+	Args []int
+	// If Variadic is true, an entry can have MinArgs or more values, with MinArgs from 0 to 2.
+	Variadic bool
+	MinArgs  int
+}
+
+func (v MapValues) validate() error {
+	for _, n := range v.Args {
+		if n < 0 || n > maxArgs {
+			return fmt.Errorf("invalid number of values %d", n)
+		}
+	}
+	if v.Variadic && (v.MinArgs < 0 || v.MinArgs > 2) {
+		return fmt.Errorf("invalid minimum number of values %d", v.MinArgs)
+	}
+	if len(v.Args) == 0 && !v.Variadic {
+		return errors.New("no number of values")
+	}
+	return nil
+}
+
+func (b MapBody) validate(directive string) error {
+	if err := b.Values.validate(); err != nil {
+		return fmt.Errorf(`map-like block "%s": %w`, directive, err)
+	}
+	for key, values := range b.Parameters {
+		if err := values.validate(); err != nil {
+			return fmt.Errorf(`map-like block "%s": parameter "%s": %w`, directive, key, err)
+		}
+	}
+	return nil
+}
+
+// isMapBody returns true if a directive is a map-like directive of the options or of nginx.
+func isMapBody(directive string, options *ParseOptions) bool {
+	if options != nil {
+		if _, ok := options.MapBodies[directive]; ok {
+			return true
+		}
+	}
+	_, ok := mapBodies[directive]
+	return ok
+}
+
+// parameterMask returns the mask of a parameter in the body of a map-like directive, looking up the
+// MapBodies of the options before the map-like directives of nginx.
+func parameterMask(mapCtx string, parameter string, options *ParseOptions) (uint, bool) {
+	if options != nil {
+		if b, ok := options.MapBodies[mapCtx]; ok {
+			values, special := b.Parameters[parameter]
+			if !special {
+				values = b.Values
+			}
+			return argsMask(values.Args, values.Variadic, values.MinArgs), true
+		}
+	}
+	masks, ok := mapBodies[mapCtx]
+	if !ok {
+		return 0, false
+	}
+	if mask, special := masks.specialParameterMasks[parameter]; special {
+		return mask, true
+	}
+	return masks.defaultMasks, true
+}
+
 // analyzeMapBody validates the body of a map-like directive. Map-like directives are block directives
 // that don't contain nginx directives, and therefore cannot be analyzed in the same way as other blocks.
-func analyzeMapBody(fname string, parameter *Directive, term string, mapCtx string) error {
-	masks, known := mapBodies[mapCtx]
+func analyzeMapBody(fname string, parameter *Directive, term string, mapCtx string, options *ParseOptions) error {
+	mask, known := parameterMask(mapCtx, parameter.Directive, options)
 	// if we're not inside a known map-like directive, don't bother analyzing
 	if !known {
 		return nil
@@ -64,23 +147,6 @@ func analyzeMapBody(fname string, parameter *Directive, term string, mapCtx stri
 		}
 	}
 
-	if mask, ok := masks.specialParameterMasks[parameter.Directive]; ok {
-		// use mask to check the parameter's arguments
-		if hasValidArguments(mask, parameter.Args) {
-			return nil
-		}
-
-		return &ParseError{
-			What:      "invalid number of parameters",
-			File:      &fname,
-			Line:      &parameter.Line,
-			Statement: parameter.String(),
-			BlockCtx:  mapCtx,
-		}
-	}
-
-	mask := masks.defaultMasks
-
 	// use mask to check the parameter's arguments
 	if hasValidArguments(mask, parameter.Args) {
 		return nil
@@ -214,7 +214,7 @@ func TestAnalyzeMapBody(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			err := analyzeMapBody("nginx.conf", tc.parameter, tc.term, tc.mapDirective)
+			err := analyzeMapBody("nginx.conf", tc.parameter, tc.term, tc.mapDirective, nil)
 			if tc.wantErr == nil {
 				require.NoError(t, err)
 				return
@@ -229,3 +229,82 @@ func TestAnalyzeMapBody(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_mapBodies(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    maxminddb /etc/GeoLite2-Country.mmdb {
+        auto_reload 5m;
+        auto_reload;
+        $country default=US country iso_code;
+        $bad;
+    }
+}
+`,
+	}
+	options := &ParseOptions{
+		ErrorOnUnknownDirectives: true,
+		MatchFuncs: []MatchFunc{func(directive string) ([]uint, bool) {
+			if directive == "maxminddb" {
+				return []uint{ngxHTTPMainConf | ngxConfBlock | ngxConfTake1}, true
+			}
+			return nil, false
+		}},
+		MapBodies: map[string]MapBody{
+			"maxminddb": {
+				Values:     MapValues{Variadic: true, MinArgs: 1},
+				Parameters: map[string]MapValues{"auto_reload": {Args: []int{1}}},
+			},
+		},
+	}
+
+	payload, err := ParseFiles(files, "nginx.conf", options)
+	require.NoError(t, err)
+	errs := payload.Config[0].Errors
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0].Error, "invalid number of parameters in nginx.conf:4")
+	require.EqualError(t, errs[1].Error, "invalid number of parameters in nginx.conf:6")
+	body := payload.Config[0].Parsed[0].Block[0].Block
+	require.Len(t, body, 2)
+	require.Equal(t, "$country", body[1].Directive)
+	require.Equal(t, []string{"default=US", "country", "iso_code"}, body[1].Args)
+
+	// entries are checked when they are added to the block
+	err = payload.Append(payload.Config[0].Parsed[0].Block[0], Directives{{Directive: "$city", Line: 7}}, options)
+	require.EqualError(t, err, "invalid number of parameters in nginx.conf:7")
+
+	// without the map body, the entries are unknown directives
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{ErrorOnUnknownDirectives: true, MatchFuncs: options.MatchFuncs})
+	require.NoError(t, err)
+	require.Len(t, payload.Config[0].Errors, 4)
+	require.EqualError(t, payload.Config[0].Errors[0].Error, `unknown directive "auto_reload" in nginx.conf:3`)
+
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{MapBodies: map[string]MapBody{"maxminddb": {}}})
+	require.EqualError(t, err, `map-like block "maxminddb": no number of values`)
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{MapBodies: map[string]MapBody{
+		"maxminddb": {Values: MapValues{Args: []int{1}}, Parameters: map[string]MapValues{"auto_reload": {Args: []int{9}}}},
+	}})
+	require.EqualError(t, err, `map-like block "maxminddb": parameter "auto_reload": invalid number of values 9`)
+}
+
+func TestParse_mapBodiesOverride(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    types {
+        text/html html;
+    }
+}
+`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+	require.Empty(t, payload.Config[0].Errors)
+
+	options := &ParseOptions{MapBodies: map[string]MapBody{"types": {Values: MapValues{Variadic: true, MinArgs: 2}}}}
+	payload, err = ParseFiles(files, "nginx.conf", options)
+	require.NoError(t, err)
+	require.Len(t, payload.Config[0].Errors, 1)
+	require.EqualError(t, payload.Config[0].Errors[0].Error, "invalid number of parameters in nginx.conf:3")
+}
@@ -2029,6 +2029,42 @@ func TestAnalyze_lua(t *testing.T) {
 			blockCtx{"http"},
 			true,
 		},
+		"content_by_lua_block ok": {
+			&Directive{
+				Directive: "content_by_lua_block",
+				Args:      []string{"\n ngx.say('hello') \n"},
+				Line:      5,
+			},
+			blockCtx{"http", "location"},
+			false,
+		},
+		"content_by_lua_block not ok": {
+			&Directive{
+				Directive: "content_by_lua_block",
+				Args:      []string{"\n ngx.say('hello') \n"},
+				Line:      5,
+			},
+			blockCtx{"http"},
+			true,
+		},
+		"set_by_lua_block ok": {
+			&Directive{
+				Directive: "set_by_lua_block",
+				Args:      []string{"$res", " return 32 "},
+				Line:      5,
+			},
+			blockCtx{"http", "server"},
+			false,
+		},
+		"set_by_lua_block not ok": {
+			&Directive{
+				Directive: "set_by_lua_block",
+				Args:      []string{" return 32 "},
+				Line:      5,
+			},
+			blockCtx{"http", "server"},
+			true,
+		},
 	}
 
 	for name, tc := range testcases {
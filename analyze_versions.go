@@ -0,0 +1,274 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Edition is an edition of nginx, either the open source nginx or NGINX Plus.
+type Edition int
+
+const (
+	EditionOSS Edition = iota
+	EditionPlus
+)
+
+func (e Edition) String() string {
+	if e == EditionPlus {
+		return "NGINX Plus"
+	}
+	return "nginx"
+}
+
+// Target is the edition and the version of nginx a config is parsed for.
+type Target struct {
+	Edition Edition
+	// Version is the version of nginx, like "1.24.0". For NGINX Plus, it is the version of nginx
+	// the release is based on, as shown by "nginx -v", like "1.25.3" for R31. If it is empty, the
+	// target is the latest release, for which only the edition, and the directives that were
+	// removed or deprecated, are checked.
+	Version string
+}
+
+// directiveVersion tells the edition and the versions of nginx that have a directive.
+type directiveVersion struct {
+	// plus is true for directives only available in NGINX Plus.
+	plus bool
+	// added is the first version with the directive, removed the first version without it,
+	// and deprecated the version since which it is deprecated.
+	added, removed, deprecated string
+	// instead is what to use instead of a removed or deprecated directive.
+	instead string
+}
+
+// directiveVersions holds the history of the directives whose availability depends on the edition
+// or on the version of nginx. The directives that are not in it are available in all of the releases
+// of both editions that are supported by the analyzer.
+//
+//nolint:gochecknoglobals
+var directiveVersions = map[string]directiveVersion{
+	// NGINX Plus
+	"api":                              {plus: true, added: "1.13.3"},
+	"auth_jwt":                         {plus: true},
+	"auth_jwt_claim_set":               {plus: true},
+	"auth_jwt_header_set":              {plus: true},
+	"auth_jwt_key_cache":               {plus: true},
+	"auth_jwt_key_file":                {plus: true},
+	"auth_jwt_key_request":             {plus: true},
+	"auth_jwt_leeway":                  {plus: true},
+	"auth_jwt_require":                 {plus: true},
+	"auth_jwt_type":                    {plus: true},
+	"f4f":                              {plus: true},
+	"f4f_buffer_size":                  {plus: true},
+	"fastcgi_cache_purge":              {plus: true},
+	"health_check":                     {plus: true},
+	"health_check_timeout":             {plus: true},
+	"hls":                              {plus: true},
+	"hls_buffers":                      {plus: true},
+	"hls_forward_args":                 {plus: true},
+	"hls_fragment":                     {plus: true},
+	"hls_mp4_buffer_size":              {plus: true},
+	"hls_mp4_max_buffer_size":          {plus: true},
+	"internal_redirect":                {plus: true},
+	"keyval":                           {plus: true, added: "1.13.3"},
+	"keyval_zone":                      {plus: true, added: "1.13.3"},
+	"least_time":                       {plus: true},
+	"match":                            {plus: true},
+	"mgmt":                             {plus: true, added: "1.27.2"},
+	"mp4_limit_rate":                   {plus: true},
+	"mp4_limit_rate_after":             {plus: true},
+	"ntlm":                             {plus: true},
+	"proxy_cache_purge":                {plus: true},
+	"queue":                            {plus: true},
+	"scgi_cache_purge":                 {plus: true},
+	"session_log":                      {plus: true},
+	"session_log_format":               {plus: true},
+	"session_log_zone":                 {plus: true},
+	"state":                            {plus: true},
+	"status":                           {plus: true, deprecated: "1.13.3", removed: "1.13.11", instead: `the "api" directive`},
+	"status_format":                    {plus: true, deprecated: "1.13.3", removed: "1.13.11", instead: `the "api" directive`},
+	"status_zone":                      {plus: true},
+	"sticky":                           {plus: true},
+	"sticky_cookie_insert":             {plus: true, removed: "1.7.0", instead: `the "sticky" directive`},
+	"upstream_conf":                    {plus: true, deprecated: "1.13.3", removed: "1.13.11", instead: `the "api" directive`},
+	"usage_report":                     {plus: true, added: "1.27.2"},
+	"uuid_file":                        {plus: true, added: "1.27.2"},
+	"uwsgi_cache_purge":                {plus: true},
+	"zone_sync":                        {plus: true, added: "1.15.2"},
+	"zone_sync_buffers":                {plus: true, added: "1.15.2"},
+	"zone_sync_connect_retry_interval": {plus: true, added: "1.15.2"},
+	"zone_sync_connect_timeout":        {plus: true, added: "1.15.2"},
+	"zone_sync_interval":               {plus: true, added: "1.15.2"},
+	"zone_sync_recv_buffer_size":       {plus: true, added: "1.15.2"},
+	"zone_sync_server":                 {plus: true, added: "1.15.2"},
+	"zone_sync_ssl":                    {plus: true, added: "1.15.2"},
+	"zone_sync_timeout":                {plus: true, added: "1.15.2"},
+
+	// HTTP/3 and QUIC
+	"http3":                           {added: "1.25.0"},
+	"http3_hq":                        {added: "1.25.0"},
+	"http3_max_concurrent_streams":    {added: "1.25.0"},
+	"http3_stream_buffer_size":        {added: "1.25.0"},
+	"quic_active_connection_id_limit": {added: "1.25.0"},
+	"quic_bpf":                        {added: "1.25.0"},
+	"quic_gso":                        {added: "1.25.0"},
+	"quic_host_key":                   {added: "1.25.0"},
+	"quic_retry":                      {added: "1.25.0"},
+
+	// HTTP/2 and SPDY
+	"http2":                 {added: "1.25.1"},
+	"http2_idle_timeout":    {deprecated: "1.19.7", instead: `the "keepalive_timeout" directive`},
+	"http2_max_field_size":  {deprecated: "1.19.7", instead: `the "large_client_header_buffers" directive`},
+	"http2_max_header_size": {deprecated: "1.19.7", instead: `the "large_client_header_buffers" directive`},
+	"http2_max_requests":    {deprecated: "1.19.7", instead: `the "keepalive_requests" directive`},
+	"http2_push":            {deprecated: "1.25.1"},
+	"http2_push_preload":    {deprecated: "1.25.1"},
+	"http2_recv_timeout":    {deprecated: "1.19.7", instead: `the "client_header_timeout" directive`},
+	"spdy_chunk_size":       {removed: "1.9.5", instead: "HTTP/2"},
+	"spdy_headers_comp":     {removed: "1.9.5", instead: "HTTP/2"},
+
+	// SSL
+	"ssl":                    {deprecated: "1.15.0", removed: "1.25.1", instead: `the "ssl" parameter of the "listen" directive`},
+	"ssl_conf_command":       {added: "1.19.4"},
+	"ssl_early_data":         {added: "1.15.3"},
+	"ssl_ocsp":               {added: "1.19.0"},
+	"ssl_ocsp_cache":         {added: "1.19.0"},
+	"ssl_reject_handshake":   {added: "1.19.4"},
+	"proxy_ssl_conf_command": {added: "1.19.4"},
+
+	// gRPC
+	"grpc_bind":                    {added: "1.13.10"},
+	"grpc_buffer_size":             {added: "1.13.10"},
+	"grpc_connect_timeout":         {added: "1.13.10"},
+	"grpc_hide_header":             {added: "1.13.10"},
+	"grpc_ignore_headers":          {added: "1.13.10"},
+	"grpc_intercept_errors":        {added: "1.13.10"},
+	"grpc_next_upstream":           {added: "1.13.10"},
+	"grpc_next_upstream_timeout":   {added: "1.13.10"},
+	"grpc_next_upstream_tries":     {added: "1.13.10"},
+	"grpc_pass":                    {added: "1.13.10"},
+	"grpc_pass_header":             {added: "1.13.10"},
+	"grpc_read_timeout":            {added: "1.13.10"},
+	"grpc_send_timeout":            {added: "1.13.10"},
+	"grpc_set_header":              {added: "1.13.10"},
+	"grpc_socket_keepalive":        {added: "1.15.6"},
+	"grpc_ssl_certificate":         {added: "1.13.10"},
+	"grpc_ssl_certificate_key":     {added: "1.13.10"},
+	"grpc_ssl_ciphers":             {added: "1.13.10"},
+	"grpc_ssl_conf_command":        {added: "1.19.4"},
+	"grpc_ssl_crl":                 {added: "1.13.10"},
+	"grpc_ssl_name":                {added: "1.13.10"},
+	"grpc_ssl_password_file":       {added: "1.13.10"},
+	"grpc_ssl_protocols":           {added: "1.13.10"},
+	"grpc_ssl_server_name":         {added: "1.13.10"},
+	"grpc_ssl_session_reuse":       {added: "1.13.10"},
+	"grpc_ssl_trusted_certificate": {added: "1.13.10"},
+	"grpc_ssl_verify":              {added: "1.13.10"},
+	"grpc_ssl_verify_depth":        {added: "1.13.10"},
+
+	// others
+	"auth_delay":                    {added: "1.17.10"},
+	"keepalive_time":                {added: "1.19.10"},
+	"limit_conn_dry_run":            {added: "1.17.6"},
+	"limit_req_dry_run":             {added: "1.17.1"},
+	"mirror":                        {added: "1.13.4"},
+	"mp4_start_key_frame":           {added: "1.21.4"},
+	"proxy_socket_keepalive":        {added: "1.15.6"},
+	"random":                        {added: "1.15.1"},
+	"subrequest_output_buffer_size": {added: "1.13.10"},
+}
+
+// validate returns an error if the version of the target is not a version number.
+func (t *Target) validate() error {
+	if t.Version == "" {
+		return nil
+	}
+	if _, err := parseVersion(t.Version); err != nil {
+		return fmt.Errorf("invalid target version %q: %w", t.Version, err)
+	}
+	return nil
+}
+
+// check returns why a directive cannot be used with the target, or an empty string if it can.
+func (t *Target) check(directive string) string {
+	v, ok := directiveVersions[directive]
+	if !ok {
+		return ""
+	}
+	switch {
+	case v.plus && t.Edition != EditionPlus:
+		return fmt.Sprintf(`"%s" directive is only available in %s`, directive, EditionPlus)
+	case t.Version != "" && v.added != "" && compareVersions(t.Version, v.added) < 0:
+		return fmt.Sprintf(`"%s" directive requires %s %s or later, the target is %s`, directive, t.Edition, v.added, t.Version)
+	case v.removed != "" && (t.Version == "" || compareVersions(t.Version, v.removed) >= 0):
+		return fmt.Sprintf(`"%s" directive was removed in %s %s%s`, directive, t.Edition, v.removed, insteadOf(v.instead))
+	case v.deprecated != "" && (t.Version == "" || compareVersions(t.Version, v.deprecated) >= 0):
+		return fmt.Sprintf(`"%s" directive is deprecated since %s %s%s`, directive, t.Edition, v.deprecated, insteadOf(v.instead))
+	}
+	return ""
+}
+
+func insteadOf(instead string) string {
+	if instead == "" {
+		return ""
+	}
+	return ", use " + instead + " instead"
+}
+
+// analyzeTarget returns a ParseError if a directive cannot be used with the target.
+func analyzeTarget(fname string, stmt *Directive, ctx blockCtx, target *Target) error {
+	what := target.check(stmt.Directive)
+	if what == "" {
+		return nil
+	}
+	return &ParseError{
+		What:      what,
+		File:      &fname,
+		Line:      &stmt.Line,
+		Statement: stmt.String(),
+		BlockCtx:  ctx.getLastBlock(),
+	}
+}
+
+// parseVersion returns the numbers of a version like "1.25.3".
+func parseVersion(version string) ([]int, error) {
+	parts := strings.Split(version, ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		if !isDigits(part) {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+		nums[i], _ = strconv.Atoi(part)
+	}
+	return nums, nil
+}
+
+// compareVersions compares two valid versions, returning -1, 0 or 1 if a is older, the same or newer than b.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
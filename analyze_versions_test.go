@@ -0,0 +1,148 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarget_check(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		target    Target
+		directive string
+		want      string
+	}{
+		"core directive": {
+			target:    Target{Version: "1.0.0"},
+			directive: "server_name",
+		},
+		"plus directive in oss": {
+			target:    Target{Version: "1.27.0"},
+			directive: "zone_sync",
+			want:      `"zone_sync" directive is only available in NGINX Plus`,
+		},
+		"plus directive in plus": {
+			target:    Target{Edition: EditionPlus, Version: "1.27.0"},
+			directive: "zone_sync",
+		},
+		"plus directive in older plus": {
+			target:    Target{Edition: EditionPlus, Version: "1.25.5"},
+			directive: "mgmt",
+			want:      `"mgmt" directive requires NGINX Plus 1.27.2 or later, the target is 1.25.5`,
+		},
+		"added later": {
+			target:    Target{Version: "1.24.0"},
+			directive: "http3",
+			want:      `"http3" directive requires nginx 1.25.0 or later, the target is 1.24.0`,
+		},
+		"added before": {
+			target:    Target{Version: "1.25.0"},
+			directive: "http3",
+		},
+		"added without version": {
+			directive: "http2",
+		},
+		"removed": {
+			target:    Target{Version: "1.26.2"},
+			directive: "ssl",
+			want:      `"ssl" directive was removed in nginx 1.25.1, use the "ssl" parameter of the "listen" directive instead`,
+		},
+		"deprecated": {
+			target:    Target{Version: "1.24.0"},
+			directive: "ssl",
+			want:      `"ssl" directive is deprecated since nginx 1.15.0, use the "ssl" parameter of the "listen" directive instead`,
+		},
+		"before deprecation": {
+			target:    Target{Version: "1.14.2"},
+			directive: "ssl",
+		},
+		"removed without version": {
+			directive: "spdy_chunk_size",
+			want:      `"spdy_chunk_size" directive was removed in nginx 1.9.5, use HTTP/2 instead`,
+		},
+		"deprecated without replacement": {
+			target:    Target{Version: "1.25.1"},
+			directive: "http2_push",
+			want:      `"http2_push" directive is deprecated since nginx 1.25.1`,
+		},
+		"short version": {
+			target:    Target{Version: "1.13"},
+			directive: "grpc_pass",
+			want:      `"grpc_pass" directive requires nginx 1.13.10 or later, the target is 1.13`,
+		},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.want, tc.target.check(tc.directive))
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, 0, compareVersions("1.25.0", "1.25.0"))
+	require.Equal(t, 0, compareVersions("1.25", "1.25.0"))
+	require.Equal(t, -1, compareVersions("1.9.5", "1.13.10"))
+	require.Equal(t, 1, compareVersions("1.25.1", "1.25"))
+	require.Equal(t, 1, compareVersions("2.0.0", "1.27.2"))
+}
+
+func TestParse_target(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    server {
+        listen 443 ssl;
+        listen 443 quic;
+        ssl on;
+        http3 on;
+        location /api {
+            api write=on;
+        }
+    }
+}
+`,
+	}
+
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{Target: &Target{Version: "1.24.0"}})
+	require.NoError(t, err)
+	errs := payload.Config[0].Errors
+	require.Len(t, errs, 3)
+	require.EqualError(t, errs[0].Error,
+		`"ssl" directive is deprecated since nginx 1.15.0, use the "ssl" parameter of the "listen" directive instead in nginx.conf:5`)
+	require.EqualError(t, errs[1].Error, `"http3" directive requires nginx 1.25.0 or later, the target is 1.24.0 in nginx.conf:6`)
+	require.EqualError(t, errs[2].Error, `"api" directive is only available in NGINX Plus in nginx.conf:8`)
+
+	// the directives are kept
+	server := payload.Config[0].Parsed[0].Block[0]
+	require.Len(t, server.Block, 5)
+
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{Target: &Target{Edition: EditionPlus, Version: "1.27.2"}})
+	require.NoError(t, err)
+	errs = payload.Config[0].Errors
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0].Error,
+		`"ssl" directive was removed in NGINX Plus 1.25.1, use the "ssl" parameter of the "listen" directive instead in nginx.conf:5`)
+
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{Target: &Target{Version: "1.24.0"}, StopParsingOnError: true})
+	require.EqualError(t, err,
+		`"ssl" directive is deprecated since nginx 1.15.0, use the "ssl" parameter of the "listen" directive instead in nginx.conf:5`)
+
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{Target: &Target{Version: "1.x"}})
+	require.EqualError(t, err, `invalid target version "1.x": "x" is not a number`)
+
+	// the directives are only checked with a target
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+	require.Empty(t, payload.Config[0].Errors)
+}
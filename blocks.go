@@ -0,0 +1,356 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The typed views below give access to the common blocks of a payload without parsing the
+// arguments of their directives by hand. They are built from the payload when requested and
+// are read-only: they keep pointers to the directives they were built from, but changing a
+// directive does not update a view built before. Directives of included files are treated
+// as if they were in the block of the include directive.
+
+// HTTP is a view of the http block of a payload.
+type HTTP struct {
+	Directive *Directive
+	Servers   []*Server
+	Upstreams []*Upstream
+}
+
+// Server is a view of a server block in the http block.
+type Server struct {
+	Directive *Directive
+	Listen    []*Listen
+	// ServerNames holds the arguments of all of the server_name directives of the server.
+	ServerNames []string
+	Locations   []*Location
+}
+
+// Listen is a view of a listen directive, of a server in either the http or the stream block.
+type Listen struct {
+	Directive *Directive
+	// Address is the address to listen on, without the port, e.g. "127.0.0.1", "[::]",
+	// "example.com" or "unix:/var/run/nginx.sock". It is empty if the directive only has a port.
+	Address string
+	// Port is the port to listen on, it is 0 for a unix socket or a port that is not a number.
+	// A listen directive of an http server without a port listens on port 80.
+	Port int
+
+	DefaultServer bool
+	SSL           bool
+	HTTP2         bool
+	QUIC          bool
+	ProxyProtocol bool
+	// UDP is only used by listen directives of stream servers.
+	UDP bool
+
+	// Params holds the parameters that follow the address, as written in the directive.
+	Params []string
+}
+
+// Location is a view of a location block.
+type Location struct {
+	Directive *Directive
+	// Modifier is one of "=", "~", "~*" or "^~", or empty for a prefix or a named location.
+	Modifier string
+	// Path is the URI, the regular expression or the name of the location, e.g. "/", "\.php$" or "@fallback".
+	Path      string
+	Locations []*Location
+}
+
+// Upstream is a view of an upstream block, in either the http or the stream block.
+type Upstream struct {
+	Directive *Directive
+	Name      string
+	Servers   []*UpstreamServer
+}
+
+// UpstreamServer is a view of a server directive in an upstream block.
+type UpstreamServer struct {
+	Directive *Directive
+	Address   string
+	// Weight, MaxFails and FailTimeout have the defaults of nginx if they are not set.
+	Weight      int
+	MaxFails    int
+	FailTimeout string
+	MaxConns    int
+	Backup      bool
+	Down        bool
+	// Params holds the parameters that follow the address, as written in the directive.
+	Params []string
+}
+
+// Stream is a view of the stream block of a payload.
+type Stream struct {
+	Directive *Directive
+	Servers   []*StreamServer
+	Upstreams []*Upstream
+}
+
+// StreamServer is a view of a server block in the stream block.
+type StreamServer struct {
+	Directive *Directive
+	Listen    []*Listen
+}
+
+// IsNamed returns true if the location is a named location, like "@fallback".
+func (l *Location) IsNamed() bool {
+	return l.Modifier == "" && strings.HasPrefix(l.Path, "@")
+}
+
+// IsRegex returns true if the path of the location is a regular expression.
+func (l *Location) IsRegex() bool {
+	return l.Modifier == "~" || l.Modifier == "~*"
+}
+
+// HTTP returns a view of the http block of the main config, or nil if there is none.
+func (p *Payload) HTTP() *HTTP {
+	d := p.topLevel("http")
+	if d == nil {
+		return nil
+	}
+	h := &HTTP{Directive: d}
+	for _, child := range p.children(d) {
+		switch child.Directive {
+		case "server":
+			if server := p.Server(child); server != nil {
+				h.Servers = append(h.Servers, server)
+			}
+		case "upstream":
+			if upstream := p.Upstream(child); upstream != nil {
+				h.Upstreams = append(h.Upstreams, upstream)
+			}
+		}
+	}
+	return h
+}
+
+// Stream returns a view of the stream block of the main config, or nil if there is none.
+func (p *Payload) Stream() *Stream {
+	d := p.topLevel("stream")
+	if d == nil {
+		return nil
+	}
+	s := &Stream{Directive: d}
+	for _, child := range p.children(d) {
+		switch child.Directive {
+		case "server":
+			if server := p.StreamServer(child); server != nil {
+				s.Servers = append(s.Servers, server)
+			}
+		case "upstream":
+			if upstream := p.Upstream(child); upstream != nil {
+				s.Upstreams = append(s.Upstreams, upstream)
+			}
+		}
+	}
+	return s
+}
+
+// Server returns a view of a server block of the http block, or nil if d is not a server block.
+func (p *Payload) Server(d *Directive) *Server {
+	if d == nil || d.Directive != "server" || !d.IsBlock() {
+		return nil
+	}
+	s := &Server{Directive: d}
+	for _, child := range p.children(d) {
+		switch child.Directive {
+		case "listen":
+			if l := newListen(child, 80); l != nil {
+				s.Listen = append(s.Listen, l)
+			}
+		case "server_name":
+			s.ServerNames = append(s.ServerNames, child.Args...)
+		case "location":
+			if l := p.Location(child); l != nil {
+				s.Locations = append(s.Locations, l)
+			}
+		}
+	}
+	return s
+}
+
+// StreamServer returns a view of a server block of the stream block, or nil if d is not a server block.
+func (p *Payload) StreamServer(d *Directive) *StreamServer {
+	if d == nil || d.Directive != "server" || !d.IsBlock() {
+		return nil
+	}
+	s := &StreamServer{Directive: d}
+	for _, child := range p.children(d) {
+		if child.Directive == "listen" {
+			if l := newListen(child, 0); l != nil {
+				s.Listen = append(s.Listen, l)
+			}
+		}
+	}
+	return s
+}
+
+// Location returns a view of a location block, or nil if d is not a location block.
+func (p *Payload) Location(d *Directive) *Location {
+	if d == nil || d.Directive != "location" || !d.IsBlock() || len(d.Args) == 0 {
+		return nil
+	}
+	l := &Location{Directive: d}
+	l.Modifier, l.Path = locationPath(d.Args)
+	for _, child := range p.children(d) {
+		if nested := p.Location(child); nested != nil {
+			l.Locations = append(l.Locations, nested)
+		}
+	}
+	return l
+}
+
+// Upstream returns a view of an upstream block, or nil if d is not an upstream block.
+func (p *Payload) Upstream(d *Directive) *Upstream {
+	if d == nil || d.Directive != "upstream" || !d.IsBlock() || len(d.Args) == 0 {
+		return nil
+	}
+	u := &Upstream{Directive: d, Name: d.Args[0]}
+	for _, child := range p.children(d) {
+		if child.Directive == "server" && len(child.Args) > 0 {
+			u.Servers = append(u.Servers, newUpstreamServer(child))
+		}
+	}
+	return u
+}
+
+// locationPath returns the modifier and the path of the arguments of a location directive.
+func locationPath(args []string) (modifier, path string) {
+	switch {
+	case len(args) == 0:
+		return "", ""
+	case len(args) > 1:
+		return args[0], args[1]
+	}
+	// like nginx, accept a modifier written without a space before the path, e.g. "=/exact"
+	for _, m := range []string{"=", "^~", "~*", "~"} {
+		if strings.HasPrefix(args[0], m) {
+			return m, args[0][len(m):]
+		}
+	}
+	return "", args[0]
+}
+
+// topLevel returns the first directive with the given name at the top level of the main config.
+func (p *Payload) topLevel(name string) *Directive {
+	if len(p.Config) == 0 {
+		return nil
+	}
+	for _, d := range p.expandIncludes(p.Config[0].Parsed, []int{0}) {
+		if d.Directive == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// children returns the directives in the block of d, with the directives of included configs
+// in place of the include directives.
+func (p *Payload) children(d *Directive) Directives {
+	return p.expandIncludes(d.Block, nil)
+}
+
+// newListen returns a view of a listen directive, defaultPort is the port used if the
+// address of the directive has none.
+func newListen(d *Directive, defaultPort int) *Listen {
+	if len(d.Args) == 0 {
+		return nil
+	}
+	l := &Listen{Directive: d, Params: d.Args[1:]}
+	addr := d.Args[0]
+
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		l.Address = addr
+	case isDigits(addr):
+		l.Port, _ = strconv.Atoi(addr)
+	default:
+		host, port := addr, ""
+		if i := strings.LastIndexByte(addr, ':'); i >= 0 && i > strings.LastIndexByte(addr, ']') {
+			host, port = addr[:i], addr[i+1:]
+		}
+		l.Address = host
+		if port == "" {
+			l.Port = defaultPort
+		} else {
+			l.Port, _ = strconv.Atoi(port)
+		}
+	}
+
+	for _, param := range l.Params {
+		switch param {
+		case "default_server", "default":
+			l.DefaultServer = true
+		case "ssl":
+			l.SSL = true
+		case "http2":
+			l.HTTP2 = true
+		case "quic":
+			l.QUIC = true
+		case "proxy_protocol":
+			l.ProxyProtocol = true
+		case "udp":
+			l.UDP = true
+		}
+	}
+	return l
+}
+
+// newUpstreamServer returns a view of a server directive of an upstream block.
+func newUpstreamServer(d *Directive) *UpstreamServer {
+	s := &UpstreamServer{
+		Directive:   d,
+		Address:     d.Args[0],
+		Weight:      1,
+		MaxFails:    1,
+		FailTimeout: "10s",
+		Params:      d.Args[1:],
+	}
+	for _, param := range s.Params {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "weight":
+			s.Weight = atoiOr(value, s.Weight)
+		case "max_fails":
+			s.MaxFails = atoiOr(value, s.MaxFails)
+		case "fail_timeout":
+			s.FailTimeout = value
+		case "max_conns":
+			s.MaxConns = atoiOr(value, s.MaxConns)
+		case "backup":
+			s.Backup = true
+		case "down":
+			s.Down = true
+		}
+	}
+	return s
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// atoiOr returns the integer in s, or def if s is not an integer.
+func atoiOr(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
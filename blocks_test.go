@@ -0,0 +1,123 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload_HTTP(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("blocks", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	http := payload.HTTP()
+	require.NotNil(t, http)
+	require.Equal(t, "http", http.Directive.Directive)
+	require.Len(t, http.Servers, 2)
+
+	server := http.Servers[0]
+	require.Equal(t, []string{"example.com", "www.example.com"}, server.ServerNames)
+	require.Len(t, server.Listen, 3)
+	listen := []Listen{
+		{Address: "", Port: 80, DefaultServer: true, Params: []string{"default_server"}},
+		{Address: "[::]", Port: 443, SSL: true, HTTP2: true, Params: []string{"ssl", "http2"}},
+		{Address: "127.0.0.1", Port: 80, Params: []string{}},
+	}
+	for i, l := range server.Listen {
+		require.Equal(t, "listen", l.Directive.Directive)
+		l.Directive = nil
+		require.Equal(t, listen[i], *l)
+	}
+
+	type location struct {
+		modifier, path string
+		named, regex   bool
+		nested         int
+	}
+	locations := []location{
+		{"", "/", false, false, 1},
+		{"=", "/exact", false, false, 0},
+		{"^~", "/static/", false, false, 0},
+		{"~", "/regex", false, true, 0},
+		{"", "@fallback", true, false, 0},
+	}
+	require.Len(t, server.Locations, len(locations))
+	for i, l := range server.Locations {
+		got := location{l.Modifier, l.Path, l.IsNamed(), l.IsRegex(), len(l.Locations)}
+		require.Equal(t, locations[i], got)
+	}
+	nested := server.Locations[0].Locations[0]
+	require.Equal(t, "~*", nested.Modifier)
+	require.Equal(t, `\.(gif|jpg)$`, nested.Path)
+
+	// the second server, its listen directive and its location are in included files
+	server = http.Servers[1]
+	require.Equal(t, []string{"api.example.com"}, server.ServerNames)
+	require.Len(t, server.Listen, 1)
+	require.Equal(t, 8443, server.Listen[0].Port)
+	require.True(t, server.Listen[0].SSL)
+	require.Len(t, server.Locations, 1)
+	require.Equal(t, "/v1/", server.Locations[0].Path)
+
+	require.Len(t, http.Upstreams, 1)
+	upstream := http.Upstreams[0]
+	require.Equal(t, "backend", upstream.Name)
+	servers := []UpstreamServer{
+		{
+			Address: "10.0.0.1:8080", Weight: 5, MaxFails: 3, FailTimeout: "30s",
+			Params: []string{"weight=5", "max_fails=3", "fail_timeout=30s"},
+		},
+		{Address: "10.0.0.2:8080", Weight: 1, MaxFails: 1, FailTimeout: "10s", MaxConns: 100, Params: []string{"max_conns=100"}},
+		{Address: "unix:/tmp/backend.sock", Weight: 1, MaxFails: 1, FailTimeout: "10s", Backup: true, Params: []string{"backup"}},
+		{Address: "10.0.0.3:8080", Weight: 1, MaxFails: 1, FailTimeout: "10s", Down: true, Params: []string{"down"}},
+	}
+	require.Len(t, upstream.Servers, len(servers))
+	for i, s := range upstream.Servers {
+		require.Equal(t, "server", s.Directive.Directive)
+		s.Directive = nil
+		require.Equal(t, servers[i], *s)
+	}
+}
+
+func TestPayload_Stream(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("blocks", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	stream := payload.Stream()
+	require.NotNil(t, stream)
+	require.Len(t, stream.Servers, 1)
+	listen := stream.Servers[0].Listen
+	require.Len(t, listen, 2)
+	require.Equal(t, 53, listen[0].Port)
+	require.True(t, listen[0].UDP)
+	require.Equal(t, []string{"udp", "reuseport"}, listen[0].Params)
+	require.Equal(t, "unix:/var/run/stream.sock", listen[1].Address)
+	require.Equal(t, 0, listen[1].Port)
+
+	require.Len(t, stream.Upstreams, 1)
+	require.Equal(t, "dns", stream.Upstreams[0].Name)
+	require.Equal(t, "10.0.0.53:53", stream.Upstreams[0].Servers[0].Address)
+}
+
+func TestPayload_blocksMissing(t *testing.T) {
+	t.Parallel()
+	payload, err := ParseFiles(map[string]string{"nginx.conf": "events {}\n"}, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+	require.Nil(t, payload.HTTP())
+	require.Nil(t, payload.Stream())
+	require.Nil(t, (&Payload{}).HTTP())
+
+	d := &Directive{Directive: "location", Args: []string{"/"}}
+	require.Nil(t, payload.Location(d), "not a block")
+	require.Nil(t, payload.Server(d), "not a server")
+	require.Nil(t, payload.Upstream(d), "not an upstream")
+}
@@ -18,9 +18,45 @@ import (
 )
 
 type BuildOptions struct {
-	Indent int
-	Tabs   bool
-	Header bool
+	Indent   int
+	Tabs     bool
+	Header   bool
+	Builders []RegisterBuilder // handle specific directives
+
+	extBuilders map[string]ExternalBuilder
+}
+
+// RegisterBuilder is an option that can be used to add a builder to build NGINX configuration for
+// custom directives.
+type RegisterBuilder interface {
+	applyBuildOptions(options *BuildOptions)
+}
+
+type registerBuilder struct {
+	b          ExternalBuilder
+	directives []string
+}
+
+func (rb registerBuilder) applyBuildOptions(o *BuildOptions) {
+	if o.extBuilders == nil {
+		o.extBuilders = make(map[string]ExternalBuilder)
+	}
+
+	for _, s := range rb.directives {
+		o.extBuilders[s] = rb.b
+	}
+}
+
+// BuildWithBuilder registers a builder to build the NGINX configuration for the given directives.
+func BuildWithBuilder(b ExternalBuilder, directives ...string) RegisterBuilder {
+	return registerBuilder{b: b, directives: directives}
+}
+
+// ExternalBuilder is the interface that provides an abstraction for implementing builders that
+// can handle external and custom NGINX directives. Build must return the complete rendering of
+// the directive, including its terminating ";" or block.
+type ExternalBuilder interface {
+	Build(stmt *Directive) string
 }
 
 const MaxIndent = 100
@@ -38,7 +74,9 @@ const header = `# This config was built from JSON using NGINX crossplane.
 `
 
 // BuildFiles builds all of the config files in a crossplane.Payload and
-// writes them to disk.
+// writes them to disk. A file included from several block contexts has a config
+// for each of them in the payload, only the first of them is built and the
+// others are ignored, so changes to a file must be made in its first config.
 func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 	if dir == "" {
 		cwd, err := os.Getwd()
@@ -48,7 +86,15 @@ func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 		dir = cwd
 	}
 
+	built := map[string]bool{}
 	for _, config := range payload.Config {
+		// a file included from several contexts appears once per context and the instances
+		// may differ, as directives not allowed in a context are left out, build the first
+		if built[config.File] {
+			continue
+		}
+		built[config.File] = true
+
 		path := config.File
 		if !filepath.IsAbs(path) {
 			path = filepath.Join(dir, path)
@@ -71,7 +117,11 @@ func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 			return err
 		}
 
-		output := append(bytes.TrimRightFunc(buf.Bytes(), unicode.IsSpace), '\n')
+		// configs parsed with trivia are written exactly as built
+		output := buf.Bytes()
+		if !usesTrivia(config) {
+			output = append(bytes.TrimRightFunc(output, unicode.IsSpace), '\n')
+		}
 		if _, err := f.Write(output); err != nil {
 			return err
 		}
@@ -83,12 +133,24 @@ func BuildFiles(payload Payload, dir string, options *BuildOptions) error {
 	return nil
 }
 
-// Build creates an NGINX config from a crossplane.Config.
+// Build creates an NGINX config from a crossplane.Config. If the config was parsed with
+// ParseOptions.ParseTrivia, directives that have not been modified are written back
+// exactly as they were parsed and only the modified ones are rendered anew. Configs
+// that failed to parse are rendered anew, since their trivia may not match their source.
 func Build(w io.Writer, config Config, options *BuildOptions) error {
+	// the options may be shared by concurrent builds, so the defaults and the
+	// registered builders are set on a copy
+	opts := *options
+	options = &opts
 	if options.Indent == 0 {
 		options.Indent = 4
 	}
 
+	options.extBuilders = nil
+	for _, rb := range options.Builders {
+		rb.applyBuildOptions(options)
+	}
+
 	if options.Header {
 		_, err := w.Write([]byte(header))
 		if err != nil {
@@ -97,6 +159,11 @@ func Build(w io.Writer, config Config, options *BuildOptions) error {
 	}
 
 	body := strings.Builder{}
+	if usesTrivia(config) {
+		buildWithTrivia(&body, config, options)
+		_, err := w.Write([]byte(body.String()))
+		return err
+	}
 	buildBlock(&body, nil, config.Parsed, 0, 0, options)
 
 	bodyStr := body.String()
@@ -124,7 +191,9 @@ func buildBlock(sb io.StringWriter, parent *Directive, block Directives, depth i
 
 		_, _ = sb.WriteString(margin(options, depth))
 
-		if stmt.IsComment() {
+		if ext, ok := options.extBuilders[stmt.Directive]; ok && !stmt.IsComment() {
+			_, _ = sb.WriteString(ext.Build(stmt))
+		} else if stmt.IsComment() {
 			_, _ = sb.WriteString("#")
 			_, _ = sb.WriteString(*stmt.Comment)
 		} else {
@@ -270,9 +339,18 @@ func escape(s string) string {
 }
 
 // BuildInto builds all of the config files in a crossplane.Payload and
-// writes them to the Creator.
+// writes them to the Creator. Like with BuildFiles, only the first config of
+// a file included from several block contexts is built.
 func BuildInto(payload *Payload, into Creator, options *BuildOptions) error {
+	built := map[string]bool{}
 	for _, config := range payload.Config {
+		// a file included from several contexts appears once per context and the instances
+		// may differ, as directives not allowed in a context are left out, build the first
+		if built[config.File] {
+			continue
+		}
+		built[config.File] = true
+
 		wc, err := into.Create(config.File)
 		if err != nil {
 			return err
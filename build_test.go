@@ -13,7 +13,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 type buildFixture struct {
@@ -278,6 +281,38 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+// TestBuild_sharedOptions checks that builds sharing their options don't write to them.
+func TestBuild_sharedOptions(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	options := &BuildOptions{Builders: []RegisterBuilder{lua.RegisterBuilder()}}
+	config := Config{Parsed: Directives{
+		{Directive: "content_by_lua_block", Args: []string{"ngx.say('hello')"}},
+	}}
+
+	var wg sync.WaitGroup
+	built := make([]string, 8)
+	errs := make([]error, len(built))
+	for i := range built {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			errs[i] = Build(&buf, config, options)
+			built[i] = buf.String()
+		}()
+	}
+	wg.Wait()
+
+	for i, b := range built {
+		require.NoError(t, errs[i])
+		require.Equal(t, "content_by_lua_block {ngx.say('hello')}", b)
+	}
+	require.Nil(t, options.extBuilders)
+	require.Zero(t, options.Indent)
+}
+
 //nolint:gochecknoglobals
 var buildFilesFixtures = []buildFilesFixture{
 	{
@@ -460,6 +495,7 @@ func equalPayloadConfigs(c1, c2 []Config) bool {
 
 func equalConfigs(c1, c2 Config) bool {
 	return c1.Status == c2.Status &&
+		equals(c1.Context, c2.Context) &&
 		equalConfigErrors(c1.Errors, c2.Errors) &&
 		equalBlocks(c1.Parsed, c2.Parsed)
 }
@@ -552,3 +588,48 @@ func TestBuildInto(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildInto_includedFromMultipleContexts(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("includes-contexts", "nginx.conf"), &ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := new(StringsCreator)
+	if err := BuildInto(payload, sc, &BuildOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.Files) != 2 {
+		t.Fatalf("expected 2 files but got %d", len(sc.Files))
+	}
+	if got := sc.Files[1].String(); got != "resolver 127.0.0.1;\nkeepalive_timeout 5s;\n" {
+		t.Fatalf("unexpected shared file: %#v", got)
+	}
+}
+
+func TestBuildFiles_includedFromMultipleContexts(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("includes-contexts", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, payload.Config, 3)
+	require.Equal(t, payload.Config[1].File, payload.Config[2].File)
+
+	// the first config of the shared file is built, changes to the other one are ignored
+	payload.Config[1].Parsed[0].Args = []string{"127.0.0.2"}
+	payload.Config[2].Parsed[0].Args = []string{"127.0.0.3"}
+
+	sc := new(StringsCreator)
+	require.NoError(t, BuildInto(payload, sc, &BuildOptions{}))
+	require.Len(t, sc.Files, 2)
+	require.Equal(t, "resolver 127.0.0.2;\nkeepalive_timeout 5s;\n", sc.Files[1].String())
+
+	dir := t.TempDir()
+	payload.Config[1].File = "shared.conf"
+	payload.Config[2].File = "shared.conf"
+	require.NoError(t, BuildFiles(*payload, dir, &BuildOptions{}))
+	content, err := os.ReadFile(filepath.Join(dir, "shared.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "resolver 127.0.0.2;\nkeepalive_timeout 5s;\n", string(content))
+}
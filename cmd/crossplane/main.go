@@ -0,0 +1,484 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Command crossplane is a quick and reliable way to convert NGINX configurations into JSON and back.
+// It supports the same commands and flags as the Python crossplane tool:
+//
+//	crossplane parse [-o OUT] [-i NUM] [--ignore DIRECTIVES] [--no-catch] [--combine]
+//	                 [--single-file] [--include-comments] [--strict] [--structured-errors] filename
+//	crossplane build [-d PATH] [-f] [-i NUM | -t] [--no-headers] [--stdout] [-v] filename
+//	crossplane lex [-o OUT] [-i NUM] [-n] filename
+//	crossplane minify [-o OUT] filename
+//	crossplane format [-o OUT] [-i NUM | -t] filename
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	crossplane "github.com/nginxinc/nginx-go-crossplane"
+)
+
+const usage = `usage: crossplane <command> [options]
+
+various operations for nginx config files
+
+commands:
+  parse     parses a json payload for an nginx config
+  build     builds an nginx config from a json payload
+  lex       lexes tokens from an nginx config file
+  minify    removes all whitespace from an nginx config
+  format    formats an nginx config file
+  help      show help for commands
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line tool and returns its exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd, ok := commands()[args[0]]
+	if !ok {
+		if args[0] == "help" {
+			return help(args[1:], stdout, stderr)
+		}
+		fmt.Fprintf(stderr, "crossplane: invalid command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("crossplane "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	exec := cmd(fs)
+	filenames, err := parseArgs(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if len(filenames) != 1 {
+		fmt.Fprintf(stderr, "%s: expected exactly one filename\n", fs.Name())
+		fs.Usage()
+		return 2
+	}
+
+	if err := exec(filenames[0], stdin, stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "crossplane: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func help(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+	cmd, ok := commands()[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "crossplane: unknown command %q\n", args[0])
+		return 2
+	}
+	fs := flag.NewFlagSet("crossplane "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	cmd(fs)
+	fs.Usage()
+	return 0
+}
+
+// command defines the flags of a command on a flag set and returns the function executing it.
+type command func(fs *flag.FlagSet) func(filename string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+func commands() map[string]command {
+	return map[string]command{
+		"parse":  parseCmd,
+		"build":  buildCmd,
+		"lex":    lexCmd,
+		"minify": minifyCmd,
+		"format": formatCmd,
+	}
+}
+
+// parseArgs parses flags that may come before or after the positional arguments, like argparse does.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// stringFlag defines a string flag with a short and a long name.
+func stringFlag(fs *flag.FlagSet, short string, long string, value string, usage string) *string {
+	p := fs.String(long, value, usage)
+	if short != "" {
+		fs.StringVar(p, short, value, usage)
+	}
+	return p
+}
+
+// intFlag defines an int flag with a short and a long name.
+func intFlag(fs *flag.FlagSet, short string, long string, value int, usage string) *int {
+	p := fs.Int(long, value, usage)
+	if short != "" {
+		fs.IntVar(p, short, value, usage)
+	}
+	return p
+}
+
+// boolFlag defines a bool flag with a short and a long name.
+func boolFlag(fs *flag.FlagSet, short string, long string, usage string) *bool {
+	p := fs.Bool(long, false, usage)
+	if short != "" {
+		fs.BoolVar(p, short, false, usage)
+	}
+	return p
+}
+
+// output returns the writer for the --out flag, which is stdout if the flag is not set.
+func output(out string, stdout io.Writer) (io.Writer, func() error, error) {
+	if out == "" {
+		return stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// lua enables the *_by_lua_block directives, which Python crossplane supports by default.
+func lua(options *crossplane.ParseOptions) *crossplane.ParseOptions {
+	l := &crossplane.Lua{}
+	options.MatchFuncs = append(options.MatchFuncs, crossplane.MatchLua)
+	options.LexOptions.Lexers = append(options.LexOptions.Lexers, l.RegisterLexer())
+	return options
+}
+
+func luaBuilder(options *crossplane.BuildOptions) *crossplane.BuildOptions {
+	l := &crossplane.Lua{}
+	options.Builders = append(options.Builders, l.RegisterBuilder())
+	return options
+}
+
+func parseCmd(fs *flag.FlagSet) func(string, io.Reader, io.Writer, io.Writer) error {
+	out := stringFlag(fs, "o", "out", "", "write output to a file")
+	indent := intFlag(fs, "i", "indent", 0, "number of spaces to indent output")
+	ignore := fs.String("ignore", "", "ignore directives (comma-separated)")
+	noCatch := fs.Bool("no-catch", false, "only collect first error in file")
+	combine := fs.Bool("combine", false, "use includes to create one single file")
+	single := fs.Bool("single-file", false, "do not include other config files")
+	comments := fs.Bool("include-comments", false, "include comments in json")
+	strict := fs.Bool("strict", false, "raise errors for unknown directives")
+	structured := fs.Bool("structured-errors", false, "add the structured form of errors to json")
+
+	return func(filename string, _ io.Reader, stdout io.Writer, _ io.Writer) error {
+		options := lua(&crossplane.ParseOptions{
+			StopParsingOnError:       *noCatch,
+			CombineConfigs:           *combine,
+			SingleFile:               *single,
+			ParseComments:            *comments,
+			ErrorOnUnknownDirectives: *strict,
+			StructuredErrors:         *structured,
+		})
+		if *ignore != "" {
+			options.IgnoreDirectives = strings.Split(*ignore, ",")
+		}
+
+		payload, err := crossplane.Parse(filename, options)
+		if err != nil {
+			return err
+		}
+
+		w, closeOut, err := output(*out, stdout)
+		if err != nil {
+			return err
+		}
+		if err := dumpJSON(w, payload, *indent); err != nil {
+			return err
+		}
+		return closeOut()
+	}
+}
+
+func buildCmd(fs *flag.FlagSet) func(string, io.Reader, io.Writer, io.Writer) error {
+	dir := stringFlag(fs, "d", "dir", "", "the base directory to build in")
+	force := boolFlag(fs, "f", "force", "overwrite existing files")
+	indent := intFlag(fs, "i", "indent", 4, "number of spaces to indent output")
+	tabs := boolFlag(fs, "t", "tabs", "indent with tabs instead of spaces")
+	noHeaders := fs.Bool("no-headers", false, "do not write header to configs")
+	toStdout := fs.Bool("stdout", false, "write configs to stdout instead")
+	verbose := boolFlag(fs, "v", "verbose", "verbose output")
+
+	return func(filename string, stdin io.Reader, stdout io.Writer, _ io.Writer) error {
+		dirname := *dir
+		if dirname == "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			dirname = cwd
+		}
+
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var payload crossplane.Payload
+		if err := json.Unmarshal(content, &payload); err != nil {
+			return err
+		}
+
+		path := func(config crossplane.Config) string {
+			if filepath.IsAbs(config.File) {
+				return config.File
+			}
+			return filepath.Join(dirname, config.File)
+		}
+		options := luaBuilder(&crossplane.BuildOptions{Indent: *indent, Tabs: *tabs, Header: !*noHeaders})
+
+		// if stdout is set then just print each file after another like nginx -T
+		if *toStdout {
+			for _, config := range payload.Config {
+				var buf bytes.Buffer
+				if err := crossplane.Build(&buf, config, options); err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "# %s\n%s\n\n", path(config), strings.TrimRight(buf.String(), " \t\r\n"))
+			}
+			return nil
+		}
+
+		// find which files from the json payload will overwrite existing files,
+		// and ask the user if it's okay to overwrite them
+		if !*force {
+			var existing []string
+			for _, config := range payload.Config {
+				if _, err := os.Stat(path(config)); err == nil {
+					existing = append(existing, path(config))
+				}
+			}
+			if len(existing) > 0 {
+				fmt.Fprintf(stdout, "building %s would overwrite these files:\n%s\n", filename, strings.Join(existing, "\n"))
+				if !promptYes(stdin, stdout) {
+					fmt.Fprintln(stdout, "not overwritten")
+					return nil
+				}
+			}
+		}
+
+		if err := crossplane.BuildFiles(payload, dirname, options); err != nil {
+			return err
+		}
+
+		// if verbose print the paths of the config files that were created
+		if *verbose {
+			for _, config := range payload.Config {
+				fmt.Fprintf(stdout, "wrote to %s\n", path(config))
+			}
+		}
+		return nil
+	}
+}
+
+func promptYes(stdin io.Reader, stdout io.Writer) bool {
+	fmt.Fprint(stdout, "overwrite? (y/n [n]) ")
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y")
+}
+
+func lexCmd(fs *flag.FlagSet) func(string, io.Reader, io.Writer, io.Writer) error {
+	out := stringFlag(fs, "o", "out", "", "write output to a file")
+	indent := intFlag(fs, "i", "indent", 0, "number of spaces to indent output")
+	lineNumbers := boolFlag(fs, "n", "line-numbers", "include line numbers in json payload")
+
+	return func(filename string, _ io.Reader, stdout io.Writer, _ io.Writer) error {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		options := lua(&crossplane.ParseOptions{}).LexOptions
+		tokens := []interface{}{}
+		tokenizer := crossplane.NewTokenizer(f, options)
+		for {
+			token, err := tokenizer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if *lineNumbers {
+				tokens = append(tokens, []interface{}{token.Value, token.Line})
+			} else {
+				tokens = append(tokens, token.Value)
+			}
+		}
+
+		w, closeOut, err := output(*out, stdout)
+		if err != nil {
+			return err
+		}
+		if err := dumpJSON(w, tokens, *indent); err != nil {
+			return err
+		}
+		return closeOut()
+	}
+}
+
+func minifyCmd(fs *flag.FlagSet) func(string, io.Reader, io.Writer, io.Writer) error {
+	out := stringFlag(fs, "o", "out", "", "write output to a file")
+
+	return func(filename string, _ io.Reader, stdout io.Writer, _ io.Writer) error {
+		payload, err := crossplane.Parse(filename, lua(&crossplane.ParseOptions{
+			SingleFile:                true,
+			StopParsingOnError:        true,
+			SkipDirectiveContextCheck: true,
+			SkipDirectiveArgsCheck:    true,
+		}))
+		if err != nil {
+			return err
+		}
+
+		var sb strings.Builder
+		minify(&sb, payload.Config[0].Parsed)
+		sb.WriteString("\n")
+
+		w, closeOut, err := output(*out, stdout)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+		return closeOut()
+	}
+}
+
+func minify(sb *strings.Builder, block crossplane.Directives) {
+	for _, stmt := range block {
+		sb.WriteString(crossplane.Enquote(stmt.Directive))
+		if stmt.Directive == "if" {
+			sb.WriteString(" (")
+			sb.WriteString(enquoteAll(stmt.Args))
+			sb.WriteString(")")
+		} else if len(stmt.Args) > 0 {
+			sb.WriteString(" ")
+			sb.WriteString(enquoteAll(stmt.Args))
+		}
+
+		if stmt.IsBlock() {
+			sb.WriteString("{")
+			minify(sb, stmt.Block)
+			sb.WriteString("}")
+		} else {
+			sb.WriteString(";")
+		}
+	}
+}
+
+func enquoteAll(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, crossplane.Enquote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func formatCmd(fs *flag.FlagSet) func(string, io.Reader, io.Writer, io.Writer) error {
+	out := stringFlag(fs, "o", "out", "", "write output to a file")
+	indent := intFlag(fs, "i", "indent", 4, "number of spaces to indent output")
+	tabs := boolFlag(fs, "t", "tabs", "indent with tabs instead of spaces")
+
+	return func(filename string, _ io.Reader, stdout io.Writer, _ io.Writer) error {
+		payload, err := crossplane.Parse(filename, lua(&crossplane.ParseOptions{
+			SingleFile:                true,
+			ParseComments:             true,
+			SkipDirectiveContextCheck: true,
+			SkipDirectiveArgsCheck:    true,
+		}))
+		if err != nil {
+			return err
+		}
+		if payload.Status != "ok" {
+			return payload.Errors[0].Error
+		}
+
+		var buf bytes.Buffer
+		if err := crossplane.Build(&buf, payload.Config[0], luaBuilder(&crossplane.BuildOptions{Indent: *indent, Tabs: *tabs})); err != nil {
+			return err
+		}
+		buf.WriteString("\n")
+
+		w, closeOut, err := output(*out, stdout)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		return closeOut()
+	}
+}
+
+// dumpJSON writes v as JSON the way Python's json.dumps does: compact unless indent is set,
+// without escaping HTML characters, and with non-ASCII characters escaped.
+func dumpJSON(w io.Writer, v interface{}, indent int) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent > 0 {
+		enc.SetIndent("", strings.Repeat(" ", indent))
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(asciiJSON(buf.Bytes()))
+	return err
+}
+
+// asciiJSON escapes the non-ASCII characters of JSON, which can only appear in strings.
+func asciiJSON(b []byte) []byte {
+	var out bytes.Buffer
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r < utf8.RuneSelf:
+			out.WriteByte(b[0])
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&out, `\u%04x\u%04x`, r1, r2)
+		default:
+			fmt.Fprintf(&out, `\u%04x`, r)
+		}
+		b = b[size:]
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,179 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	crossplane "github.com/nginxinc/nginx-go-crossplane"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestConfigPath(parts ...string) string {
+	return filepath.Join(append([]string{"..", "..", "testdata", "configs"}, parts...)...)
+}
+
+func runCmd(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestRun_parse(t *testing.T) {
+	t.Parallel()
+	path := getTestConfigPath("includes-regular", "nginx.conf")
+
+	testcases := map[string]struct {
+		args    []string
+		options crossplane.ParseOptions
+	}{
+		"default": {
+			args: []string{"parse", path},
+		},
+		"flags after filename": {
+			args:    []string{"parse", path, "--single-file", "--include-comments"},
+			options: crossplane.ParseOptions{SingleFile: true, ParseComments: true},
+		},
+		"combine and ignore": {
+			args:    []string{"parse", "--combine", "--ignore", "listen,server_name", path},
+			options: crossplane.ParseOptions{CombineConfigs: true, IgnoreDirectives: []string{"listen", "server_name"}},
+		},
+		"structured errors": {
+			args:    []string{"parse", "--strict", "--structured-errors", path},
+			options: crossplane.ParseOptions{ErrorOnUnknownDirectives: true, StructuredErrors: true},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			stdout, stderr, code := runCmd(t, "", tc.args...)
+			require.Equal(t, 0, code, stderr)
+
+			expected, err := crossplane.Parse(path, &tc.options)
+			require.NoError(t, err)
+			b, err := json.Marshal(expected)
+			require.NoError(t, err)
+			require.JSONEq(t, string(b), stdout)
+			require.NotContains(t, stdout, "\n  ", "output must be compact without --indent")
+		})
+	}
+}
+
+func TestRun_parse_pythonCompatibleJSON(t *testing.T) {
+	t.Parallel()
+	stdout, _, code := runCmd(t, "", "parse", "-i", "4", getTestConfigPath("russian-text", "nginx.conf"))
+	require.Equal(t, 0, code)
+	require.Contains(t, stdout, "\n    \"status\": \"ok\",\n")
+	require.Contains(t, stdout, `"\u0440\u0443\u0441\u0441\u043a\u0438\u0439 \u0442\u0435\u043a\u0441\u0442"`)
+}
+
+func TestRun_parse_noCatch(t *testing.T) {
+	t.Parallel()
+	_, stderr, code := runCmd(t, "", "parse", "--strict", "--no-catch", getTestConfigPath("spelling-mistake", "nginx.conf"))
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, `unknown directive "proxy_passs"`)
+}
+
+func TestRun_lex(t *testing.T) {
+	t.Parallel()
+	path := getTestConfigPath("simple", "nginx.conf")
+
+	stdout, _, code := runCmd(t, "", "lex", path)
+	require.Equal(t, 0, code)
+	require.True(t, strings.HasPrefix(stdout, `["events","{","worker_connections","1024",";","}","http",`))
+
+	stdout, _, code = runCmd(t, "", "lex", "--line-numbers", path)
+	require.Equal(t, 0, code)
+	require.True(t, strings.HasPrefix(stdout, `[["events",1],["{",1],["worker_connections",2],`))
+}
+
+func TestRun_minify(t *testing.T) {
+	t.Parallel()
+	stdout, _, code := runCmd(t, "", "minify", getTestConfigPath("simple", "nginx.conf"))
+	require.Equal(t, 0, code)
+	require.Equal(t, "events{worker_connections 1024;}http{server{listen 127.0.0.1:8080;"+
+		"server_name default_server;location /{return 200 \"foo bar baz\";}}}\n", stdout)
+}
+
+func TestRun_format(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(path, []byte("events{worker_connections 1024;}\nhttp{ # comment\nserver{}}"), os.ModePerm))
+
+	stdout, _, code := runCmd(t, "", "format", path)
+	require.Equal(t, 0, code)
+	require.Equal(t, "events {\n    worker_connections 1024;\n}\nhttp { # comment\n    server {\n    }\n}\n", stdout)
+
+	stdout, _, code = runCmd(t, "", "format", "--tabs", path)
+	require.Equal(t, 0, code)
+	require.Contains(t, stdout, "\n\tworker_connections 1024;\n")
+}
+
+func TestRun_build(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	payload := filepath.Join(dir, "payload.json")
+	stdout, _, code := runCmd(t, "", "parse", "-o", payload, getTestConfigPath("simple", "nginx.conf"))
+	require.Equal(t, 0, code)
+	require.Empty(t, stdout)
+
+	stdout, _, code = runCmd(t, "", "build", "--stdout", "--no-headers", payload)
+	require.Equal(t, 0, code)
+	require.True(t, strings.HasPrefix(stdout, "# /"), stdout)
+	require.Contains(t, stdout, "\nevents {\n    worker_connections 1024;\n}\n")
+
+	out := filepath.Join(dir, "out")
+	stdout, _, code = runCmd(t, "", "build", "-d", out, "-v", payload)
+	require.Equal(t, 0, code)
+	built := filepath.Join(out, getTestConfigPath("simple", "nginx.conf"))
+	require.Equal(t, "wrote to "+built+"\n", stdout)
+	content, err := os.ReadFile(built)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(content), "# This config was built from JSON using NGINX crossplane.\n"))
+
+	// existing files are only overwritten after confirmation or with --force
+	require.NoError(t, os.WriteFile(built, []byte("unchanged"), os.ModePerm))
+	stdout, _, code = runCmd(t, "n\n", "build", "-d", out, payload)
+	require.Equal(t, 0, code)
+	require.Contains(t, stdout, "would overwrite these files:\n"+built+"\n")
+	require.Contains(t, stdout, "not overwritten")
+	content, err = os.ReadFile(built)
+	require.NoError(t, err)
+	require.Equal(t, "unchanged", string(content))
+
+	_, _, code = runCmd(t, "", "build", "-f", "-d", out, payload)
+	require.Equal(t, 0, code)
+	content, err = os.ReadFile(built)
+	require.NoError(t, err)
+	require.NotEqual(t, "unchanged", string(content))
+}
+
+func TestRun_usage(t *testing.T) {
+	t.Parallel()
+	_, stderr, code := runCmd(t, "")
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr, "usage: crossplane")
+
+	_, _, code = runCmd(t, "", "nope")
+	require.Equal(t, 2, code)
+
+	_, _, code = runCmd(t, "", "parse")
+	require.Equal(t, 2, code)
+
+	stdout, _, code := runCmd(t, "", "help", "build")
+	require.Equal(t, 0, code)
+	require.Contains(t, stdout, "-no-headers")
+}
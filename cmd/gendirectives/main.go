@@ -0,0 +1,474 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Command gendirectives generates the bit masks of the directives of nginx, or of third-party modules,
+// from the ngx_command_t arrays of their C sources, in the same format as the directives table of
+// analyze.go:
+//
+//	gendirectives -src DIR [-name NAME] [-match FUNC] [-package PKG] [-o FILE]
+//	gendirectives -src DIR -diff FILE [-name NAME] [-missing]
+//
+// The first form writes a Go file with a map named NAME, and a MatchFunc named FUNC using it if -match
+// is set, so that adding a module is a matter of adding a go:generate comment like:
+//
+//	//go:generate go run ./cmd/gendirectives -src ../njs/nginx -name njsDirectives -match MatchNjs -o analyze_njs.go
+//
+// The second form compares the masks found in the sources with the map named NAME in FILE, like
+// analyze.go, and prints the directives which are missing from the map or whose masks are different.
+// With -missing, the directives of the map which are not in the sources are printed as well. It
+// exits with status 1 if there are differences.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const header = `/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Code generated by gendirectives; DO NOT EDIT.
+
+`
+
+// maskFlag is a bit mask of analyze.go, with the name of the constant and of the macro of nginx it is
+// generated from, if there is one.
+type maskFlag struct {
+	macro string
+	name  string
+	value uint
+}
+
+// flags are the bit masks of analyze.go. They must have the same values as the constants.
+//
+//nolint:gochecknoglobals
+var flags = []maskFlag{
+	{"NGX_CONF_NOARGS", "ngxConfNoArgs", 0x00000001},
+	{"NGX_CONF_TAKE1", "ngxConfTake1", 0x00000002},
+	{"NGX_CONF_TAKE2", "ngxConfTake2", 0x00000004},
+	{"NGX_CONF_TAKE3", "ngxConfTake3", 0x00000008},
+	{"NGX_CONF_TAKE4", "ngxConfTake4", 0x00000010},
+	{"NGX_CONF_TAKE5", "ngxConfTake5", 0x00000020},
+	{"NGX_CONF_TAKE6", "ngxConfTake6", 0x00000040},
+	{"NGX_CONF_BLOCK", "ngxConfBlock", 0x00000100},
+	{"", "ngxConfExpr", 0x00000200},
+	{"NGX_CONF_FLAG", "ngxConfFlag", 0x00000400},
+	{"NGX_CONF_ANY", "ngxConfAny", 0x00000800},
+	{"NGX_CONF_1MORE", "ngxConf1More", 0x00001000},
+	{"NGX_CONF_2MORE", "ngxConf2More", 0x00002000},
+
+	{"NGX_CONF_TAKE12", "ngxConfTake12", 0x00000006},
+	{"NGX_CONF_TAKE13", "ngxConfTake13", 0x0000000a},
+	{"NGX_CONF_TAKE23", "ngxConfTake23", 0x0000000c},
+	{"", "ngxConfTake34", 0x00000018},
+	{"NGX_CONF_TAKE123", "ngxConfTake123", 0x0000000e},
+	{"NGX_CONF_TAKE1234", "ngxConfTake1234", 0x0000001e},
+
+	{"NGX_DIRECT_CONF", "ngxDirectConf", 0x00010000},
+	{"", "ngxMgmtMainConf", 0x00020000},
+	{"NGX_MAIN_CONF", "ngxMainConf", 0x00040000},
+	{"NGX_EVENT_CONF", "ngxEventConf", 0x00080000},
+	{"NGX_MAIL_MAIN_CONF", "ngxMailMainConf", 0x00100000},
+	{"NGX_MAIL_SRV_CONF", "ngxMailSrvConf", 0x00200000},
+	{"NGX_STREAM_MAIN_CONF", "ngxStreamMainConf", 0x00400000},
+	{"NGX_STREAM_SRV_CONF", "ngxStreamSrvConf", 0x00800000},
+	{"NGX_STREAM_UPS_CONF", "ngxStreamUpsConf", 0x01000000},
+	{"NGX_HTTP_MAIN_CONF", "ngxHTTPMainConf", 0x02000000},
+	{"NGX_HTTP_SRV_CONF", "ngxHTTPSrvConf", 0x04000000},
+	{"NGX_HTTP_LOC_CONF", "ngxHTTPLocConf", 0x08000000},
+	{"NGX_HTTP_UPS_CONF", "ngxHTTPUpsConf", 0x10000000},
+	{"NGX_HTTP_SIF_CONF", "ngxHTTPSifConf", 0x20000000},
+	{"NGX_HTTP_LIF_CONF", "ngxHTTPLifConf", 0x40000000},
+	{"NGX_HTTP_LMT_CONF", "ngxHTTPLmtConf", 0x80000000},
+	{"NGX_ANY_CONF", "ngxAnyConf", 0xfffc0000},
+
+	// only kept for compatibility by nginx, it has no bits
+	{"NGX_CONF_MULTI", "", 0},
+}
+
+// exprCommands are the commands whose arguments are an expression in parentheses, by the name of their
+// C file and their name. nginx parses these expressions itself so they have no flag in the sources,
+// the generated masks get the ngxConfExpr bit that analyze.go uses to check them.
+//
+//nolint:gochecknoglobals
+var exprCommands = map[[2]string]bool{
+	{"ngx_http_rewrite_module.c", "if"}: true,
+}
+
+// mask is a bit mask of a directive, with the Go expression it is written with.
+type mask struct {
+	value uint
+	expr  string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line tool and returns its exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gendirectives", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	src := fs.String("src", "", "directory of the C sources of nginx or of a module")
+	name := fs.String("name", "directives", "name of the map of directives")
+	match := fs.String("match", "", "name of the MatchFunc to generate for the map")
+	pkg := fs.String("package", "crossplane", "package of the generated file")
+	out := fs.String("o", "", "write the generated file to a file instead of stdout")
+	diff := fs.String("diff", "", "compare the directives with the map in a Go file instead of generating it")
+	missing := fs.Bool("missing", false, "with -diff, also print the directives of the map which are not in the sources")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *src == "" || fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "gendirectives: -src is required and there are no positional arguments")
+		fs.Usage()
+		return 2
+	}
+
+	found, err := readSources(*src, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "gendirectives: %v\n", err)
+		return 1
+	}
+
+	if *diff != "" {
+		table, err := readTable(*diff, *name)
+		if err != nil {
+			fmt.Fprintf(stderr, "gendirectives: %v\n", err)
+			return 1
+		}
+		if compare(stdout, found, table, *name, *missing) {
+			return 1
+		}
+		return 0
+	}
+
+	b, err := generate(found, *pkg, *name, *match)
+	if err != nil {
+		fmt.Fprintf(stderr, "gendirectives: %v\n", err)
+		return 1
+	}
+	if *out == "" {
+		_, err = stdout.Write(b)
+	} else {
+		err = os.WriteFile(*out, b, 0o644) //nolint:gosec
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gendirectives: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+//nolint:gochecknoglobals
+var (
+	cComment   = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	cDirective = regexp.MustCompile(`(?m)^[ \t]*#.*$`)
+	cCommands  = regexp.MustCompile(`ngx_command_t\s+\w+\s*\[\s*\]\s*=\s*\{`)
+	cCommand   = regexp.MustCompile(`\{\s*ngx_string\(\s*"([^"]+)"\s*\)\s*,\s*([A-Z0-9_|()\s]+?)\s*,`)
+)
+
+// readSources returns the masks of the directives found in the .c files under dir, in the order of the
+// files and of the commands. Commands with a mask which cannot be generated are skipped with a warning.
+func readSources(dir string, stderr io.Writer) (map[string][]mask, error) {
+	found := map[string][]mask{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".c" {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, cmd := range parseCommands(string(b)) {
+			m, err := cMask(cmd[1])
+			if err != nil {
+				fmt.Fprintf(stderr, "gendirectives: skipping %q in %s: %v\n", cmd[0], path, err)
+				continue
+			}
+			if exprCommands[[2]string{filepath.Base(path), cmd[0]}] {
+				m = withExpr(m)
+			}
+			if !hasMask(found[cmd[0]], m.value) {
+				found[cmd[0]] = append(found[cmd[0]], m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no ngx_command_t arrays found in %s", dir)
+	}
+	return found, nil
+}
+
+// parseCommands returns the names and the masks of the commands of the ngx_command_t arrays of a C file.
+func parseCommands(src string) [][2]string {
+	src = cComment.ReplaceAllString(src, "")
+	src = cDirective.ReplaceAllString(src, "")
+
+	var cmds [][2]string
+	for _, loc := range cCommands.FindAllStringIndex(src, -1) {
+		body := src[loc[1]:]
+		if end := strings.Index(body, "ngx_null_command"); end >= 0 {
+			body = body[:end]
+		}
+		for _, m := range cCommand.FindAllStringSubmatch(body, -1) {
+			cmds = append(cmds, [2]string{m[1], m[2]})
+		}
+	}
+	return cmds
+}
+
+// cMask converts the mask of a command, like "NGX_HTTP_MAIN_CONF|NGX_CONF_FLAG", to a Go expression.
+func cMask(expr string) (mask, error) {
+	var m mask
+	var names []string
+	for _, macro := range strings.Split(expr, "|") {
+		macro = strings.Trim(strings.TrimSpace(macro), "()")
+		f, ok := flagByMacro(macro)
+		if !ok {
+			return mask{}, fmt.Errorf("unknown flag %s", macro)
+		}
+		if f.name == "" {
+			continue
+		}
+		m.value |= f.value
+		names = append(names, f.name)
+	}
+	m.expr = strings.Join(names, " | ")
+	return m, nil
+}
+
+// withExpr adds the ngxConfExpr bit to a mask, after ngxConfBlock like in analyze.go.
+func withExpr(m mask) mask {
+	const expr = "ngxConfExpr"
+	for _, f := range flags {
+		if f.name == expr {
+			m.value |= f.value
+		}
+	}
+	names := strings.Split(m.expr, " | ")
+	at := len(names)
+	for i, name := range names {
+		if name == "ngxConfBlock" {
+			at = i + 1
+		}
+	}
+	names = append(names[:at], append([]string{expr}, names[at:]...)...)
+	m.expr = strings.Join(names, " | ")
+	return m
+}
+
+func flagByMacro(macro string) (maskFlag, bool) {
+	for _, f := range flags {
+		if f.macro == macro && macro != "" {
+			return f, true
+		}
+	}
+	return maskFlag{}, false
+}
+
+func hasMask(masks []mask, value uint) bool {
+	for _, m := range masks {
+		if m.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readTable returns the masks of the map named name in a Go file.
+func readTable(filename string, name string) (map[string][]mask, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint{}
+	for _, f := range flags {
+		if f.name != "" {
+			values[f.name] = f.value
+		}
+	}
+
+	obj := f.Scope.Lookup(name)
+	if obj == nil || obj.Kind != ast.Var {
+		return nil, fmt.Errorf("no variable %s in %s", name, filename)
+	}
+	spec, ok := obj.Decl.(*ast.ValueSpec)
+	if !ok || len(spec.Values) != 1 {
+		return nil, fmt.Errorf("variable %s in %s is not a map", name, filename)
+	}
+	lit, ok := spec.Values[0].(*ast.CompositeLit)
+	if !ok {
+		return nil, fmt.Errorf("variable %s in %s is not a map", name, filename)
+	}
+
+	table := map[string][]mask{}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.BasicLit)
+		if !ok || key.Kind != token.STRING {
+			continue
+		}
+		directive, err := strconv.Unquote(key.Value)
+		if err != nil {
+			return nil, err
+		}
+		masks, ok := kv.Value.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		for _, e := range masks.Elts {
+			v, err := eval(e, values)
+			if err != nil {
+				return nil, fmt.Errorf("%q in %s: %w", directive, filename, err)
+			}
+			table[directive] = append(table[directive], mask{value: v, expr: types.ExprString(e)})
+		}
+	}
+	return table, nil
+}
+
+// eval returns the value of a mask made of constants and of "|" operators.
+func eval(e ast.Expr, values map[string]uint) (uint, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return eval(e.X, values)
+	case *ast.Ident:
+		if v, ok := values[e.Name]; ok {
+			return v, nil
+		}
+		return 0, fmt.Errorf("unknown flag %s", e.Name)
+	case *ast.BinaryExpr:
+		if e.Op != token.OR {
+			break
+		}
+		x, err := eval(e.X, values)
+		if err != nil {
+			return 0, err
+		}
+		y, err := eval(e.Y, values)
+		if err != nil {
+			return 0, err
+		}
+		return x | y, nil
+	}
+	return 0, fmt.Errorf("unsupported mask %s", types.ExprString(e))
+}
+
+// compare prints the differences between the masks found in the sources and the map, and returns true
+// if there are any.
+func compare(w io.Writer, found map[string][]mask, table map[string][]mask, name string, missing bool) bool {
+	names := map[string]bool{}
+	for directive := range found {
+		names[directive] = true
+	}
+	if missing {
+		for directive := range table {
+			names[directive] = true
+		}
+	}
+
+	different := false
+	for _, directive := range sortedKeys(names) {
+		masks, ok := table[directive]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "+ %q is not in %s\n", directive, name)
+			printMasks(w, "", found[directive])
+		case found[directive] == nil:
+			fmt.Fprintf(w, "- %q is not in the sources\n", directive)
+			printMasks(w, "", masks)
+		default:
+			var removed, added []mask
+			for _, m := range masks {
+				if !hasMask(found[directive], m.value) {
+					removed = append(removed, m)
+				}
+			}
+			for _, m := range found[directive] {
+				if !hasMask(masks, m.value) {
+					added = append(added, m)
+				}
+			}
+			if len(removed) == 0 && len(added) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "~ %q has different masks\n", directive)
+			printMasks(w, "- ", removed)
+			printMasks(w, "+ ", added)
+		}
+		different = true
+	}
+	return different
+}
+
+func printMasks(w io.Writer, prefix string, masks []mask) {
+	for _, m := range masks {
+		fmt.Fprintf(w, "\t%s%s\n", prefix, m.expr)
+	}
+}
+
+// generate returns the Go file with the map of the directives, sorted by name like in analyze.go.
+func generate(found map[string][]mask, pkg string, name string, match string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "//nolint:gochecknoglobals\nvar %s = map[string][]uint{\n", name)
+	for _, directive := range sortedKeys(found) {
+		fmt.Fprintf(&buf, "%q: {\n", directive)
+		for _, m := range found[directive] {
+			fmt.Fprintf(&buf, "%s,\n", m.expr)
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+
+	if match != "" {
+		fmt.Fprintf(&buf, "\n// %s is a match function for parsing an NGINX config that contains the directives of %s.\n", match, name)
+		fmt.Fprintf(&buf, "func %s(directive string) ([]uint, bool) {\n", match)
+		fmt.Fprintf(&buf, "masks, matched := %s[directive]\nreturn masks, matched\n}\n", name)
+	}
+	return format.Source(buf.Bytes())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getTestModulePath(parts ...string) string {
+	return filepath.Join(append([]string{"..", "..", "testdata", "modules"}, parts...)...)
+}
+
+func runCmd(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestRun_generate(t *testing.T) {
+	t.Parallel()
+	stdout, stderr, code := runCmd(t, "-src", getTestModulePath("example"), "-name", "exampleDirectives", "-match", "MatchExample")
+	require.Equal(t, 0, code, stderr)
+	require.Contains(t, stderr, `skipping "example_seven"`)
+	require.Contains(t, stderr, "unknown flag NGX_CONF_TAKE7")
+
+	require.Equal(t, `/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Code generated by gendirectives; DO NOT EDIT.
+
+package crossplane
+
+//nolint:gochecknoglobals
+var exampleDirectives = map[string][]uint{
+	"example": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxConfFlag,
+		ngxStreamMainConf | ngxStreamSrvConf | ngxConfFlag,
+	},
+	"example_block": {
+		ngxHTTPSrvConf | ngxConfBlock | ngxConfNoArgs,
+	},
+	"example_zone": {
+		ngxHTTPMainConf | ngxConfTake12,
+	},
+}
+
+// MatchExample is a match function for parsing an NGINX config that contains the directives of exampleDirectives.
+func MatchExample(directive string) ([]uint, bool) {
+	masks, matched := exampleDirectives[directive]
+	return masks, matched
+}
+`, stdout)
+}
+
+func TestRun_generateFile(t *testing.T) {
+	t.Parallel()
+	out := filepath.Join(t.TempDir(), "analyze_example.go")
+	_, stderr, code := runCmd(t, "-src", getTestModulePath("example"), "-package", "example", "-o", out)
+	require.Equal(t, 0, code, stderr)
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "package example\n")
+	require.Contains(t, string(b), "var directives = map[string][]uint{\n")
+}
+
+func TestRun_diff(t *testing.T) {
+	t.Parallel()
+	src := getTestModulePath("example")
+	table := getTestModulePath("example", "table.go")
+
+	stdout, stderr, code := runCmd(t, "-src", src, "-diff", table, "-name", "exampleDirectives")
+	require.Equal(t, 1, code, stderr)
+	require.Equal(t, `~ "example" has different masks
+	+ ngxStreamMainConf | ngxStreamSrvConf | ngxConfFlag
+~ "example_block" has different masks
+	- ngxHTTPSrvConf | ngxConfBlock | ngxConfTake1
+	+ ngxHTTPSrvConf | ngxConfBlock | ngxConfNoArgs
++ "example_zone" is not in exampleDirectives
+	ngxHTTPMainConf | ngxConfTake12
+`, stdout)
+
+	stdout, _, code = runCmd(t, "-src", src, "-diff", table, "-name", "exampleDirectives", "-missing")
+	require.Equal(t, 1, code)
+	require.Contains(t, stdout, "- \"example_removed\" is not in the sources\n\tngxHTTPMainConf | ngxConfTake1\n")
+
+	_, stderr, code = runCmd(t, "-src", src, "-diff", table, "-name", "otherDirectives")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "no variable otherDirectives in")
+}
+
+// TestRun_diffExpr checks that the "if" of the rewrite module, whose expression has no flag in the sources,
+// has the mask of analyze.go.
+func TestRun_diffExpr(t *testing.T) {
+	t.Parallel()
+	src := getTestModulePath("rewrite")
+	stdout, stderr, code := runCmd(t, "-src", src, "-diff", filepath.Join("..", "..", "analyze.go"))
+	require.Equal(t, 1, code, stderr)
+	// return and set are also directives of the stream modules, which are not in the sources
+	require.Equal(t, `~ "return" has different masks
+	- ngxStreamSrvConf | ngxConfTake1
+~ "set" has different masks
+	- ngxStreamSrvConf | ngxConfTake2
+`, stdout)
+
+	stdout, stderr, code = runCmd(t, "-src", src)
+	require.Equal(t, 0, code, stderr)
+	require.Contains(t, stdout, `	"if": {
+		ngxHTTPSrvConf | ngxHTTPLocConf | ngxConfBlock | ngxConfExpr | ngxConf1More,
+	},
+`)
+}
+
+func TestRun_errors(t *testing.T) {
+	t.Parallel()
+	_, stderr, code := runCmd(t)
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr, "-src is required")
+
+	_, stderr, code = runCmd(t, "-src", getTestModulePath())
+	require.Equal(t, 0, code, stderr)
+
+	_, stderr, code = runCmd(t, "-src", t.TempDir())
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "no ngx_command_t arrays found")
+}
+
+// TestFlags checks that the flags have the values of the constants of analyze.go.
+func TestFlags(t *testing.T) {
+	t.Parallel()
+	f, err := parser.ParseFile(token.NewFileSet(), filepath.Join("..", "..", "analyze.go"), nil, 0)
+	require.NoError(t, err)
+
+	values := map[string]uint{}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			var v uint
+			if lit, ok := spec.Values[0].(*ast.BasicLit); ok {
+				n, err := strconv.ParseUint(lit.Value, 0, 32)
+				require.NoError(t, err)
+				v = uint(n)
+			} else {
+				v, err = eval(spec.Values[0], values)
+				require.NoError(t, err)
+			}
+			values[spec.Names[0].Name] = v
+		}
+	}
+
+	for _, f := range flags {
+		if f.name == "" {
+			continue
+		}
+		require.Contains(t, values, f.name)
+		require.Equal(t, values[f.name], f.value, f.name)
+	}
+}
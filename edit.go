@@ -0,0 +1,508 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"errors"
+	"fmt"
+)
+
+//nolint:gochecknoglobals
+var (
+	ErrDirectiveNotFound = errors.New("directive not found")
+	ErrNotBlock          = errors.New("directive is not a block")
+	ErrMoveIntoSelf      = errors.New("directive cannot be moved into its own block")
+)
+
+// The edit methods of Payload and Directives check the directives they place in a block like Parse
+// would, using the MatchFuncs and the Skip* and ErrorOnUnknownDirectives fields of the options, and
+// return the *ParseError of the first failed check without modifying anything. When options is nil
+// the defaults of Parse are used.
+//
+// Edits of a Payload also keep its include graph consistent: the configs included by a directive
+// that is placed in a new block context are checked and re-targeted to that context, and configs
+// that are no longer included from anywhere once a directive is removed are dropped from the payload.
+// Placed directives that have no line, or that come from another config, get the line of the
+// directive they are placed next to.
+
+// InsertBefore inserts directives right before target.
+func (p *Payload) InsertBefore(target *Directive, ds Directives, options *ParseOptions) error {
+	return newPayloadEditor(p, options).insert(target, ds, 0)
+}
+
+// InsertAfter inserts directives right after target.
+func (p *Payload) InsertAfter(target *Directive, ds Directives, options *ParseOptions) error {
+	return newPayloadEditor(p, options).insert(target, ds, 1)
+}
+
+// Append adds directives at the end of the block of parent, or at the end of the main config
+// if parent is nil.
+func (p *Payload) Append(parent *Directive, ds Directives, options *ParseOptions) error {
+	return newPayloadEditor(p, options).append(parent, ds)
+}
+
+// Replace replaces target with another directive.
+func (p *Payload) Replace(target *Directive, with *Directive, options *ParseOptions) error {
+	return newPayloadEditor(p, options).replace(target, with)
+}
+
+// Delete removes target.
+func (p *Payload) Delete(target *Directive) error {
+	return newPayloadEditor(p, nil).delete(target)
+}
+
+// Move removes target from its block and appends it to the block of parent, or to the end of
+// the main config if parent is nil.
+func (p *Payload) Move(target *Directive, parent *Directive, options *ParseOptions) error {
+	return newPayloadEditor(p, options).move(target, parent)
+}
+
+// InsertBefore inserts directives right before target, which can be in a nested block.
+func (ds *Directives) InsertBefore(target *Directive, insert Directives, options *ParseOptions) error {
+	return newDirectivesEditor(ds, options).insert(target, insert, 0)
+}
+
+// InsertAfter inserts directives right after target, which can be in a nested block.
+func (ds *Directives) InsertAfter(target *Directive, insert Directives, options *ParseOptions) error {
+	return newDirectivesEditor(ds, options).insert(target, insert, 1)
+}
+
+// Append adds directives at the end of the block of parent, or at the end of ds if parent is nil.
+func (ds *Directives) Append(parent *Directive, insert Directives, options *ParseOptions) error {
+	return newDirectivesEditor(ds, options).append(parent, insert)
+}
+
+// Replace replaces target, which can be in a nested block, with another directive.
+func (ds *Directives) Replace(target *Directive, with *Directive, options *ParseOptions) error {
+	return newDirectivesEditor(ds, options).replace(target, with)
+}
+
+// Delete removes target, which can be in a nested block.
+func (ds *Directives) Delete(target *Directive) error {
+	return newDirectivesEditor(ds, nil).delete(target)
+}
+
+// Move removes target from its block and appends it to the block of parent, or to the end of ds
+// if parent is nil.
+func (ds *Directives) Move(target *Directive, parent *Directive, options *ParseOptions) error {
+	return newDirectivesEditor(ds, options).move(target, parent)
+}
+
+// editor applies edits to either a payload or a tree of directives.
+type editor struct {
+	payload *Payload    // nil when editing directives
+	root    *Directives // only used when editing directives
+	options *ParseOptions
+}
+
+// location is the position of a directive, or the end of a block.
+type location struct {
+	config int // index of the config, -1 when editing directives
+	block  *Directives
+	index  int
+	ctx    blockCtx // block context of block
+}
+
+func newPayloadEditor(p *Payload, options *ParseOptions) *editor {
+	if options == nil {
+		options = &ParseOptions{}
+	}
+	return &editor{payload: p, options: options}
+}
+
+func newDirectivesEditor(ds *Directives, options *ParseOptions) *editor {
+	if options == nil {
+		options = &ParseOptions{}
+	}
+	return &editor{root: ds, options: options}
+}
+
+func (e *editor) file(config int) string {
+	if config < 0 {
+		return ""
+	}
+	return e.payload.Config[config].File
+}
+
+// find returns the location of target.
+func (e *editor) find(target *Directive) (location, error) {
+	if e.payload == nil {
+		if loc, ok := e.findIn(e.root, target, nil); ok {
+			loc.config = -1
+			return loc, nil
+		}
+		return location{}, ErrDirectiveNotFound
+	}
+	for i := range e.payload.Config {
+		config := &e.payload.Config[i]
+		if loc, ok := e.findIn(&config.Parsed, target, append(blockCtx{}, config.Context...)); ok {
+			loc.config = i
+			return loc, nil
+		}
+	}
+	return location{}, ErrDirectiveNotFound
+}
+
+func (e *editor) findIn(block *Directives, target *Directive, ctx blockCtx) (location, bool) {
+	for i, d := range *block {
+		if d == target {
+			return location{block: block, index: i, ctx: ctx}, true
+		}
+		if d.IsBlock() {
+			if loc, ok := e.findIn(&d.Block, target, enterBlockCtx(d, append(blockCtx{}, ctx...), e.options.Contexts)); ok {
+				return loc, true
+			}
+		}
+	}
+	return location{}, false
+}
+
+// end returns the location at the end of the block of parent, or of the main config if parent is nil.
+func (e *editor) end(parent *Directive) (location, error) {
+	if parent == nil {
+		if e.payload == nil {
+			return location{config: -1, block: e.root, index: len(*e.root)}, nil
+		}
+		if len(e.payload.Config) == 0 {
+			return location{}, ErrDirectiveNotFound
+		}
+		config := &e.payload.Config[0]
+		return location{block: &config.Parsed, index: len(config.Parsed), ctx: append(blockCtx{}, config.Context...)}, nil
+	}
+
+	loc, err := e.find(parent)
+	if err != nil {
+		return location{}, err
+	}
+	if !parent.IsBlock() {
+		return location{}, ErrNotBlock
+	}
+	return location{
+		config: loc.config,
+		block:  &parent.Block,
+		index:  len(parent.Block),
+		ctx:    enterBlockCtx(parent, loc.ctx, e.options.Contexts),
+	}, nil
+}
+
+func (e *editor) insert(target *Directive, ds Directives, offset int) error {
+	loc, err := e.find(target)
+	if err != nil {
+		return err
+	}
+	loc.index += offset
+	return e.place(loc, ds, target.Line)
+}
+
+func (e *editor) append(parent *Directive, ds Directives) error {
+	loc, err := e.end(parent)
+	if err != nil {
+		return err
+	}
+	return e.place(loc, ds, anchorLine(loc, parent))
+}
+
+func (e *editor) replace(target *Directive, with *Directive) error {
+	loc, err := e.find(target)
+	if err != nil {
+		return err
+	}
+	if err := e.check(e.file(loc.config), with, loc.ctx, nil); err != nil {
+		return err
+	}
+
+	before := e.reachable()
+	(*loc.block)[loc.index] = with
+	e.fixPlaced(loc, with, target.Line, false)
+	e.pruneIncludes(before)
+	return nil
+}
+
+func (e *editor) delete(target *Directive) error {
+	loc, err := e.find(target)
+	if err != nil {
+		return err
+	}
+
+	before := e.reachable()
+	*loc.block = append((*loc.block)[:loc.index], (*loc.block)[loc.index+1:]...)
+	e.pruneIncludes(before)
+	return nil
+}
+
+func (e *editor) move(target *Directive, parent *Directive) error {
+	from, err := e.find(target)
+	if err != nil {
+		return err
+	}
+	if parent != nil && (parent == target || inBlock(target.Block, parent)) {
+		return ErrMoveIntoSelf
+	}
+	to, err := e.end(parent)
+	if err != nil {
+		return err
+	}
+	if err := e.check(e.file(to.config), target, to.ctx, nil); err != nil {
+		return err
+	}
+
+	line := anchorLine(to, parent)
+	*from.block = append((*from.block)[:from.index], (*from.block)[from.index+1:]...)
+	to.index = len(*to.block)
+	*to.block = append(*to.block, target)
+	e.fixPlaced(to, target, line, from.config != to.config)
+	return nil
+}
+
+// place inserts new directives at a location after checking them.
+func (e *editor) place(loc location, ds Directives, line int) error {
+	for _, d := range ds {
+		if err := e.check(e.file(loc.config), d, loc.ctx, nil); err != nil {
+			return err
+		}
+	}
+
+	block := make(Directives, 0, len(*loc.block)+len(ds))
+	block = append(block, (*loc.block)[:loc.index]...)
+	block = append(block, ds...)
+	block = append(block, (*loc.block)[loc.index:]...)
+	*loc.block = block
+
+	for i, d := range ds {
+		e.fixPlaced(location{config: loc.config, block: loc.block, index: loc.index + i, ctx: loc.ctx}, d, line, false)
+	}
+	return nil
+}
+
+// anchorLine returns the line of the last directive before the end location, or of parent if there is none.
+func anchorLine(loc location, parent *Directive) int {
+	if loc.index > 0 {
+		return (*loc.block)[loc.index-1].Line
+	}
+	if parent != nil {
+		return parent.Line
+	}
+	return 1
+}
+
+// check runs the checks of the parser on a directive placed in the given block context,
+// on the directives in its block, and on the directives of the configs it includes.
+func (e *editor) check(fname string, d *Directive, ctx blockCtx, visiting []int) error {
+	if d.IsComment() {
+		return nil
+	}
+
+	term := ";"
+	if d.IsBlock() {
+		term = "{"
+	}
+	if len(ctx) > 0 {
+		if isMapBody(ctx.getLastBlock(), e.options) {
+			return analyzeMapBody(fname, d, term, ctx.getLastBlock(), e.options)
+		}
+	}
+
+	// the parser checks the arguments of an "if" before stripping its parentheses
+	stmt := d
+	if d.Directive == "if" && len(d.Args) > 0 {
+		args := append([]string{}, d.Args...)
+		args[0] = "(" + args[0]
+		args[len(args)-1] += ")"
+		stmt = &Directive{Directive: d.Directive, Line: d.Line, Args: args, Block: d.Block}
+	}
+	if err := analyze(fname, stmt, term, ctx, e.options); err != nil {
+		return err
+	}
+
+	if d.IsBlock() {
+		inner := enterBlockCtx(d, append(blockCtx{}, ctx...), e.options.Contexts)
+		for _, child := range d.Block {
+			if err := e.check(fname, child, inner, visiting); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.payload != nil && d.IsInclude() {
+		for _, idx := range d.Includes {
+			if idx < 0 || idx >= len(e.payload.Config) {
+				return &ParseError{
+					What:      fmt.Sprintf("include config with index: %d", idx),
+					File:      &fname,
+					Line:      &d.Line,
+					Statement: d.String(),
+					BlockCtx:  ctx.getLastBlock(),
+				}
+			}
+			if containsInt(visiting, idx) {
+				continue
+			}
+			included := &e.payload.Config[idx]
+			for _, child := range included.Parsed {
+				if err := e.check(included.File, child, ctx, append(visiting, idx)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fixPlaced fixes up the line, file and includes of a directive placed at a location,
+// moved is true if the directive was moved there from another config.
+func (e *editor) fixPlaced(loc location, d *Directive, line int, moved bool) {
+	useFile := d.File != ""
+	for i, sibling := range *loc.block {
+		if i != loc.index && sibling.File != "" {
+			useFile = true
+		}
+	}
+	fixLines(d, line, moved, e.file(loc.config), useFile)
+
+	if e.payload != nil {
+		e.fixIncludes(d, loc.ctx)
+	}
+}
+
+func fixLines(d *Directive, line int, moved bool, file string, useFile bool) {
+	if d.Line == 0 || moved {
+		d.Line = line
+	}
+	if useFile {
+		d.File = file
+	}
+	for _, child := range d.Block {
+		fixLines(child, d.Line, moved, file, useFile)
+	}
+}
+
+// fixIncludes makes the configs included by a directive placed in a block context match that context.
+// A config is re-targeted to the context if it is not included from anywhere else, otherwise it is
+// copied, the same way the parser parses a file once for each context it is included from.
+func (e *editor) fixIncludes(d *Directive, ctx blockCtx) {
+	if d.IsBlock() {
+		inner := enterBlockCtx(d, append(blockCtx{}, ctx...), e.options.Contexts)
+		for _, child := range d.Block {
+			e.fixIncludes(child, inner)
+		}
+	}
+	if !d.IsInclude() {
+		return
+	}
+
+	for i, idx := range d.Includes {
+		if idx < 0 || idx >= len(e.payload.Config) || equals(e.payload.Config[idx].Context, ctx) {
+			continue
+		}
+		if e.includeCount(idx) > 1 {
+			config := e.payload.Config[idx]
+			config.Parsed = cloneDirectives(config.Parsed)
+			e.payload.Config = append(e.payload.Config, config)
+			idx = len(e.payload.Config) - 1
+			d.Includes[i] = idx
+		}
+		config := &e.payload.Config[idx]
+		config.Context = append([]string{}, ctx...)
+		for _, child := range config.Parsed {
+			e.fixIncludes(child, ctx)
+		}
+	}
+}
+
+// includeCount returns the number of include directives that include the config at idx.
+func (e *editor) includeCount(idx int) int {
+	n := 0
+	e.payload.Inspect(func(d *Directive, _ *WalkContext) bool {
+		if d.IsInclude() && containsInt(d.Includes, idx) {
+			n++
+		}
+		return true
+	}, false)
+	return n
+}
+
+// reachable returns the indexes of the configs that are the main config or included from it.
+func (e *editor) reachable() map[int]bool {
+	reached := map[int]bool{}
+	if e.payload == nil || len(e.payload.Config) == 0 {
+		return reached
+	}
+	reached[0] = true
+	e.payload.Inspect(func(d *Directive, _ *WalkContext) bool {
+		for _, idx := range d.Includes {
+			reached[idx] = true
+		}
+		return true
+	}, true)
+	return reached
+}
+
+// pruneIncludes removes the configs that were reachable before an edit but are not anymore,
+// and updates the include indexes of the remaining configs.
+func (e *editor) pruneIncludes(before map[int]bool) {
+	if e.payload == nil {
+		return
+	}
+	after := e.reachable()
+
+	indexes := make(map[int]int, len(e.payload.Config))
+	configs := make([]Config, 0, len(e.payload.Config))
+	for i, config := range e.payload.Config {
+		if before[i] && !after[i] {
+			continue
+		}
+		indexes[i] = len(configs)
+		configs = append(configs, config)
+	}
+	if len(configs) == len(e.payload.Config) {
+		return
+	}
+
+	e.payload.Config = configs
+	e.payload.Inspect(func(d *Directive, _ *WalkContext) bool {
+		if len(d.Includes) == 0 {
+			return true
+		}
+		includes := make([]int, 0, len(d.Includes))
+		for _, idx := range d.Includes {
+			if n, ok := indexes[idx]; ok {
+				includes = append(includes, n)
+			}
+		}
+		d.Includes = includes
+		return true
+	}, false)
+}
+
+// inBlock returns true if d is in the block or in any of its nested blocks.
+func inBlock(block Directives, d *Directive) bool {
+	for _, child := range block {
+		if child == d || inBlock(child.Block, d) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneDirectives(block Directives) Directives {
+	if block == nil {
+		return nil
+	}
+	cloned := make(Directives, 0, len(block))
+	for _, d := range block {
+		c := *d
+		c.Args = append([]string{}, d.Args...)
+		if d.Includes != nil {
+			c.Includes = append([]int{}, d.Includes...)
+		}
+		c.Block = cloneDirectives(d.Block)
+		cloned = append(cloned, &c)
+	}
+	return cloned
+}
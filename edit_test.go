@@ -0,0 +1,247 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func names(block Directives) []string {
+	var ns []string
+	for _, d := range block {
+		ns = append(ns, d.Directive)
+	}
+	return ns
+}
+
+//nolint:funlen
+func TestDirectives_edits(t *testing.T) {
+	t.Parallel()
+	newTree := func() Directives {
+		return Directives{
+			{Directive: "events", Line: 1, Args: []string{}, Block: Directives{}},
+			{Directive: "http", Line: 2, Args: []string{}, Block: Directives{
+				{Directive: "server", Line: 3, Args: []string{}, Block: Directives{
+					{Directive: "listen", Line: 4, Args: []string{"80"}},
+					{Directive: "location", Line: 5, Args: []string{"/"}, Block: Directives{
+						{Directive: "return", Line: 6, Args: []string{"200"}},
+					}},
+				}},
+			}},
+		}
+	}
+
+	testcases := map[string]struct {
+		edit     func(ds *Directives) error
+		expected []string
+		err      string
+	}{
+		"insert before": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.InsertBefore(server.Block[0], Directives{{Directive: "server_name", Args: []string{"a"}}}, nil)
+			},
+			expected: []string{"server_name", "listen", "location"},
+		},
+		"insert after": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.InsertAfter(server.Block[0], Directives{{Directive: "server_name", Args: []string{"a"}}}, nil)
+			},
+			expected: []string{"listen", "server_name", "location"},
+		},
+		"append": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Append(server, Directives{{Directive: "root", Args: []string{"/srv"}}}, nil)
+			},
+			expected: []string{"listen", "location", "root"},
+		},
+		"delete": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Delete(server.Block[1])
+			},
+			expected: []string{"listen"},
+		},
+		"replace": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Replace(server.Block[0], &Directive{Directive: "listen", Args: []string{"443", "ssl"}}, nil)
+			},
+			expected: []string{"listen", "location"},
+		},
+		"move": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Move(server.Block[1].Block[0], server, nil)
+			},
+			expected: []string{"listen", "location", "return"},
+		},
+		"not allowed here": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Append(server, Directives{{Directive: "worker_connections", Args: []string{"1"}}}, nil)
+			},
+			err: `"worker_connections" directive is not allowed here`,
+		},
+		"invalid number of arguments": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Replace(server.Block[0], &Directive{Directive: "listen", Args: []string{}}, nil)
+			},
+			err: `invalid number of arguments in "listen" directive`,
+		},
+		"children are checked": {
+			edit: func(ds *Directives) error {
+				return ds.Append((*ds)[1], Directives{{Directive: "server", Args: []string{}, Block: Directives{
+					{Directive: "events", Args: []string{}, Block: Directives{}},
+				}}}, nil)
+			},
+			err: `"events" directive is not allowed here`,
+		},
+		"if args are checked with parentheses": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Append(server, Directives{{Directive: "if", Args: []string{"$request_method", "=", "POST"}, Block: Directives{
+					{Directive: "return", Args: []string{"405"}},
+				}}}, nil)
+			},
+			expected: []string{"listen", "location", "if"},
+		},
+		"move into itself": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Move(server, server.Block[1], nil)
+			},
+			err: ErrMoveIntoSelf.Error(),
+		},
+		"not found": {
+			edit: func(ds *Directives) error {
+				return ds.Delete(&Directive{Directive: "listen"})
+			},
+			err: ErrDirectiveNotFound.Error(),
+		},
+		"not a block": {
+			edit: func(ds *Directives) error {
+				server := (*ds)[1].Block[0]
+				return ds.Append(server.Block[0], Directives{{Directive: "return", Args: []string{"200"}}}, nil)
+			},
+			err: ErrNotBlock.Error(),
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tree := newTree()
+			err := tc.edit(&tree)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				require.True(t, equalBlocks(newTree(), tree), "tree must not change on error")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, names(tree[1].Block[0].Block))
+		})
+	}
+}
+
+func TestDirectives_edits_lines(t *testing.T) {
+	t.Parallel()
+	tree := Directives{
+		{Directive: "http", Line: 1, Args: []string{}, Block: Directives{
+			{Directive: "server", Line: 2, Args: []string{}, Block: Directives{}},
+		}},
+	}
+	server := tree[0].Block[0]
+	require.NoError(t, tree.Append(server, Directives{{Directive: "listen", Args: []string{"80"}}}, nil))
+	require.Equal(t, 2, server.Block[0].Line)
+	require.NoError(t, tree.InsertAfter(server, Directives{{Directive: "gzip", Args: []string{"on"}}}, nil))
+	require.Equal(t, 2, tree[0].Block[1].Line)
+}
+
+func TestPayload_edits_includes(t *testing.T) {
+	t.Parallel()
+	path := getTestConfigPath("includes-regular", "nginx.conf")
+
+	t.Run("delete prunes included configs", func(t *testing.T) {
+		t.Parallel()
+		payload, err := Parse(path, &ParseOptions{})
+		require.NoError(t, err)
+		require.Len(t, payload.Config, 3)
+
+		// nginx.conf > server.conf > foo.conf, so removing the include of server.conf drops both
+		http := payload.Config[0].Parsed[1]
+		require.NoError(t, payload.Delete(http.Block[0]))
+		require.Len(t, payload.Config, 1)
+	})
+
+	t.Run("move include re-targets context", func(t *testing.T) {
+		t.Parallel()
+		payload, err := Parse(path, &ParseOptions{})
+		require.NoError(t, err)
+
+		// foo.conf has a location, which is allowed in a server but not in http
+		server := payload.Config[1].Parsed[0]
+		http := payload.Config[0].Parsed[1]
+		include := server.Block[2]
+		err = payload.Move(include, http, nil)
+		require.ErrorContains(t, err, `"location" directive is not allowed here`)
+
+		var perr *ParseError
+		require.True(t, errors.As(err, &perr))
+		require.Equal(t, "foo.conf", filepath.Base(*perr.File))
+
+		// a new server block in http is fine, and the line comes from the directive it follows
+		newServer := &Directive{Directive: "server", Args: []string{}, Block: Directives{}}
+		require.NoError(t, payload.Append(http, Directives{newServer}, nil))
+		require.Equal(t, 3, newServer.Line)
+		require.NoError(t, payload.Move(include, newServer, nil))
+		require.Equal(t, 3, include.Line)
+		require.Equal(t, []string{"http", "server"}, payload.Config[include.Includes[0]].Context)
+	})
+
+	t.Run("include shared by contexts is copied", func(t *testing.T) {
+		t.Parallel()
+		payload, err := Parse(path, &ParseOptions{})
+		require.NoError(t, err)
+
+		// include foo.conf a second time, from a location, so its own context changes
+		server := payload.Config[1].Parsed[0]
+		location := &Directive{Directive: "location", Args: []string{"/x"}, Block: Directives{}}
+		require.NoError(t, payload.Append(server, Directives{location}, nil))
+		include := &Directive{Directive: "include", Args: []string{"foo.conf"}, Includes: []int{2}}
+		require.NoError(t, payload.Append(location, Directives{include}, nil))
+
+		require.Len(t, payload.Config, 4)
+		require.Equal(t, []int{3}, include.Includes)
+		require.Equal(t, []string{"http", "server"}, payload.Config[2].Context)
+		require.Equal(t, []string{"http", "location"}, payload.Config[3].Context)
+		require.True(t, equalBlocks(payload.Config[2].Parsed, payload.Config[3].Parsed))
+		require.NotSame(t, payload.Config[2].Parsed[0], payload.Config[3].Parsed[0])
+
+		// deleting the location drops the copy again
+		require.NoError(t, payload.Delete(location))
+		require.Len(t, payload.Config, 3)
+	})
+
+	t.Run("invalid include index", func(t *testing.T) {
+		t.Parallel()
+		payload, err := Parse(path, &ParseOptions{})
+		require.NoError(t, err)
+		server := payload.Config[1].Parsed[0]
+		include := &Directive{Directive: "include", Args: []string{"nope.conf"}, Includes: []int{10}}
+		require.ErrorContains(t, payload.Append(server, Directives{include}, nil), "include config with index: 10")
+	})
+}
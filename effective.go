@@ -0,0 +1,221 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import "fmt"
+
+// EffectiveDirective is a directive in effect in a block and the level it was found at.
+type EffectiveDirective struct {
+	Directive *Directive
+	// Level is the block the directive is in, either the block it is in effect in or one
+	// of the blocks around it that it is inherited from.
+	Level *Directive
+	// Inherited is true if Level is not the block the directive is in effect in.
+	Inherited bool
+}
+
+// String returns the directive and the level it is in, like "add_header X-Frame-Options DENY (http)".
+func (e EffectiveDirective) String() string {
+	return fmt.Sprintf("%s (%s)", e.Directive, e.Level.Directive)
+}
+
+// EffectiveConfig holds the directives in effect in a block, following the inheritance rules of nginx.
+type EffectiveConfig struct {
+	// Block is the block the directives are in effect in.
+	Block *Directive
+	// Levels holds the blocks the directives are inherited through, from the outermost
+	// block, like http or stream, to Block.
+	Levels Directives
+	// Directives holds the directives in effect, ordered by level, outermost first,
+	// and by their order in the config within a level.
+	Directives []EffectiveDirective
+}
+
+// Lookup returns the directives in effect with the given name.
+func (e *EffectiveConfig) Lookup(name string) []EffectiveDirective {
+	var found []EffectiveDirective
+	for _, d := range e.Directives {
+		if d.Directive.Directive == name {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// Headers returns the add_header directives that add headers to responses with the given status code,
+// which are the ones with the "always" parameter for codes other than 200, 201, 204, 206, 301, 302,
+// 303, 304, 307 and 308.
+func (e *EffectiveConfig) Headers(status int) []EffectiveDirective {
+	var headers []EffectiveDirective
+	for _, d := range e.Lookup("add_header") {
+		if addsHeader(d.Directive, status) {
+			headers = append(headers, d)
+		}
+	}
+	return headers
+}
+
+func addsHeader(d *Directive, status int) bool {
+	switch status {
+	case 200, 201, 204, 206, 301, 302, 303, 304, 307, 308:
+		return true
+	}
+	return len(d.Args) > 2 && d.Args[2] == "always"
+}
+
+// Effective returns the directives in effect in a block of the payload, such as a server or a location
+// block, with the directives it inherits from the blocks around it. Directives of included configs are
+// treated as if they were in the block of the include directive.
+//
+// Like in nginx, a directive is inherited from the closest block around it that has it, unless
+// the block has it too. Array-like directives, such as add_header or proxy_set_header, are inherited
+// as a whole: a block that has one of them has none of the ones of the blocks around it. Some directives
+// share their array, like allow and deny. A directive named after an array-like directive with the
+// suffix "_inherit", like add_header_inherit, changes this for the directive: with "off", nothing is
+// inherited, and with "merge", the directives of the block are added to the inherited ones.
+//
+// Directives that only apply to the block they are in, like location, listen, server_name, the
+// handlers like proxy_pass and the directives of the rewrite module, are not inherited, and blocks
+// inside of the block are not in its effective directives.
+func (p *Payload) Effective(block *Directive) (*EffectiveConfig, error) {
+	if !block.IsBlock() {
+		return nil, fmt.Errorf("%w: %s", ErrNotBlock, block.Directive)
+	}
+
+	m, found := p.locate(block)
+	if !found {
+		return nil, ErrDirectiveNotFound
+	}
+
+	// the levels start at the outermost block with inheritance, like http or stream
+	e := &EffectiveConfig{Block: block}
+	for _, d := range m.Parents {
+		if len(e.Levels) > 0 || inheritanceRoots[d.Directive] {
+			e.Levels = append(e.Levels, d)
+		}
+	}
+	e.Levels = append(e.Levels, block)
+
+	children := make([]Directives, len(e.Levels))
+	for i, level := range e.Levels {
+		children[i] = p.children(level)
+	}
+
+	// levels in effect for each group of directives
+	last := len(e.Levels) - 1
+	groups := map[string][]int{}
+	for i := range e.Levels {
+		defined := map[string]bool{}
+		for _, d := range children[i] {
+			if g, ok := inheritanceGroup(d); ok {
+				defined[g] = true
+			}
+		}
+		for g := range defined {
+			switch {
+			case i < last && notInherited[g]:
+			case e.inheritMode(children, i, g) == "merge":
+				groups[g] = append(groups[g], i)
+			default:
+				groups[g] = []int{i}
+			}
+		}
+		// "off" stops the inheritance of a group even if the level does not have it
+		for g := range groups {
+			if !defined[g] && e.inheritMode(children, i, g) == "off" {
+				delete(groups, g)
+			}
+		}
+	}
+
+	for i, level := range e.Levels {
+		for _, d := range children[i] {
+			if g, ok := inheritanceGroup(d); ok && containsInt(groups[g], i) {
+				e.Directives = append(e.Directives, EffectiveDirective{Directive: d, Level: level, Inherited: i < last})
+			}
+		}
+	}
+	return e, nil
+}
+
+// inheritMode returns the value of the "_inherit" directive of a group in effect at level i.
+func (e *EffectiveConfig) inheritMode(children []Directives, i int, group string) string {
+	name := group + "_inherit"
+	for ; i >= 0; i-- {
+		mode := ""
+		for _, d := range children[i] {
+			if d.Directive == name && len(d.Args) == 1 {
+				mode = d.Args[0]
+			}
+		}
+		if mode != "" {
+			return mode
+		}
+	}
+	return "on"
+}
+
+// inheritanceGroup returns the name of the group of directives a directive is inherited with.
+// Comments and blocks other than types are not part of any group.
+func inheritanceGroup(d *Directive) (string, bool) {
+	if d.IsComment() || (d.IsBlock() && d.Directive != "types") {
+		return "", false
+	}
+	if g, ok := sharedArrays[d.Directive]; ok {
+		return g, true
+	}
+	return d.Directive, true
+}
+
+// inheritanceRoots are the blocks at which inheritance starts.
+//
+//nolint:gochecknoglobals
+var inheritanceRoots = map[string]bool{
+	"http":   true,
+	"stream": true,
+	"mail":   true,
+}
+
+// sharedArrays maps the directives that add to the array of another directive to that directive.
+//
+//nolint:gochecknoglobals
+var sharedArrays = map[string]string{
+	"deny": "allow",
+}
+
+// notInherited are the directives that only apply to the block they are in.
+//
+//nolint:gochecknoglobals
+var notInherited = map[string]bool{
+	"listen":      true,
+	"server_name": true,
+	"alias":       true,
+	"internal":    true,
+	"try_files":   true,
+	// handlers
+	"proxy_pass":     true,
+	"fastcgi_pass":   true,
+	"uwsgi_pass":     true,
+	"scgi_pass":      true,
+	"grpc_pass":      true,
+	"memcached_pass": true,
+	"pass":           true,
+	"empty_gif":      true,
+	"stub_status":    true,
+	"api":            true,
+	"health_check":   true,
+	"flv":            true,
+	"mp4":            true,
+	"js_content":     true,
+	"perl":           true,
+	// rewrite module
+	"return":  true,
+	"rewrite": true,
+	"set":     true,
+	"break":   true,
+}
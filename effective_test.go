@@ -0,0 +1,165 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload_Effective(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("effective", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	testcases := map[string]struct {
+		selector string
+		expected []string
+	}{
+		"http": {
+			selector: "http",
+			expected: []string{
+				"root /var/www (http)",
+				"client_max_body_size 1m (http)",
+				"add_header X-Frame-Options DENY (http)",
+				"add_header X-Content-Type-Options nosniff always (http)",
+				"proxy_set_header Host $host (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+			},
+		},
+		"server": {
+			selector: "server",
+			expected: []string{
+				"root /var/www (http)",
+				"proxy_set_header Host $host (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+				"listen 80 (server)",
+				"server_name example.com (server)",
+				"client_max_body_size 10m (server)",
+				"set $backend http://backend (server)",
+				"add_header X-Server yes (server)",
+			},
+		},
+		"location": {
+			selector: "location[0=/]",
+			expected: []string{
+				"root /var/www (http)",
+				"proxy_set_header Host $host (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+				"client_max_body_size 10m (server)",
+				"add_header X-Server yes (server)",
+				"proxy_pass $backend (location)",
+			},
+		},
+		"shared array": {
+			selector: "location[0=/nested/]",
+			expected: []string{
+				"root /var/www (http)",
+				"proxy_set_header Host $host (http)",
+				"client_max_body_size 10m (server)",
+				"add_header X-Server yes (server)",
+				"deny 10.1.0.0/16 (location)",
+			},
+		},
+		"merge": {
+			selector: "location[0=/merge/]",
+			expected: []string{
+				"root /var/www (http)",
+				"proxy_set_header Host $host (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+				"client_max_body_size 10m (server)",
+				"add_header X-Server yes (server)",
+				"add_header_inherit merge (location)",
+				"add_header X-Merge 1 (location)",
+			},
+		},
+		"off": {
+			selector: "location[0=/off/]",
+			expected: []string{
+				"root /var/www (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+				"client_max_body_size 10m (server)",
+				"add_header_inherit off (location)",
+				"proxy_set_header_inherit off (location)",
+			},
+		},
+		"off is inherited": {
+			selector: "location[0=/off/nested/]",
+			expected: []string{
+				"root /var/www (http)",
+				"allow 10.0.0.0/8 (http)",
+				"deny all (http)",
+				"client_max_body_size 10m (server)",
+				"add_header_inherit off (location)",
+				"proxy_set_header_inherit off (location)",
+				"add_header X-Nested 1 (location)",
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s, err := CompileSelector(tc.selector)
+			require.NoError(t, err)
+			matches := payload.Query(s, true)
+			require.Len(t, matches, 1)
+			block := matches[0].Directive
+
+			effective, err := payload.Effective(block)
+			require.NoError(t, err)
+			require.Equal(t, block, effective.Levels[len(effective.Levels)-1])
+
+			var got []string
+			for _, d := range effective.Directives {
+				got = append(got, d.String())
+				require.Equal(t, d.Level != block, d.Inherited)
+			}
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestEffectiveConfig_Headers(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("effective", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	effective, err := payload.Effective(payload.HTTP().Directive)
+	require.NoError(t, err)
+
+	headers := func(status int) []string {
+		var names []string
+		for _, d := range effective.Headers(status) {
+			names = append(names, d.Directive.Args[0])
+		}
+		return names
+	}
+	require.Equal(t, []string{"X-Frame-Options", "X-Content-Type-Options"}, headers(200))
+	require.Equal(t, []string{"X-Content-Type-Options"}, headers(404))
+	require.Len(t, effective.Lookup("root"), 1)
+}
+
+func TestPayload_Effective_errors(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("effective", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	_, err = payload.Effective(&Directive{Directive: "location", Args: []string{"/"}, Block: Directives{}})
+	require.ErrorIs(t, err, ErrDirectiveNotFound)
+
+	_, err = payload.Effective(&Directive{Directive: "root", Args: []string{"/"}})
+	require.ErrorIs(t, err, ErrNotBlock)
+}
@@ -9,13 +9,19 @@ package crossplane
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 )
 
 type ParseError struct {
 	What string
 	File *string
 	Line *int
+	// Column of the parse error in the line, starting at 1 (byte count).
+	Column *int
 	// Raw directive statement causing the parse error.
 	Statement string
 	// Block in which parse error occurred.
@@ -34,10 +40,128 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("%s in %s", e.What, file)
 }
 
+// MarshalJSON encodes the error as its message, like Python crossplane does.
 func (e *ParseError) MarshalJSON() ([]byte, error) {
 	return json.Marshal(e.Error())
 }
 
+// parseErrorJSON is the structured JSON form of a ParseError.
+type parseErrorJSON struct {
+	What      string  `json:"what"`
+	File      *string `json:"file,omitempty"`
+	Line      *int    `json:"line,omitempty"`
+	Column    *int    `json:"column,omitempty"`
+	Statement string  `json:"statement,omitempty"`
+	BlockCtx  string  `json:"block_ctx,omitempty"`
+}
+
+func (e *ParseError) toJSON() parseErrorJSON {
+	return parseErrorJSON{
+		What:      e.What,
+		File:      e.File,
+		Line:      e.Line,
+		Column:    e.Column,
+		Statement: e.Statement,
+		BlockCtx:  e.BlockCtx,
+	}
+}
+
+// UnmarshalJSON decodes the structured JSON form of the error that is written next to its message
+// in payloads parsed with ParseOptions.StructuredErrors, or the message itself, in which case only
+// its file and line can be recovered.
+func (e *ParseError) UnmarshalJSON(b []byte) error {
+	var msg string
+	if err := json.Unmarshal(b, &msg); err == nil {
+		*e = *parseErrorMessage(msg)
+		return nil
+	}
+
+	var pe parseErrorJSON
+	if err := json.Unmarshal(b, &pe); err != nil {
+		return err
+	}
+	*e = *pe.toParseError()
+	return nil
+}
+
+func (pe *parseErrorJSON) toParseError() *ParseError {
+	return &ParseError{
+		What:      pe.What,
+		File:      pe.File,
+		Line:      pe.Line,
+		Column:    pe.Column,
+		Statement: pe.Statement,
+		BlockCtx:  pe.BlockCtx,
+	}
+}
+
+// parseErrorMessage parses the message of a ParseError, the reverse of its Error method.
+func parseErrorMessage(msg string) *ParseError {
+	i := strings.LastIndex(msg, " in ")
+	if i < 0 {
+		return &ParseError{What: msg}
+	}
+	e := &ParseError{What: msg[:i]}
+	file := msg[i+len(" in "):]
+	if j := strings.LastIndexByte(file, ':'); j >= 0 {
+		if line, err := strconv.Atoi(file[j+1:]); err == nil {
+			e.Line = &line
+			file = file[:j]
+		}
+	}
+	if file != "(nofile)" {
+		e.File = &file
+	}
+	return e
+}
+
 func (e *ParseError) Unwrap() error {
 	return e.originalErr
 }
+
+//nolint:gochecknoglobals
+var (
+	ErrMaxFileSize      = errors.New("file size limit exceeded")
+	ErrMaxTokenLength   = errors.New("token length limit exceeded")
+	ErrMaxNestingDepth  = errors.New("nesting depth limit exceeded")
+	ErrMaxIncludedFiles = errors.New("included files limit exceeded")
+	ErrMaxDirectives    = errors.New("directives limit exceeded")
+)
+
+// LimitError is the error for a config that exceeds one of the limits of ParseOptions.
+// Err is one of the ErrMax* errors, so errors.Is can tell which limit was exceeded.
+type LimitError struct {
+	Err   error
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s (limit is %d)", e.Err, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// limitReader reads from r until more than limit bytes are read, at which point
+// it returns a *LimitError.
+type limitReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	// read one byte more than remaining to find out if the limit is exceeded
+	if int64(len(b)) > l.remaining+1 {
+		b = b[:l.remaining+1]
+	}
+	n, err := l.r.Read(b)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		return n, &LimitError{Err: ErrMaxFileSize, Limit: l.limit}
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
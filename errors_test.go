@@ -8,9 +8,11 @@
 package crossplane
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestErrorString(t *testing.T) {
@@ -40,3 +42,46 @@ func TestErrorString(t *testing.T) {
 		assert.Equal(t, tc.exp, e.Error())
 	}
 }
+
+func TestParseError_JSON(t *testing.T) {
+	t.Parallel()
+	file := "nginx.conf"
+	line := 3
+	column := 5
+
+	tcs := map[string]struct {
+		json     string
+		expected *ParseError
+	}{
+		"message": {
+			json:     `"\"listen\" directive is not allowed here in nginx.conf:3"`,
+			expected: &ParseError{What: `"listen" directive is not allowed here`, File: &file, Line: &line},
+		},
+		"message without line": {
+			json:     `"unexpected end of file in nginx.conf"`,
+			expected: &ParseError{What: "unexpected end of file", File: &file},
+		},
+		"structured": {
+			json: `{"what":"invalid number of arguments in \"listen\" directive","file":"nginx.conf",` +
+				`"line":3,"column":5,"statement":"listen","block_ctx":"server"}`,
+			expected: &ParseError{
+				What:      `invalid number of arguments in "listen" directive`,
+				File:      &file,
+				Line:      &line,
+				Column:    &column,
+				Statement: "listen",
+				BlockCtx:  "server",
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var e ParseError
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &e))
+			require.Equal(t, tc.expected, &e)
+		})
+	}
+}
@@ -9,9 +9,11 @@ package crossplane
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type NgxToken struct {
@@ -19,6 +21,8 @@ type NgxToken struct {
 	Line     int
 	IsQuoted bool
 	Error    error
+	// Range is the location of the token in the source, including the quotes of a quoted token.
+	Range Range
 }
 
 type state int
@@ -37,192 +41,603 @@ const TokenChanCap = 2048
 var lexerFile = "lexer" // pseudo file name for use by parse errors
 
 //nolint:gochecknoglobals
-var tokChanCap = TokenChanCap // capacity of lexer token channel
+var tokChanCap = TokenChanCap // capacity of the channel returned by Lex
 
 // note: this is only used during tests, should not be changed
 func SetTokenChanCap(size int) {
 	tokChanCap = size
 }
+
+// SubScanner provides an interface for scanning alternative grammars within NGINX configuration data.
+// It is handed to an external Lexer positioned right after the directive that the Lexer was registered for.
+type SubScanner struct {
+	t          *Tokenizer
+	pending    string
+	pendingPos Position
+	text       string
+	pos        Position
+	end        Position
+}
+
+// Scan advances the scanner to the next rune, which will then be available through the Text method.
+// It returns false when the scan stops by reaching the end of the input.
+func (e *SubScanner) Scan() bool {
+	if e.pending != "" {
+		e.text, e.pending = e.pending, ""
+		e.pos = e.pendingPos
+		e.end = e.pos.advance(e.text)
+		return true
+	}
+	r, size, ok := e.t.readRune()
+	if !ok {
+		return false
+	}
+	e.text = string(r)
+	e.t.pos.advance(r, size)
+	e.pos, e.end = e.t.pos.start, e.t.pos.end
+	if r == '\n' {
+		e.t.tokenLine++
+	}
+	return true
+}
+
+// Err returns the first non-EOF error that was encountered by the SubScanner.
+func (e *SubScanner) Err() error { return e.t.err }
+
+// Text returns the most recent rune generated by a call to Scan.
+func (e *SubScanner) Text() string { return e.text }
+
+// Line returns the line number of the most recent rune generated by a call to Scan.
+func (e *SubScanner) Line() int { return e.t.tokenLine }
+
+// Pos returns the position of the most recent rune generated by a call to Scan.
+func (e *SubScanner) Pos() Position { return e.pos }
+
+// EndPos returns the position right after the most recent rune generated by a call to Scan.
+func (e *SubScanner) EndPos() Position { return e.end }
+
+// cursor tracks the position of the runes read by the lexer.
+type cursor struct {
+	start Position // position of the most recently read rune
+	end   Position // position right after the most recently read rune
+}
+
+func newCursor() cursor {
+	return cursor{end: Position{Line: 1, Column: 1}}
+}
+
+// advance moves the cursor past a rune that is size bytes long in the source.
+func (c *cursor) advance(r rune, size int) {
+	c.start = c.end
+	c.end.Offset += size
+	if r == '\n' {
+		c.end.Line++
+		c.end.Column = 1
+	} else {
+		c.end.Column += size
+	}
+}
+
+// Lexer is an interface for implementing lexers that handle external NGINX tokens during the lexical scan.
+// When the main lexer emits a directive name that a Lexer is registered for, the rest of the directive is
+// read from the SubScanner by the Lexer, which must emit every remaining token of the directive, including
+// the terminating ";". The tokens are sent on a channel, which takes a goroutine, so implementing
+// TokenLexer instead is preferred.
+type Lexer interface {
+	Lex(s *SubScanner, matchedToken string) <-chan NgxToken
+}
+
+// TokenLexer is like Lexer, but the tokens of the directive are pulled one at a time from the TokenReader
+// it returns, so that they are read without a goroutine or a channel.
+type TokenLexer interface {
+	LexTokens(s *SubScanner, matchedToken string) TokenReader
+}
+
+// TokenReader reads tokens one at a time. Next returns io.EOF after the last token. A token that cannot
+// be read is returned with its Error field set to the error that is returned with it, and ends the
+// tokenization. A Tokenizer is a TokenReader.
+type TokenReader interface {
+	Next() (NgxToken, error)
+}
+
+// channelLexer adapts a Lexer to a TokenLexer.
+type channelLexer struct {
+	l Lexer
+}
+
+func (c channelLexer) LexTokens(s *SubScanner, matchedToken string) TokenReader {
+	return channelReader(c.l.Lex(s, matchedToken))
+}
+
+type channelReader <-chan NgxToken
+
+func (r channelReader) Next() (NgxToken, error) {
+	token, ok := <-r
+	if !ok {
+		return NgxToken{}, io.EOF
+	}
+	return token, token.Error
+}
+
+// Close discards the tokens left so that the Lexer is not blocked on sending them.
+func (r channelReader) Close() error {
+	for range r { //nolint:revive
+	}
+	return nil
+}
+
+// tokenSlice is a TokenReader of tokens that have already been lexed.
+type tokenSlice []NgxToken
+
+func (s *tokenSlice) Next() (NgxToken, error) {
+	if len(*s) == 0 {
+		return NgxToken{}, io.EOF
+	}
+	token := (*s)[0]
+	*s = (*s)[1:]
+	return token, token.Error
+}
+
+// RegisterLexer is an option that can be used to add a lexer to tokenize external NGINX tokens.
+type RegisterLexer interface {
+	applyLexOptions(options *LexOptions)
+}
+
+type registerLexer struct {
+	l            TokenLexer
+	stringTokens []string
+}
+
+func (rl registerLexer) applyLexOptions(o *LexOptions) {
+	if o.extLexers == nil {
+		o.extLexers = make(map[string]TokenLexer)
+	}
+
+	for _, s := range rl.stringTokens {
+		o.extLexers[s] = rl.l
+	}
+}
+
+// LexWithLexer registers a Lexer that implements tokenization of an NGINX configuration after one of the given
+// stringTokens is encountered by the main lexer in the position of a directive name.
+func LexWithLexer(l Lexer, stringTokens ...string) RegisterLexer {
+	return registerLexer{l: channelLexer{l: l}, stringTokens: stringTokens}
+}
+
+// LexWithTokenLexer is like LexWithLexer, for a TokenLexer.
+func LexWithTokenLexer(l TokenLexer, stringTokens ...string) RegisterLexer {
+	return registerLexer{l: l, stringTokens: stringTokens}
+}
+
+// LexOptions allows customization of the lexing process by specifying external lexers
+// for specific directives.
+type LexOptions struct {
+	Lexers    []RegisterLexer
+	extLexers map[string]TokenLexer
+
+	// maximum length of a token, set by the parser from ParseOptions.MaxTokenLength
+	maxTokenLength int
+}
+
+// Lex tokenizes an NGINX configuration in a goroutine and sends the tokens on the returned channel,
+// which is closed after the last token or a token with an error. Use a Tokenizer to read the tokens
+// synchronously instead.
 func Lex(reader io.Reader) chan NgxToken {
+	return LexWithOptions(reader, LexOptions{})
+}
+
+// LexWithOptions is like Lex, but hands the tokenization of the directives registered
+// in options over to their external lexers.
+func LexWithOptions(reader io.Reader, options LexOptions) chan NgxToken {
 	tc := make(chan NgxToken, tokChanCap)
-	go tokenize(reader, tc)
+	go func() {
+		defer close(tc)
+		t := NewTokenizer(reader, options)
+		for {
+			token, err := t.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			tc <- token
+			if err != nil {
+				return
+			}
+		}
+	}()
 	return tc
 }
 
-//nolint:gocyclo,funlen,gocognit
-func tokenize(reader io.Reader, tokenCh chan NgxToken) {
-	token := strings.Builder{}
-	tokenLine := 1
-	tokenStartLine := 1
+// Tokenizer reads the tokens of an NGINX configuration one at a time, as they are requested
+// with Next. Unlike Lex, it does not need a goroutine or a channel.
+type Tokenizer struct {
+	// the source is either data or rd
+	data []byte
+	off  int
+	rd   *bufio.Reader
+	err  error // error reading rd, other than io.EOF
+
+	options LexOptions
+
+	// tokens lexed but not yet returned by Next
+	queue []NgxToken
+	head  int
+	done  bool
+
+	// external lexer handling the current directive
+	ext        TokenReader
+	extLexer   TokenLexer
+	extMatched string
+	extSub     *SubScanner
+
+	token                []byte
+	state                state
+	pos                  cursor
+	start                Position // position of the current rune, or of its escaping backslash
+	escStart             Position
+	tokenStart           Position
+	tokenLine            int
+	tokenStartLine       int
+	quote                rune
+	depth                int
+	esc                  bool
+	newToken             bool
+	dupSpecialChar       bool
+	nextTokenIsDirective bool
+}
 
-	lexState := skipSpace
-	newToken := false
-	dupSpecialChar := false
-	readNext := true
-	esc := false
-	depth := 0
-	var la, quote string
+// NewTokenizer returns a Tokenizer that reads a configuration from r, which is buffered
+// unless it is a *bufio.Reader already.
+func NewTokenizer(r io.Reader, options LexOptions) *Tokenizer {
+	t := newTokenizer(options)
+	t.rd = bufio.NewReader(r)
+	return t
+}
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanRunes)
+// NewTokenizerBytes returns a Tokenizer that reads a configuration from data.
+func NewTokenizerBytes(data []byte, options LexOptions) *Tokenizer {
+	t := newTokenizer(options)
+	t.data = data
+	return t
+}
 
-	emit := func(line int, quoted bool, err error) {
-		tokenCh <- NgxToken{Value: token.String(), Line: line, IsQuoted: quoted, Error: err}
-		token.Reset()
-		lexState = skipSpace
+func newTokenizer(options LexOptions) *Tokenizer {
+	for _, rl := range options.Lexers {
+		rl.applyLexOptions(&options)
+	}
+	return &Tokenizer{
+		options:              options,
+		pos:                  newCursor(),
+		tokenLine:            1,
+		tokenStartLine:       1,
+		nextTokenIsDirective: true,
 	}
+}
 
+// Next returns the next token of the configuration. It returns io.EOF once all of the tokens have
+// been read. When the configuration cannot be tokenized, the token returned with the error has its
+// Error field set to it as well, and the following calls return io.EOF.
+func (t *Tokenizer) Next() (NgxToken, error) {
 	for {
-		if readNext {
-			if !scanner.Scan() {
-				break // done
+		if t.head < len(t.queue) {
+			token := t.queue[t.head]
+			t.head++
+			if t.head == len(t.queue) {
+				t.queue, t.head = t.queue[:0], 0
 			}
+			return token, token.Error
+		}
 
-			la = scanner.Text()
-			if isEOL(la) {
-				tokenLine++
+		if t.extLexer != nil {
+			t.ext = t.extLexer.LexTokens(t.extSub, t.extMatched)
+			t.extLexer, t.extSub = nil, nil
+		}
+		if t.ext != nil {
+			token, err := t.ext.Next()
+			if errors.Is(err, io.EOF) {
+				t.ext = nil
+				t.dupSpecialChar = true
+				t.nextTokenIsDirective = true
+				continue
+			}
+			if err != nil && token.Error == nil {
+				token.Error = err
+			}
+			if max := t.options.maxTokenLength; token.Error == nil && max > 0 && len(token.Value) > max {
+				token.Error = &LimitError{Err: ErrMaxTokenLength, Limit: int64(max)}
 			}
-		} else {
-			readNext = true
+			if token.Error != nil {
+				t.stop()
+			}
+			return token, token.Error
+		}
+
+		if t.done {
+			return NgxToken{}, io.EOF
+		}
+		t.scan()
+	}
+}
+
+// stop ends the tokenization, the external lexer of the current directive is closed
+// if it can be, so that a Lexer is not blocked on sending the tokens left.
+func (t *Tokenizer) stop() {
+	t.done = true
+	t.queue, t.head = t.queue[:0], 0
+	t.extLexer, t.extSub = nil, nil
+	if c, ok := t.ext.(io.Closer); ok {
+		_ = c.Close()
+	}
+	t.ext = nil
+}
+
+// readRune reads the next rune of the source and its size in bytes. Invalid UTF-8 is read
+// as utf8.RuneError, one byte at a time.
+func (t *Tokenizer) readRune() (rune, int, bool) {
+	if t.rd == nil {
+		if t.off >= len(t.data) {
+			return 0, 0, false
+		}
+		r, size := rune(t.data[t.off]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(t.data[t.off:])
+		}
+		t.off += size
+		return r, size, true
+	}
+
+	if t.err != nil {
+		return 0, 0, false
+	}
+	r, size, err := t.rd.ReadRune()
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			t.err = err
+		}
+		return 0, 0, false
+	}
+	return r, size, true
+}
+
+func (t *Tokenizer) emit(line int, quoted bool, end Position, err error) {
+	t.queue = append(t.queue, NgxToken{
+		Value:    string(t.token),
+		Line:     line,
+		IsQuoted: quoted,
+		Error:    err,
+		Range:    Range{Start: t.tokenStart, End: end},
+	})
+	t.token = t.token[:0]
+	t.state = skipSpace
+}
+
+// fail emits the current token with an error, which ends the tokenization.
+func (t *Tokenizer) fail(line int, end Position, err error) {
+	t.emit(line, false, end, err)
+	t.done = true
+}
+
+// lexErr creates an error located at the current rune.
+func (t *Tokenizer) lexErr(what string) error {
+	line, col := t.tokenLine, t.start.Column
+	t.tokenStart = t.start
+	return &ParseError{File: &lexerFile, What: what, Line: &line, Column: &col}
+}
+
+// externalLex hands the scan over to an external lexer if the token about to be emitted is a directive
+// registered by one. The lookahead that terminated the token, if any, is passed on to the external lexer.
+func (t *Tokenizer) externalLex(lookahead string, end Position) bool {
+	if !t.nextTokenIsDirective || len(t.options.extLexers) == 0 {
+		return false
+	}
+	ext, found := t.options.extLexers[string(t.token)]
+	if !found {
+		return false
+	}
+	t.extLexer = ext
+	t.extMatched = string(t.token)
+	t.emit(t.tokenStartLine, t.state == inQuote, end, nil)
+	t.extSub = &SubScanner{t: t, pending: lookahead, pendingPos: t.start}
+	return true
+}
+
+// scan reads runes until at least one token is emitted or the end of the source is reached.
+func (t *Tokenizer) scan() {
+	for t.head == len(t.queue) && !t.done && t.extLexer == nil {
+		r, size, ok := t.readRune()
+		if !ok {
+			t.end()
+			return
+		}
+		t.pos.advance(r, size)
+		t.start = t.pos.start
+		if r == '\n' {
+			t.tokenLine++
+		}
+
+		if max := t.options.maxTokenLength; max > 0 && len(t.token) > max {
+			t.fail(t.tokenStartLine, t.start, &LimitError{Err: ErrMaxTokenLength, Limit: int64(max)})
+			return
 		}
 
 		// skip CRs
-		if la == "\r" || la == "\\\r" {
+		if r == '\r' {
 			continue
 		}
 
-		if la == "\\" && !esc {
-			esc = true
+		if r == '\\' && !t.esc {
+			t.esc = true
+			t.escStart = t.start
 			continue
 		}
-		if esc {
-			esc = false
-			la = "\\" + la
+		escaped := t.esc
+		if escaped {
+			t.esc = false
+			t.start = t.escStart
 		}
+		t.lex(r, escaped)
+	}
+}
 
-		switch lexState {
-		case skipSpace:
-			if !isSpace(la) {
-				lexState = inWord
-				newToken = true
-				readNext = false // re-eval
-				tokenStartLine = tokenLine
-			}
-			continue
-		case inWord:
-			if newToken {
-				newToken = false
-				if la == "#" {
-					token.WriteString(la)
-					lexState = inComment
-					tokenStartLine = tokenLine
-					continue
-				}
-			}
+// end emits the tokens left at the end of the source.
+func (t *Tokenizer) end() {
+	// errors reading the input, like an exceeded file size limit, end the lexing
+	if t.err != nil {
+		t.fail(t.tokenLine, t.pos.end, t.err)
+		return
+	}
 
-			if isSpace(la) {
-				emit(tokenStartLine, false, nil)
-				continue
-			}
+	if len(t.token) > 0 {
+		t.emit(t.tokenStartLine, t.state == inQuote, t.pos.end, nil)
+	}
+	if t.depth > 0 {
+		t.start = t.pos.end
+		t.fail(t.tokenStartLine, t.pos.end, t.lexErr(`unexpected end of file, expecting "}"`))
+	}
+	t.done = true
+}
 
-			// handle parameter expansion syntax (ex: "${var[@]}")
-			if token.Len() > 0 && strings.HasSuffix(token.String(), "$") && la == "{" {
-				token.WriteString(la)
-				lexState = inVar
-				dupSpecialChar = false
-				continue
+// write adds a rune to the current token, with the backslash escaping it.
+func (t *Tokenizer) write(r rune, escaped bool) {
+	if escaped {
+		t.token = append(t.token, '\\')
+	}
+	t.token = utf8.AppendRune(t.token, r)
+}
+
+// lex handles a rune according to the state of the tokenizer.
+//
+//nolint:gocyclo,funlen,gocognit
+func (t *Tokenizer) lex(r rune, escaped bool) {
+	// c is compared against the characters with a special meaning, which they lose when escaped
+	c := r
+	if escaped {
+		c = 0
+	}
+	space := unicode.IsSpace(c)
+
+	switch t.state {
+	case skipSpace:
+		if space {
+			return
+		}
+		t.state = inWord
+		t.newToken = true
+		t.tokenStartLine = t.tokenLine
+		t.tokenStart = t.start
+		// re-evaluate the rune as the start of a word
+		t.lex(r, escaped)
+
+	case inWord:
+		if t.newToken {
+			t.newToken = false
+			if c == '#' {
+				t.write(r, escaped)
+				t.state = inComment
+				t.tokenStartLine = t.tokenLine
+				return
 			}
+		}
 
-			// if a quote is found, add the whole string to the token buffer
-			if la == `"` || la == "'" {
-				if token.Len() > 0 {
-					// if a quote is inside a token, treat it like any other char
-					token.WriteString(la)
-				} else {
-					// swallow quote and change state
-					quote = la
-					lexState = inQuote
-					tokenStartLine = tokenLine
-				}
-				dupSpecialChar = false
-				continue
+		if space {
+			if t.externalLex("", t.start) {
+				return
 			}
+			t.nextTokenIsDirective = false
+			t.emit(t.tokenStartLine, false, t.start, nil)
+			return
+		}
 
-			// handle special characters that are treated like full tokens
-			if la == "{" || la == "}" || la == ";" {
-				// if token complete yield it and reset token buffer
-				if token.Len() > 0 {
-					emit(tokenStartLine, false, nil)
-				}
+		// handle parameter expansion syntax (ex: "${var[@]}")
+		if c == '{' && len(t.token) > 0 && t.token[len(t.token)-1] == '$' {
+			t.write(r, escaped)
+			t.state = inVar
+			t.dupSpecialChar = false
+			return
+		}
+
+		// if a quote is found, add the whole string to the token buffer
+		if c == '"' || c == '\'' {
+			if len(t.token) > 0 {
+				// if a quote is inside a token, treat it like any other char
+				t.write(r, escaped)
+			} else {
+				// swallow quote and change state
+				t.quote = c
+				t.state = inQuote
+				t.tokenStartLine = t.tokenLine
+			}
+			t.dupSpecialChar = false
+			return
+		}
 
-				// only '}' can be repeated
-				if dupSpecialChar && la != "}" {
-					emit(tokenStartLine, false, &ParseError{
-						File: &lexerFile,
-						What: fmt.Sprintf(`unexpected "%s"`, la),
-						Line: &tokenLine,
-					})
-					close(tokenCh)
+		// handle special characters that are treated like full tokens
+		if c == '{' || c == '}' || c == ';' {
+			// if token complete yield it and reset token buffer
+			if len(t.token) > 0 {
+				if t.externalLex(string(c), t.start) {
 					return
 				}
+				t.emit(t.tokenStartLine, false, t.start, nil)
+			}
+			t.tokenStart = t.start
 
-				dupSpecialChar = true
+			// only '}' can be repeated
+			if t.dupSpecialChar && c != '}' {
+				t.fail(t.tokenStartLine, t.start, t.lexErr(fmt.Sprintf(`unexpected "%c"`, c)))
+				return
+			}
 
-				if la == "{" {
-					depth++
-				}
-				if la == "}" {
-					depth--
-					// early exit if unbalanced braces
-					if depth < 0 {
-						emit(tokenStartLine, false, &ParseError{File: &lexerFile, What: `unexpected "}"`, Line: &tokenLine})
-						close(tokenCh)
-						return
-					}
-				}
+			t.dupSpecialChar = true
 
-				token.WriteString(la)
-				// this character is a full token so emit it
-				emit(tokenStartLine, false, nil)
-				continue
+			if c == '{' {
+				t.depth++
+			}
+			if c == '}' {
+				t.depth--
+				// early exit if unbalanced braces
+				if t.depth < 0 {
+					t.fail(t.tokenStartLine, t.start, t.lexErr(`unexpected "}"`))
+					return
+				}
 			}
 
-			dupSpecialChar = false
-			token.WriteString(la)
+			t.write(r, escaped)
+			// this character is a full token so emit it
+			t.emit(t.tokenStartLine, false, t.pos.end, nil)
+			t.nextTokenIsDirective = true
+			return
+		}
 
-		case inComment:
-			if isEOL(la) {
-				emit(tokenStartLine, false, nil)
-				continue
-			}
-			token.WriteString(la)
+		t.dupSpecialChar = false
+		t.write(r, escaped)
 
-		case inVar:
-			token.WriteString(la)
-			// this is using the same logic as the exiting lexer, but this is wrong since it does not terminate on token boundary
-			if !strings.HasSuffix(token.String(), "}") && !isSpace(la) {
-				continue
-			}
-			lexState = inWord
+	case inComment:
+		if r == '\n' {
+			t.emit(t.tokenStartLine, false, t.start, nil)
+			return
+		}
+		t.write(r, escaped)
 
-		case inQuote:
-			if la == quote {
-				emit(tokenStartLine, true, nil)
-				continue
-			}
-			if la == "\\"+quote {
-				la = quote
-			}
-			token.WriteString(la)
+	case inVar:
+		t.write(r, escaped)
+		// this is using the same logic as the exiting lexer, but this is wrong since it does not terminate on token boundary
+		if r != '}' && !space {
+			return
 		}
-	}
+		t.state = inWord
 
-	if token.Len() > 0 {
-		emit(tokenStartLine, lexState == inQuote, nil)
-	}
-	if depth > 0 {
-		emit(tokenStartLine, false, &ParseError{File: &lexerFile, What: `unexpected end of file, expecting "}"`, Line: &tokenLine})
+	case inQuote:
+		if c == t.quote {
+			if t.externalLex("", t.pos.end) {
+				return
+			}
+			t.nextTokenIsDirective = false
+			t.emit(t.tokenStartLine, true, t.pos.end, nil)
+			return
+		}
+		if escaped && r == t.quote {
+			escaped = false
+		}
+		t.write(r, escaped)
 	}
-
-	close(tokenCh)
 }
@@ -8,6 +8,9 @@
 package crossplane
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -313,3 +316,166 @@ func TestLex_unhappy(t *testing.T) {
 		})
 	}
 }
+
+func TestLex_ranges(t *testing.T) {
+	t.Parallel()
+
+	config := "http {\n  # héllo\n  return 200 \"a b\" \\;x;\n}"
+	expected := []struct {
+		value string
+		start Position
+		end   Position
+	}{
+		{"http", Position{1, 1, 0}, Position{1, 5, 4}},
+		{"{", Position{1, 6, 5}, Position{1, 7, 6}},
+		{"# héllo", Position{2, 3, 9}, Position{2, 11, 17}},
+		{"return", Position{3, 3, 20}, Position{3, 9, 26}},
+		{"200", Position{3, 10, 27}, Position{3, 13, 30}},
+		{"a b", Position{3, 14, 31}, Position{3, 19, 36}},
+		{"\\;x", Position{3, 20, 37}, Position{3, 23, 40}},
+		{";", Position{3, 23, 40}, Position{3, 24, 41}},
+		{"}", Position{4, 1, 42}, Position{4, 2, 43}},
+	}
+
+	i := 0
+	for token := range Lex(strings.NewReader(config)) {
+		if token.Error != nil {
+			t.Fatal(token.Error)
+		}
+		want := expected[i]
+		if token.Value != want.value || token.Range.Start != want.start || token.Range.End != want.end {
+			t.Fatalf("expected (%q,%v,%v) but got (%q,%v,%v)",
+				want.value, want.start, want.end, token.Value, token.Range.Start, token.Range.End)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Fatalf("expected %d tokens but got %d", len(expected), i)
+	}
+}
+
+func TestLex_errorColumn(t *testing.T) {
+	t.Parallel()
+
+	var err error
+	for token := range Lex(strings.NewReader("server {\n  listen 80;; }")) {
+		if token.Error != nil {
+			err = token.Error
+			break
+		}
+	}
+
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *ParseError but got %v", err)
+	}
+	if perr.Line == nil || *perr.Line != 2 || perr.Column == nil || *perr.Column != 13 {
+		t.Fatalf("expected error at 2:13 but got %v:%v", perr.Line, perr.Column)
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	t.Parallel()
+	for _, fixture := range lexFixtures {
+		fixture := fixture
+		t.Run(fixture.name, func(t *testing.T) {
+			t.Parallel()
+			path := getTestConfigPath(fixture.name, "nginx.conf")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokenizers := map[string]*Tokenizer{
+				"bytes":  NewTokenizerBytes(data, LexOptions{}),
+				"reader": NewTokenizer(bytes.NewReader(data), LexOptions{}),
+			}
+			for name, tokenizer := range tokenizers {
+				i := 0
+				for {
+					token, err := tokenizer.Next()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					expected := fixture.tokens[i]
+					if token.Value != expected.value || token.Line != expected.line {
+						t.Fatalf("%s: expected (%q,%d) but got (%q,%d)",
+							name, expected.value, expected.line, token.Value, token.Line)
+					}
+					i++
+				}
+				if i != len(fixture.tokens) {
+					t.Fatalf("%s: expected %d tokens but got %d", name, len(fixture.tokens), i)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizer_error(t *testing.T) {
+	t.Parallel()
+
+	tokenizer := NewTokenizerBytes([]byte("http {{}"), LexOptions{})
+	var values []string
+	var err error
+	for err == nil {
+		var token NgxToken
+		token, err = tokenizer.Next()
+		if err != nil && token.Error != err { //nolint:errorlint
+			t.Fatalf("expected the error of the token but got %v", err)
+		}
+		values = append(values, token.Value)
+	}
+
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.What != `unexpected "{"` {
+		t.Fatalf("expected unexpected \"{\" but got %v", err)
+	}
+	if strings.Join(values, " ") != "http { " {
+		t.Fatalf("unexpected tokens %q", values)
+	}
+	// the tokenizer stops at the first error
+	if _, err := tokenizer.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after an error but got %v", err)
+	}
+}
+
+func benchmarkLex(b *testing.B, lex func(data []byte) int) {
+	data, err := os.ReadFile(getTestConfigPath("messy", "nginx.conf"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if lex(data) == 0 {
+			b.Fatal("no tokens")
+		}
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	benchmarkLex(b, func(data []byte) int {
+		n := 0
+		for range Lex(bytes.NewReader(data)) {
+			n++
+		}
+		return n
+	})
+}
+
+func BenchmarkTokenizer(b *testing.B) {
+	benchmarkLex(b, func(data []byte) int {
+		n := 0
+		tokenizer := NewTokenizerBytes(data, LexOptions{})
+		for {
+			if _, err := tokenizer.Next(); err != nil {
+				return n
+			}
+			n++
+		}
+	})
+}
@@ -0,0 +1,270 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityOff disables a rule when it is set in LintOptions.
+	SeverityOff Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+//nolint:gochecknoglobals
+var severityNames = []string{"off", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity as its name, like "warning".
+func (s Severity) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(severityNames) {
+		return nil, fmt.Errorf("invalid severity %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity from its name, like "warning".
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if strings.EqualFold(string(text), name) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid severity %q", text)
+}
+
+// Diagnostic is a problem found in a payload by a lint Rule.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	// Directive is the directive the problem was found at.
+	Directive *Directive `json:"-"`
+}
+
+// String returns the diagnostic in the form "file:line: severity: message (rule)".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", d.File, d.Line, d.Severity, d.Message, d.Rule)
+}
+
+// Rule is a lint rule that checks a payload for a problem.
+type Rule interface {
+	// ID identifies the rule in LintOptions and in suppression comments, like "if-is-evil".
+	ID() string
+	// Severity is the severity of the diagnostics of the rule, unless LintOptions changes it.
+	// Rules with SeverityOff only run when LintOptions gives them another severity.
+	Severity() Severity
+	// Check reports the problems the rule finds in the payload of c.
+	Check(c *LintContext)
+}
+
+// NewRule returns a Rule that calls check to check a payload.
+func NewRule(id string, severity Severity, check func(c *LintContext)) Rule {
+	return &funcRule{id: id, severity: severity, check: check}
+}
+
+type funcRule struct {
+	id       string
+	severity Severity
+	check    func(c *LintContext)
+}
+
+func (r *funcRule) ID() string           { return r.id }
+func (r *funcRule) Severity() Severity   { return r.severity }
+func (r *funcRule) Check(c *LintContext) { r.check(c) }
+
+// LintOptions determine the rules used by Lint.
+type LintOptions struct {
+	// Rules are the rules to check, DefaultRules are used if it is nil.
+	Rules []Rule `json:"-"`
+	// Severity changes the severity of rules by their ID, SeverityOff disables a rule.
+	Severity map[string]Severity `json:"severity,omitempty"`
+}
+
+// LintContext is passed to the Check method of a Rule to report the problems it finds.
+type LintContext struct {
+	Payload *Payload
+
+	rule        string
+	severity    Severity
+	linter      *linter
+	diagnostics []Diagnostic
+}
+
+// Report reports a problem found at a directive of the payload.
+func (c *LintContext) Report(d *Directive, format string, args ...interface{}) {
+	if c.linter.suppressed(d, c.rule) {
+		return
+	}
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Rule:      c.rule,
+		Severity:  c.severity,
+		Message:   fmt.Sprintf(format, args...),
+		File:      c.linter.files[d],
+		Line:      d.Line,
+		Directive: d,
+	})
+}
+
+// File returns the file of the config a directive of the payload is in.
+func (c *LintContext) File(d *Directive) string {
+	return c.linter.files[d]
+}
+
+// Lint checks the payload with the rules of options and returns the problems found, ordered by
+// the position of the configs in the payload and by line.
+//
+// A comment "# crossplane:ignore" followed by rule IDs suppresses the diagnostics of those rules,
+// or of all rules if none are given, for the directive the comment is on the same line as, or else
+// for the directive after the comment, including the directives in its block and in the configs it
+// includes. Comments are only in the payload if it was parsed with ParseComments.
+func (p *Payload) Lint(options *LintOptions) []Diagnostic {
+	if options == nil {
+		options = &LintOptions{}
+	}
+	rules := options.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+
+	l := newLinter(p)
+	var diagnostics []Diagnostic
+	for _, rule := range rules {
+		severity := rule.Severity()
+		if s, ok := options.Severity[rule.ID()]; ok {
+			severity = s
+		}
+		if severity == SeverityOff {
+			continue
+		}
+		c := &LintContext{Payload: p, rule: rule.ID(), severity: severity, linter: l}
+		rule.Check(c)
+		diagnostics = append(diagnostics, c.diagnostics...)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return l.configs[a.File] < l.configs[b.File]
+		}
+		return a.Line < b.Line
+	})
+	return diagnostics
+}
+
+const ignoreComment = "crossplane:ignore"
+
+type linter struct {
+	files   map[*Directive]string
+	configs map[string]int
+	parents map[*Directive]*Directive
+	// rules suppressed for directives, an empty list suppresses all of them
+	ignored map[*Directive][]string
+}
+
+func newLinter(p *Payload) *linter {
+	l := &linter{
+		files:   map[*Directive]string{},
+		configs: map[string]int{},
+		parents: map[*Directive]*Directive{},
+		ignored: map[*Directive][]string{},
+	}
+	// the parents of directives of included configs are the include directives
+	p.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if parent := ctx.Parent(); parent != nil {
+			if _, ok := l.parents[d]; !ok {
+				l.parents[d] = parent
+			}
+		}
+		return true
+	}, true)
+	for i := range p.Config {
+		if _, ok := l.configs[p.Config[i].File]; !ok {
+			l.configs[p.Config[i].File] = i
+		}
+		l.index(p.Config[i].File, nil, p.Config[i].Parsed)
+	}
+	return l
+}
+
+func (l *linter) index(file string, parent *Directive, block Directives) {
+	for i, d := range block {
+		l.files[d] = file
+		if _, ok := l.parents[d]; !ok && parent != nil {
+			l.parents[d] = parent
+		}
+		l.index(file, d, d.Block)
+
+		if !d.IsComment() || !strings.HasPrefix(strings.TrimSpace(*d.Comment), ignoreComment) {
+			continue
+		}
+		fields := strings.Fields(*d.Comment)
+		if fields[0] != ignoreComment {
+			continue
+		}
+		target := ignoreTarget(parent, block, i)
+		if target == nil {
+			continue
+		}
+		// an empty list ignores all rules, other comments can't narrow it down
+		if rules, ok := l.ignored[target]; ok && len(rules) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			l.ignored[target] = []string{}
+		} else {
+			l.ignored[target] = append(l.ignored[target], fields[1:]...)
+		}
+	}
+}
+
+// ignoreTarget returns the directive a suppression comment at block[i] applies to.
+func ignoreTarget(parent *Directive, block Directives, i int) *Directive {
+	comment := block[i]
+	// a comment on the same line as a directive, or as the "{" of the block it is in
+	for j := i - 1; j >= 0 && block[j].Line == comment.Line; j-- {
+		if !block[j].IsComment() {
+			return block[j]
+		}
+	}
+	if i == 0 && parent != nil && parent.Line == comment.Line {
+		return parent
+	}
+	for _, d := range block[i+1:] {
+		if !d.IsComment() {
+			return d
+		}
+	}
+	return nil
+}
+
+func (l *linter) suppressed(d *Directive, rule string) bool {
+	for ; d != nil; d = l.parents[d] {
+		if rules, ok := l.ignored[d]; ok && (len(rules) == 0 || contains(rules, rule)) {
+			return true
+		}
+	}
+	return false
+}
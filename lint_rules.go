@@ -0,0 +1,249 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRules returns the built-in rules used by Lint when LintOptions has no rules:
+//
+//   - "duplicate-server-name": a server name used by several servers listening on the same address and
+//     port, only the first server is used for it.
+//   - "if-is-evil": an if block in a location with directives other than return and rewrite, which
+//     may not work as expected.
+//   - "proxy-pass-uri": a proxy_pass with a URI in a location given by a regular expression, in a named
+//     location, in an if block or in a limit_except block, which nginx rejects.
+//   - "add-header-inheritance": add_header directives in a block dropping the headers added by the
+//     blocks around it.
+//   - "regex-captures": a reference to a capture like "$3" beyond the number of capture groups of the
+//     regular expression of a location, an if, a rewrite or a map key it refers to.
+func DefaultRules() []Rule {
+	return []Rule{
+		NewRule("duplicate-server-name", SeverityWarning, checkDuplicateServerNames),
+		NewRule("if-is-evil", SeverityWarning, checkIfIsEvil),
+		NewRule("proxy-pass-uri", SeverityError, checkProxyPassURI),
+		NewRule("add-header-inheritance", SeverityWarning, checkAddHeaderInheritance),
+		NewRule("regex-captures", SeverityWarning, checkRegexCaptures),
+	}
+}
+
+func checkDuplicateServerNames(c *LintContext) {
+	http := c.Payload.HTTP()
+	if http == nil {
+		return
+	}
+	first := map[string]*Directive{}
+	for _, s := range http.Servers {
+		addrs := map[string]bool{}
+		for _, l := range s.Listen {
+			addrs[listenKey(l)] = true
+		}
+		if len(s.Listen) == 0 {
+			addrs[listenKey(&Listen{Port: 80})] = true
+		}
+
+		for _, d := range c.Payload.children(s.Directive) {
+			if d.Directive != "server_name" {
+				continue
+			}
+			for _, name := range d.Args {
+				// empty names and regular expressions do not conflict in nginx
+				if name == "" || strings.HasPrefix(name, "~") {
+					continue
+				}
+				for addr := range addrs {
+					key := addr + " " + strings.ToLower(name)
+					if prev, ok := first[key]; ok {
+						c.Report(d, "conflicting server name %q on %s, already used at %s:%d",
+							name, addr, c.File(prev), prev.Line)
+						continue
+					}
+					first[key] = d
+				}
+			}
+		}
+	}
+}
+
+// listenKey returns the address and port of a listen directive, with the same form for
+// the addresses that mean any IPv4 address.
+func listenKey(l *Listen) string {
+	addr := l.Address
+	if addr == "" || addr == "0.0.0.0" {
+		addr = "*"
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		return addr
+	}
+	return fmt.Sprintf("%s:%d", addr, l.Port)
+}
+
+func checkIfIsEvil(c *LintContext) {
+	c.Payload.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if d.Directive != "if" || !d.IsBlock() {
+			return true
+		}
+		parents := blockParents(ctx.Parents)
+		if len(parents) == 0 || parents[len(parents)-1].Directive != "location" {
+			return true
+		}
+		for _, child := range c.Payload.children(d) {
+			if !child.IsComment() && child.Directive != "return" && child.Directive != "rewrite" {
+				c.Report(d, "if in a location should only have return or rewrite directives, found %q", child.Directive)
+				break
+			}
+		}
+		return true
+	}, true)
+}
+
+func checkProxyPassURI(c *LintContext) {
+	c.Payload.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if d.Directive != "proxy_pass" || len(d.Args) == 0 || !hasURI(d.Args[0]) {
+			return true
+		}
+		parents := blockParents(ctx.Parents)
+		if len(parents) == 0 {
+			return true
+		}
+
+		where := ""
+		switch parent := parents[len(parents)-1]; parent.Directive {
+		case "if":
+			where = `inside an "if" block`
+		case "limit_except":
+			where = `inside a "limit_except" block`
+		default:
+			if l := c.Payload.Location(parent); l != nil && l.IsRegex() {
+				where = "in a location given by a regular expression"
+			} else if l != nil && l.IsNamed() {
+				where = "inside a named location"
+			}
+		}
+		if where != "" {
+			c.Report(d, "proxy_pass cannot have a URI part %s", where)
+		}
+		return true
+	}, true)
+}
+
+// hasURI returns true if the URL of a proxy_pass directive has a URI part, like "http://backend/api".
+// URLs with variables are not checked by nginx.
+func hasURI(url string) bool {
+	if strings.Contains(url, "$") {
+		return false
+	}
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return false
+	}
+	host := url[i+3:]
+	// a unix socket path ends with a ":" before the URI, like "http://unix:/tmp/backend.socket:/uri/"
+	if strings.HasPrefix(host, "unix:") {
+		j := strings.IndexByte(host[len("unix:"):], ':')
+		return j >= 0 && len(host) > len("unix:")+j+1
+	}
+	return strings.Contains(host, "/")
+}
+
+func checkAddHeaderInheritance(c *LintContext) {
+	c.Payload.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if !d.IsBlock() || (d.Directive != "server" && d.Directive != "location" && d.Directive != "if") {
+			return true
+		}
+		parents := blockParents(ctx.Parents)
+		if len(parents) == 0 || parents[0].Directive != "http" {
+			return true
+		}
+
+		var first *Directive
+		own := map[string]bool{}
+		for _, child := range c.Payload.children(d) {
+			switch {
+			case child.Directive == "add_header_inherit":
+				// the inheritance is set explicitly
+				return true
+			case child.Directive == "add_header" && len(child.Args) > 0:
+				own[strings.ToLower(child.Args[0])] = true
+				if first == nil {
+					first = child
+				}
+			}
+		}
+		if first == nil {
+			return true
+		}
+
+		inherited, err := c.Payload.Effective(parents[len(parents)-1])
+		if err != nil {
+			return true
+		}
+		var dropped []string
+		for _, e := range inherited.Lookup("add_header") {
+			if len(e.Directive.Args) > 0 && !own[strings.ToLower(e.Directive.Args[0])] {
+				dropped = append(dropped, e.Directive.Args[0])
+			}
+		}
+		if len(dropped) > 0 {
+			c.Report(first, "add_header in %s drops the inherited headers %s, they must be repeated in this block",
+				d.Directive, strings.Join(dropped, ", "))
+		}
+		return true
+	}, true)
+}
+
+func checkRegexCaptures(c *LintContext) {
+	// check reports the references of args to captures that expr does not have
+	check := func(d *Directive, expr string, args []string) {
+		n, err := RegexCaptures(expr)
+		if err != nil {
+			return
+		}
+		for _, arg := range args {
+			for _, name := range VariableNames(arg) {
+				if ref, err := strconv.Atoi(name); err == nil && ref > n {
+					c.Report(d, "$%d refers to a capture that %q does not have, it has %d", ref, expr, n)
+				}
+			}
+		}
+	}
+
+	// refs checks the directives of a block that use the captures of the regular expression of the block
+	var refs func(block *Directive, expr string)
+	refs = func(block *Directive, expr string) {
+		for _, d := range c.Payload.children(block) {
+			if d.Directive == "location" || d.Directive == "rewrite" || len(regexArgs(d, nil)) > 0 {
+				continue
+			}
+			check(d, expr, d.Args)
+			if d.IsBlock() {
+				refs(d, expr)
+			}
+		}
+	}
+
+	c.Payload.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		exprs := regexArgs(d, ctx.BlockCtx())
+		if len(exprs) == 0 {
+			return true
+		}
+		switch {
+		case d.Directive == "rewrite" && len(d.Args) > 1:
+			check(d, exprs[0], d.Args[1:2])
+		case d.Directive == "location" || d.Directive == "if":
+			refs(d, exprs[0])
+		case d.Directive != "server_name":
+			// a map key
+			check(d, exprs[0], d.Args)
+		}
+		return true
+	}, true)
+}
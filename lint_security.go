@@ -0,0 +1,250 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"path"
+	"strings"
+)
+
+// SecurityRules returns the rules of the security audit, which are not part of DefaultRules:
+//
+//   - "ssl-protocols": ssl_protocols enabling SSLv2, SSLv3, TLSv1 or TLSv1.1.
+//   - "ssl-ciphers": ssl_ciphers enabling weak ciphers, like RC4, DES, MD5, export or null ciphers.
+//   - "server-tokens": server_tokens on, which sends the version of nginx in responses and error pages.
+//   - "autoindex": autoindex on, which lists the files of directories.
+//   - "missing-hsts": a server listening with ssl that does not add a Strict-Transport-Security header.
+//   - "alias-traversal": an alias ending with a slash in a location whose path does not, which lets
+//     requests like "/images../" reach the parent directory of the alias.
+//   - "proxy-pass-resolver": a proxy_pass with variables, whose host is resolved when a request is
+//     proxied, without a resolver.
+//   - "root-filesystem": a root serving the file system root or a system directory, like /etc.
+//   - "allow-all-before-deny": deny directives after allow all, which are never used.
+//
+// Use them with the default rules with:
+//
+//	payload.Lint(&LintOptions{Rules: append(DefaultRules(), SecurityRules()...)})
+func SecurityRules() []Rule {
+	return []Rule{
+		NewRule("ssl-protocols", SeverityError, checkSSLProtocols),
+		NewRule("ssl-ciphers", SeverityError, checkSSLCiphers),
+		NewRule("server-tokens", SeverityWarning, checkFlag("server_tokens", "server_tokens on sends the version of nginx to clients")),
+		NewRule("autoindex", SeverityWarning, checkFlag("autoindex", "autoindex on lists the files of directories")),
+		NewRule("missing-hsts", SeverityWarning, checkHSTS),
+		NewRule("alias-traversal", SeverityError, checkAliasTraversal),
+		NewRule("proxy-pass-resolver", SeverityError, checkProxyPassResolver),
+		NewRule("root-filesystem", SeverityError, checkRootFilesystem),
+		NewRule("allow-all-before-deny", SeverityWarning, checkAllowAllBeforeDeny),
+	}
+}
+
+// inspectDirectives calls f for the directives with the given name in the payload, following includes.
+func inspectDirectives(p *Payload, name string, f func(d *Directive, ctx *WalkContext)) {
+	p.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if d.Directive == name {
+			f(d, ctx)
+		}
+		return true
+	}, true)
+}
+
+func checkSSLProtocols(c *LintContext) {
+	inspectDirectives(c.Payload, "ssl_protocols", func(d *Directive, _ *WalkContext) {
+		var weak []string
+		for _, arg := range d.Args {
+			switch arg {
+			case "SSLv2", "SSLv3", "TLSv1", "TLSv1.1":
+				weak = append(weak, arg)
+			}
+		}
+		if len(weak) > 0 {
+			c.Report(d, "ssl_protocols enables the weak protocols %s", strings.Join(weak, ", "))
+		}
+	})
+}
+
+//nolint:gochecknoglobals
+var weakCiphers = map[string]bool{
+	"NULL":   true,
+	"ANULL":  true,
+	"ENULL":  true,
+	"EXPORT": true,
+	"EXP":    true,
+	"LOW":    true,
+	"DES":    true,
+	"3DES":   true,
+	"RC2":    true,
+	"RC4":    true,
+	"MD5":    true,
+	"ADH":    true,
+	"AECDH":  true,
+}
+
+func checkSSLCiphers(c *LintContext) {
+	inspectDirectives(c.Payload, "ssl_ciphers", func(d *Directive, _ *WalkContext) {
+		if len(d.Args) == 0 {
+			return
+		}
+		var weak []string
+		for _, cipher := range strings.Split(d.Args[0], ":") {
+			// ciphers starting with "!" or "-" are removed from the list
+			if cipher == "" || cipher[0] == '!' || cipher[0] == '-' {
+				continue
+			}
+			cipher = strings.TrimPrefix(cipher, "+")
+			for _, part := range strings.Split(strings.ToUpper(cipher), "-") {
+				if weakCiphers[part] {
+					weak = append(weak, cipher)
+					break
+				}
+			}
+		}
+		if len(weak) > 0 {
+			c.Report(d, "ssl_ciphers enables the weak ciphers %s", strings.Join(weak, ", "))
+		}
+	})
+}
+
+// checkFlag returns a check reporting a directive set to "on".
+func checkFlag(name, message string) func(c *LintContext) {
+	return func(c *LintContext) {
+		inspectDirectives(c.Payload, name, func(d *Directive, _ *WalkContext) {
+			if len(d.Args) == 1 && d.Args[0] == "on" {
+				c.Report(d, "%s", message)
+			}
+		})
+	}
+}
+
+func checkHSTS(c *LintContext) {
+	http := c.Payload.HTTP()
+	if http == nil {
+		return
+	}
+	for _, s := range http.Servers {
+		var ssl *Directive
+		for _, l := range s.Listen {
+			if l.SSL || l.QUIC {
+				ssl = l.Directive
+				break
+			}
+		}
+		if ssl == nil {
+			continue
+		}
+		e, err := c.Payload.Effective(s.Directive)
+		if err != nil {
+			continue
+		}
+		found := false
+		for _, h := range e.Lookup("add_header") {
+			if len(h.Directive.Args) > 0 && strings.EqualFold(h.Directive.Args[0], "Strict-Transport-Security") {
+				found = true
+			}
+		}
+		if !found {
+			c.Report(ssl, "server listening with ssl does not add a Strict-Transport-Security header")
+		}
+	}
+}
+
+func checkAliasTraversal(c *LintContext) {
+	inspectDirectives(c.Payload, "alias", func(d *Directive, ctx *WalkContext) {
+		parents := blockParents(ctx.Parents)
+		if len(d.Args) == 0 || len(parents) == 0 {
+			return
+		}
+		l := c.Payload.Location(parents[len(parents)-1])
+		if l == nil || l.IsRegex() || l.IsNamed() || l.Modifier == "=" {
+			return
+		}
+		if strings.HasSuffix(d.Args[0], "/") && !strings.HasSuffix(l.Path, "/") {
+			c.Report(d, "alias %s ends with a slash but location %s does not, requests like %q reach the parent directory",
+				d.Args[0], l.Path, l.Path+"../")
+		}
+	})
+}
+
+func checkProxyPassResolver(c *LintContext) {
+	upstreams := map[string]bool{}
+	if http := c.Payload.HTTP(); http != nil {
+		for _, u := range http.Upstreams {
+			upstreams[u.Name] = true
+		}
+	}
+
+	inspectDirectives(c.Payload, "proxy_pass", func(d *Directive, ctx *WalkContext) {
+		parents := blockParents(ctx.Parents)
+		if len(d.Args) == 0 || !strings.Contains(d.Args[0], "$") || len(parents) == 0 {
+			return
+		}
+		// the host of the URL is looked up among the upstreams before it is resolved, a host followed
+		// by a variable, like "http://backend$request_uri", is assumed to be the upstream
+		host := d.Args[0]
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		if i := strings.IndexAny(host, "/:"); i >= 0 {
+			host = host[:i]
+		}
+		if i := strings.IndexByte(host, '$'); (i > 0 && upstreams[host[:i]]) || upstreams[host] {
+			return
+		}
+
+		e, err := c.Payload.Effective(parents[len(parents)-1])
+		if err == nil && len(e.Lookup("resolver")) == 0 {
+			c.Report(d, "proxy_pass with variables needs a resolver to resolve %s", host)
+		}
+	})
+}
+
+//nolint:gochecknoglobals
+var systemDirs = map[string]bool{
+	"/":     true,
+	"/bin":  true,
+	"/boot": true,
+	"/dev":  true,
+	"/etc":  true,
+	"/home": true,
+	"/lib":  true,
+	"/proc": true,
+	"/root": true,
+	"/sbin": true,
+	"/sys":  true,
+	"/usr":  true,
+	"/var":  true,
+}
+
+func checkRootFilesystem(c *LintContext) {
+	inspectDirectives(c.Payload, "root", func(d *Directive, _ *WalkContext) {
+		if len(d.Args) == 0 || strings.Contains(d.Args[0], "$") || !strings.HasPrefix(d.Args[0], "/") {
+			return
+		}
+		if dir := path.Clean(d.Args[0]); systemDirs[dir] {
+			c.Report(d, "root %s serves the files of a system directory", dir)
+		}
+	})
+}
+
+func checkAllowAllBeforeDeny(c *LintContext) {
+	c.Payload.Inspect(func(d *Directive, _ *WalkContext) bool {
+		if !d.IsBlock() {
+			return true
+		}
+		var allowAll *Directive
+		for _, child := range c.Payload.children(d) {
+			switch {
+			case allowAll == nil && child.Directive == "allow" && len(child.Args) == 1 && child.Args[0] == "all":
+				allowAll = child
+			case allowAll != nil && child.Directive == "deny":
+				c.Report(child, "deny is never used, it is after allow all at line %d", allowAll.Line)
+			}
+		}
+		return true
+	}, true)
+}
@@ -0,0 +1,78 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityRules(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("lint-security", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	diagnostics := payload.Lint(&LintOptions{Rules: SecurityRules()})
+	require.Equal(t, []string{
+		"nginx.conf:3 server-tokens",
+		"nginx.conf:4 ssl-protocols",
+		"nginx.conf:5 ssl-ciphers",
+		"nginx.conf:11 missing-hsts",
+		"nginx.conf:13 root-filesystem",
+		"nginx.conf:15 alias-traversal",
+		"nginx.conf:16 autoindex",
+		"nginx.conf:23 proxy-pass-resolver",
+		"nginx.conf:31 allow-all-before-deny",
+		"nginx.conf:32 allow-all-before-deny",
+		"nginx.conf:54 root-filesystem",
+	}, diagnosticStrings(diagnostics))
+
+	messages := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		messages = append(messages, d.Message)
+	}
+	require.Equal(t, []string{
+		"server_tokens on sends the version of nginx to clients",
+		"ssl_protocols enables the weak protocols TLSv1",
+		"ssl_ciphers enables the weak ciphers RC4-SHA, DES-CBC3-SHA",
+		"server listening with ssl does not add a Strict-Transport-Security header",
+		"root / serves the files of a system directory",
+		`alias /data/images/ ends with a slash but location /images does not, requests like "/images../" reach the parent directory`,
+		"autoindex on lists the files of directories",
+		"proxy_pass with variables needs a resolver to resolve $arg_host",
+		"deny is never used, it is after allow all at line 30",
+		"deny is never used, it is after allow all at line 30",
+		"root /etc serves the files of a system directory",
+	}, messages)
+	require.Equal(t, SeverityError, diagnostics[1].Severity)
+	require.Equal(t, SeverityWarning, diagnostics[0].Severity)
+}
+
+func TestSecurityRules_withDefaultRules(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `
+http {
+    # crossplane:ignore server-tokens
+    server_tokens on;
+    server {
+        listen 443 quic;
+        add_header Strict-Transport-Security max-age=31536000;
+        location ~ \.php$ {
+            proxy_pass http://backend/php/;
+        }
+    }
+}`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{ParseComments: true})
+	require.NoError(t, err)
+
+	diagnostics := payload.Lint(&LintOptions{Rules: append(DefaultRules(), SecurityRules()...)})
+	require.Equal(t, []string{"nginx.conf:9 proxy-pass-uri"}, diagnosticStrings(diagnostics))
+}
@@ -0,0 +1,202 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// diagnosticStrings returns the diagnostics as "file:line rule", with the base name of the file.
+func diagnosticStrings(diagnostics []Diagnostic) []string {
+	s := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		s = append(s, fmt.Sprintf("%s:%d %s", filepath.Base(d.File), d.Line, d.Rule))
+	}
+	return s
+}
+
+func TestPayload_Lint(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("lint", "nginx.conf"), &ParseOptions{ParseComments: true})
+	require.NoError(t, err)
+
+	diagnostics := payload.Lint(nil)
+	require.Equal(t, []string{
+		"nginx.conf:13 if-is-evil",
+		"nginx.conf:14 add-header-inheritance",
+		"nginx.conf:18 proxy-pass-uri",
+		"nginx.conf:24 proxy-pass-uri",
+		"nginx.conf:28 proxy-pass-uri",
+		"nginx.conf:40 duplicate-server-name",
+		"nginx.conf:41 add-header-inheritance",
+		"headers.conf:7 add-header-inheritance",
+	}, diagnosticStrings(diagnostics))
+
+	d := diagnostics[5]
+	require.Equal(t, SeverityWarning, d.Severity)
+	require.Equal(t, `conflicting server name "www.example.com" on *:80, already used at `+
+		getTestConfigPath("lint", "nginx.conf")+":8", d.Message)
+	require.Equal(t, "server_name", d.Directive.Directive)
+
+	d = diagnostics[2]
+	require.Equal(t, SeverityError, d.Severity)
+	require.Equal(t, "proxy_pass cannot have a URI part in a location given by a regular expression", d.Message)
+	require.Equal(t, getTestConfigPath("lint", "nginx.conf")+
+		":18: error: proxy_pass cannot have a URI part in a location given by a regular expression (proxy-pass-uri)",
+		d.String())
+
+	require.Equal(t, "add_header in location drops the inherited headers X-Frame-Options, X-Content-Type-Options, "+
+		"they must be repeated in this block", diagnostics[7].Message)
+	require.Equal(t, "add_header in server drops the inherited headers X-Content-Type-Options, "+
+		"they must be repeated in this block", diagnostics[6].Message)
+}
+
+func TestPayload_Lint_withoutComments(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("lint", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	// suppression comments are only found if comments are parsed
+	require.Equal(t, []string{
+		"nginx.conf:13 if-is-evil",
+		"nginx.conf:14 add-header-inheritance",
+		"nginx.conf:18 proxy-pass-uri",
+		"nginx.conf:24 proxy-pass-uri",
+		"nginx.conf:28 proxy-pass-uri",
+		"nginx.conf:33 if-is-evil",
+		"nginx.conf:40 duplicate-server-name",
+		"nginx.conf:41 add-header-inheritance",
+		"nginx.conf:52 duplicate-server-name",
+		"headers.conf:3 duplicate-server-name",
+		"headers.conf:7 add-header-inheritance",
+	}, diagnosticStrings(payload.Lint(nil)))
+}
+
+func TestPayload_Lint_options(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("lint", "nginx.conf"), &ParseOptions{ParseComments: true})
+	require.NoError(t, err)
+
+	var options LintOptions
+	err = json.Unmarshal([]byte(`{"severity": {"add-header-inheritance": "off", "if-is-evil": "error"}}`), &options)
+	require.NoError(t, err)
+
+	diagnostics := payload.Lint(&options)
+	require.Equal(t, []string{
+		"nginx.conf:13 if-is-evil",
+		"nginx.conf:18 proxy-pass-uri",
+		"nginx.conf:24 proxy-pass-uri",
+		"nginx.conf:28 proxy-pass-uri",
+		"nginx.conf:40 duplicate-server-name",
+	}, diagnosticStrings(diagnostics))
+	require.Equal(t, SeverityError, diagnostics[0].Severity)
+
+	// custom rules, a rule that is off by default only runs if it is given a severity
+	servers := NewRule("count-servers", SeverityOff, func(c *LintContext) {
+		for _, s := range c.Payload.HTTP().Servers {
+			c.Report(s.Directive, "server")
+		}
+	})
+	options = LintOptions{Rules: []Rule{servers}}
+	require.Empty(t, payload.Lint(&options))
+
+	options.Severity = map[string]Severity{"count-servers": SeverityInfo}
+	diagnostics = payload.Lint(&options)
+	require.Equal(t, []string{
+		"nginx.conf:6 count-servers",
+		"nginx.conf:38 count-servers",
+		"nginx.conf:43 count-servers",
+		"headers.conf:1 count-servers",
+	}, diagnosticStrings(diagnostics))
+	require.Equal(t, SeverityInfo, diagnostics[0].Severity)
+
+	b, err := json.Marshal(diagnostics[0])
+	require.NoError(t, err)
+	require.JSONEq(t, fmt.Sprintf(`{"rule": "count-servers", "severity": "info", "message": "server", "file": %q, "line": 6}`,
+		getTestConfigPath("lint", "nginx.conf")), string(b))
+}
+
+func TestPayload_Lint_suppression(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `
+http {
+    server {
+        # crossplane:ignore if-is-evil
+        location / {
+            if ($a) { set $b c; }
+        }
+        location /x/ {
+            # crossplane:ignore if-is-evil
+            # crossplane:ignore proxy-pass-uri
+            if ($a) { proxy_pass http://a/b; }
+            if ($a) { proxy_pass http://a/b; } # crossplane:ignore proxy-pass-uri
+            # crossplane:ignored
+            if ($a) { set $b c; }
+        }
+        location /y/ {
+            # crossplane:ignore
+            # crossplane:ignore proxy-pass-uri
+            if ($a) { proxy_pass http://a/b; }
+            # crossplane:ignore proxy-pass-uri
+            if ($a) { proxy_pass http://a/b; } # crossplane:ignore
+        }
+        include x.conf; # crossplane:ignore
+    }
+}`,
+		"x.conf": `location ~ x { proxy_pass http://a/b; }`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{ParseComments: true})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"nginx.conf:12 if-is-evil",
+		"nginx.conf:14 if-is-evil",
+	}, diagnosticStrings(payload.Lint(nil)))
+}
+
+func TestSeverity_text(t *testing.T) {
+	t.Parallel()
+	for _, s := range []Severity{SeverityOff, SeverityInfo, SeverityWarning, SeverityError} {
+		text, err := s.MarshalText()
+		require.NoError(t, err)
+		var decoded Severity
+		require.NoError(t, decoded.UnmarshalText(text))
+		require.Equal(t, s, decoded)
+	}
+
+	var s Severity
+	require.NoError(t, s.UnmarshalText([]byte("Warning")))
+	require.Equal(t, SeverityWarning, s)
+	require.Error(t, s.UnmarshalText([]byte("fatal")))
+	_, err := Severity(7).MarshalText()
+	require.Error(t, err)
+	require.Equal(t, "Severity(7)", Severity(7).String())
+}
+
+func TestHasURI(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]bool{
+		"http://backend":                false,
+		"http://backend:8080":           false,
+		"http://backend/":               true,
+		"https://127.0.0.1:8443/api":    true,
+		"http://$upstream/api":          false,
+		"http://unix:/run/a.sock":       false,
+		"http://unix:/run/a.sock:/api/": true,
+		"backend":                       false,
+	}
+	for url, expected := range testcases {
+		require.Equal(t, expected, hasURI(url), url)
+	}
+}
@@ -0,0 +1,35 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+// VariableRules returns the rules checking the variables of a payload with Payload.Variables,
+// which are not part of DefaultRules:
+//
+//   - "undefined-variable": a reference to a variable that is neither built into nginx nor defined
+//     in the payload, which nginx rejects.
+//   - "unused-variable": a variable defined but never referenced.
+//   - "shadowed-variable": a variable defined with the name of a built-in variable.
+func VariableRules() []Rule {
+	return []Rule{
+		NewRule("undefined-variable", SeverityError, func(c *LintContext) {
+			for _, v := range c.Payload.Variables().Undefined() {
+				c.Report(v.Directive, "unknown %q variable", v.Name)
+			}
+		}),
+		NewRule("unused-variable", SeverityInfo, func(c *LintContext) {
+			for _, v := range c.Payload.Variables().Unused() {
+				c.Report(v.Directive, "variable %q is never used", v.Name)
+			}
+		}),
+		NewRule("shadowed-variable", SeverityWarning, func(c *LintContext) {
+			for _, v := range c.Payload.Variables().Shadowed() {
+				c.Report(v.Directive, "variable %q shadows the built-in variable", v.Name)
+			}
+		}),
+	}
+}
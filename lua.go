@@ -0,0 +1,316 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lua is an external lexer and builder for the *_by_lua_block directives of the Lua module.
+// The body of a Lua block is Lua code rather than NGINX configuration, so it is read by a
+// Lua-aware lexer that understands Lua strings, comments and long brackets, and emitted as a
+// single quoted argument of the directive followed by a ";".
+//
+// To parse a configuration that contains Lua blocks, register the lexer and the MatchLua
+// match function:
+//
+//	lua := &crossplane.Lua{}
+//	payload, err := crossplane.Parse(path, &crossplane.ParseOptions{
+//		MatchFuncs: []crossplane.MatchFunc{crossplane.MatchLua},
+//		LexOptions: crossplane.LexOptions{
+//			Lexers: []crossplane.RegisterLexer{lua.RegisterLexer()},
+//		},
+//	})
+//
+// and to build it back register the builder:
+//
+//	err = crossplane.Build(w, payload.Config[0], &crossplane.BuildOptions{
+//		Builders: []crossplane.RegisterBuilder{lua.RegisterBuilder()},
+//	})
+type Lua struct{}
+
+func (l *Lua) directiveNames() []string {
+	return []string{
+		"init_by_lua_block",
+		"init_worker_by_lua_block",
+		"exit_worker_by_lua_block",
+		"set_by_lua_block",
+		"content_by_lua_block",
+		"server_rewrite_by_lua_block",
+		"rewrite_by_lua_block",
+		"access_by_lua_block",
+		"header_filter_by_lua_block",
+		"body_filter_by_lua_block",
+		"log_by_lua_block",
+		"balancer_by_lua_block",
+		"ssl_client_hello_by_lua_block",
+		"ssl_certificate_by_lua_block",
+		"ssl_session_fetch_by_lua_block",
+		"ssl_session_store_by_lua_block",
+	}
+}
+
+// RegisterLexer registers a lexer for the *_by_lua_block directives.
+func (l *Lua) RegisterLexer() RegisterLexer {
+	return LexWithTokenLexer(l, l.directiveNames()...)
+}
+
+// RegisterBuilder registers a builder for the *_by_lua_block directives.
+func (l *Lua) RegisterBuilder() RegisterBuilder {
+	return BuildWithBuilder(l, l.directiveNames()...)
+}
+
+// LexTokens reads the rest of a *_by_lua_block directive. The block body is emitted as one quoted token,
+// exactly as it appears in the configuration, and is followed by a ";" token.
+func (l *Lua) LexTokens(s *SubScanner, matchedToken string) TokenReader {
+	tokens := tokenSlice(l.lex(s, matchedToken))
+	return &tokens
+}
+
+// lex returns the tokens of the rest of a *_by_lua_block directive, the last one has an error if
+// the directive is invalid.
+//
+//nolint:funlen,gocognit,gocyclo
+func (l *Lua) lex(s *SubScanner, matchedToken string) (tokens []NgxToken) {
+	var pushback []string
+	next := func() (string, bool) {
+		if n := len(pushback); n > 0 {
+			r := pushback[n-1]
+			pushback = pushback[:n-1]
+			return r, true
+		}
+		if !s.Scan() {
+			return "", false
+		}
+		return s.Text(), true
+	}
+
+	fail := func(what string) {
+		line, col := s.Line(), s.Pos().Column
+		tokens = append(tokens, NgxToken{
+			Line:  line,
+			Error: &ParseError{File: &lexerFile, What: what, Line: &line, Column: &col},
+			Range: Range{Start: s.Pos(), End: s.Pos()},
+		})
+	}
+	eof := func() { fail(`unexpected end of file, expecting "}"`) }
+
+	// set_by_lua_block is the only Lua block directive that takes an argument before the block
+	if matchedToken == "set_by_lua_block" {
+		var arg strings.Builder
+		var argRange Range
+		for {
+			r, ok := next()
+			if !ok {
+				eof()
+				return
+			}
+			if isSpace(r) || r == "{" {
+				if arg.Len() == 0 {
+					if r == "{" {
+						fail(`expected variable name before "{"`)
+						return
+					}
+					continue
+				}
+				pushback = append(pushback, r)
+				argRange.End = s.Pos()
+				break
+			}
+			if arg.Len() == 0 {
+				argRange.Start = s.Pos()
+			}
+			arg.WriteString(r)
+		}
+		tokens = append(tokens, NgxToken{Value: arg.String(), Line: s.Line(), Range: argRange})
+	}
+
+	// the Lua block must start with a "{"
+	for {
+		r, ok := next()
+		if !ok {
+			eof()
+			return
+		}
+		if isSpace(r) {
+			continue
+		}
+		if r != "{" {
+			fail(`expected "{" to start Lua block`)
+			return
+		}
+		break
+	}
+
+	var body strings.Builder
+	bodyLine := s.Line()
+	bodyStart := s.EndPos()
+	depth := 1
+
+	// longBracket reads the remainder of a Lua long bracket opening ("[", "[=[", "[==[", ...) after
+	// its first "[" has been read. It returns the number of "=" if this is a long bracket, -1 otherwise.
+	longBracket := func() int {
+		level := 0
+		for {
+			r, ok := next()
+			if !ok {
+				return -1
+			}
+			switch r {
+			case "=":
+				level++
+				body.WriteString(r)
+				continue
+			case "[":
+				body.WriteString(r)
+				return level
+			default:
+				pushback = append(pushback, r)
+				return -1
+			}
+		}
+	}
+
+	// skipLong copies everything up to and including the long bracket closing of the given level.
+	skipLong := func(level int) bool {
+		closing := "]" + strings.Repeat("=", level) + "]"
+		var tail strings.Builder
+		for {
+			r, ok := next()
+			if !ok {
+				return false
+			}
+			body.WriteString(r)
+			tail.WriteString(r)
+			if t := tail.String(); strings.HasSuffix(t, closing) {
+				return true
+			} else if len(t) > len(closing) {
+				tail.Reset()
+				tail.WriteString(t[len(t)-len(closing):])
+			}
+		}
+	}
+
+	for {
+		r, ok := next()
+		if !ok {
+			eof()
+			return
+		}
+
+		switch r {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				tokens = append(tokens, NgxToken{
+					Value:    body.String(),
+					Line:     bodyLine,
+					IsQuoted: true,
+					Range:    Range{Start: bodyStart, End: s.Pos()},
+				})
+				tokens = append(tokens, NgxToken{Value: ";", Line: s.Line(), Range: Range{Start: s.Pos(), End: s.EndPos()}})
+				return
+			}
+		case `"`, "'":
+			body.WriteString(r)
+			esc := false
+			for {
+				c, ok := next()
+				if !ok {
+					eof()
+					return
+				}
+				body.WriteString(c)
+				if esc {
+					esc = false
+					continue
+				}
+				if c == `\` {
+					esc = true
+					continue
+				}
+				if c == r {
+					break
+				}
+				if isEOL(c) {
+					fail(fmt.Sprintf("unfinished string in Lua block starting at line %d", bodyLine))
+					return
+				}
+			}
+			continue
+		case "[":
+			body.WriteString(r)
+			if level := longBracket(); level >= 0 && !skipLong(level) {
+				eof()
+				return
+			}
+			continue
+		case "-":
+			body.WriteString(r)
+			c, ok := next()
+			if !ok {
+				eof()
+				return
+			}
+			if c != "-" {
+				pushback = append(pushback, c)
+				continue
+			}
+			body.WriteString(c)
+
+			// a "--[[" or "--[==[" starts a long comment, otherwise the comment ends at the end of the line
+			if c, ok = next(); ok && c == "[" {
+				body.WriteString(c)
+				if level := longBracket(); level >= 0 {
+					if !skipLong(level) {
+						eof()
+						return
+					}
+					continue
+				}
+			} else if ok {
+				pushback = append(pushback, c)
+			}
+			for {
+				c, ok := next()
+				if !ok {
+					eof()
+					return
+				}
+				body.WriteString(c)
+				if isEOL(c) {
+					break
+				}
+			}
+			continue
+		}
+
+		body.WriteString(r)
+	}
+}
+
+// Build renders a *_by_lua_block directive with its Lua code exactly as it was lexed.
+func (l *Lua) Build(stmt *Directive) string {
+	if len(stmt.Args) == 0 {
+		return stmt.Directive + " {}"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(Enquote(stmt.Directive))
+	for _, arg := range stmt.Args[:len(stmt.Args)-1] {
+		sb.WriteString(" ")
+		sb.WriteString(Enquote(arg))
+	}
+	sb.WriteString(" {")
+	sb.WriteString(stmt.Args[len(stmt.Args)-1])
+	sb.WriteString("}")
+	return sb.String()
+}
@@ -0,0 +1,248 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func luaParseOptions() ParseOptions {
+	lua := &Lua{}
+	return ParseOptions{
+		ParseComments: true,
+		LexOptions: LexOptions{
+			Lexers: []RegisterLexer{lua.RegisterLexer()},
+		},
+	}
+}
+
+func TestLua_ParseFixtures(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"lua-block-simple", "lua-block-larger", "lua-block-tricky"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			content, err := os.ReadFile(getTestConfigPath(name, "nginx.json"))
+			require.NoError(t, err)
+			var expected Payload
+			require.NoError(t, json.Unmarshal(content, &expected))
+
+			options := luaParseOptions()
+			payload, err := Parse(getTestConfigPath(name, "nginx.conf"), &options)
+			require.NoError(t, err)
+
+			if !equalPayloads(t, *payload, expected) {
+				b1, _ := json.Marshal(expected)
+				b2, _ := json.Marshal(payload)
+				t.Fatalf("expected: %s\nbut got: %s", b1, b2)
+			}
+		})
+	}
+}
+
+// TestLua_BuildRoundTrip checks that the Lua blocks are built back unchanged: byte for byte with the rest of
+// the config when parsed with trivia, and otherwise as in the built.conf of the fixture.
+func TestLua_BuildRoundTrip(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	for _, name := range []string{"lua-block-simple", "lua-block-larger", "lua-block-tricky"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			options := luaParseOptions()
+			payload, err := Parse(getTestConfigPath(name, "nginx.conf"), &options)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = Build(&buf, payload.Config[0], &BuildOptions{Builders: []RegisterBuilder{lua.RegisterBuilder()}})
+			require.NoError(t, err)
+			expected, err := os.ReadFile(getTestConfigPath(name, "built.conf"))
+			require.NoError(t, err)
+			require.Equal(t, string(expected), buf.String())
+
+			built := filepath.Join(t.TempDir(), "nginx.conf")
+			require.NoError(t, os.WriteFile(built, buf.Bytes(), os.ModePerm))
+			rebuilt, err := Parse(built, &options)
+			require.NoError(t, err)
+			require.True(t, equalBlocks(payload.Config[0].Parsed, rebuilt.Config[0].Parsed))
+
+			options.ParseTrivia = true
+			payload, err = Parse(getTestConfigPath(name, "nginx.conf"), &options)
+			require.NoError(t, err)
+			buf.Reset()
+			err = Build(&buf, payload.Config[0], &BuildOptions{Builders: []RegisterBuilder{lua.RegisterBuilder()}})
+			require.NoError(t, err)
+			original, err := os.ReadFile(getTestConfigPath(name, "nginx.conf"))
+			require.NoError(t, err)
+			require.Equal(t, string(original), buf.String())
+		})
+	}
+}
+
+func TestLua_Lex(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	testcases := map[string]struct {
+		config string
+		tokens []tokenLine
+	}{
+		"braces in strings and comments": {
+			config: "content_by_lua_block {\n  local s = \"}\" .. '{' -- }\n}\nreturn 200;",
+			tokens: []tokenLine{
+				{"content_by_lua_block", 1},
+				{"\n  local s = \"}\" .. '{' -- }\n", 1},
+				{";", 3},
+				{"return", 4},
+				{"200", 4},
+				{";", 4},
+			},
+		},
+		"long strings and long comments": {
+			config: "access_by_lua_block {\n  --[==[ } ]==]\n  local s = [[ { ]]\n}",
+			tokens: []tokenLine{
+				{"access_by_lua_block", 1},
+				{"\n  --[==[ } ]==]\n  local s = [[ { ]]\n", 1},
+				{";", 4},
+			},
+		},
+		"escaped quotes": {
+			config: `log_by_lua_block { ngx.log(ngx.ERR, "\"}") }`,
+			tokens: []tokenLine{
+				{"log_by_lua_block", 1},
+				{` ngx.log(ngx.ERR, "\"}") `, 1},
+				{";", 1},
+			},
+		},
+		"set_by_lua_block without space": {
+			config: "set_by_lua_block $res{ return 1 }",
+			tokens: []tokenLine{
+				{"set_by_lua_block", 1},
+				{"$res", 1},
+				{" return 1 ", 1},
+				{";", 1},
+			},
+		},
+		"not in directive position": {
+			config: "server_name content_by_lua_block;",
+			tokens: []tokenLine{
+				{"server_name", 1},
+				{"content_by_lua_block", 1},
+				{";", 1},
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var got []tokenLine
+			options := LexOptions{Lexers: []RegisterLexer{lua.RegisterLexer()}}
+			for token := range LexWithOptions(strings.NewReader(tc.config), options) {
+				require.NoError(t, token.Error)
+				got = append(got, tokenLine{token.Value, token.Line})
+			}
+			require.Equal(t, tc.tokens, got)
+		})
+	}
+}
+
+func TestLua_Lex_unhappy(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	testcases := map[string]string{
+		"unterminated block":  "content_by_lua_block { ngx.say('hi')",
+		"unterminated string": "content_by_lua_block { ngx.say('hi) }",
+		"missing open brace":  "content_by_lua_block ngx.say('hi') }",
+	}
+
+	for name, c := range testcases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var err error
+			options := LexOptions{Lexers: []RegisterLexer{lua.RegisterLexer()}}
+			for token := range LexWithOptions(strings.NewReader(c), options) {
+				if token.Error != nil {
+					err = token.Error
+					break
+				}
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLua_MaxTokenLength(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": "http {\n    init_by_lua_block {\n        print('a body longer than the limit')\n    }\n}\n",
+	}
+	options := luaParseOptions()
+	options.MaxTokenLength = 16
+	_, err := ParseFiles(files, "nginx.conf", &options)
+	require.ErrorIs(t, err, ErrMaxTokenLength)
+
+	options.MaxTokenLength = 64
+	_, err = ParseFiles(files, "nginx.conf", &options)
+	require.NoError(t, err)
+}
+
+// channelLuaLexer is a Lexer sending the tokens of the Lua lexer on a channel.
+type channelLuaLexer struct {
+	lua *Lua
+}
+
+func (l channelLuaLexer) Lex(s *SubScanner, matchedToken string) <-chan NgxToken {
+	tokenCh := make(chan NgxToken)
+	go func() {
+		defer close(tokenCh)
+		for _, token := range l.lua.lex(s, matchedToken) {
+			tokenCh <- token
+		}
+	}()
+	return tokenCh
+}
+
+func TestLexWithLexer(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	config := "content_by_lua_block { ngx.say('hi') }\nset_by_lua_block $a { return 1 }\nuser nginx;\n"
+	var want, got []NgxToken
+	tokens := NewTokenizer(strings.NewReader(config), LexOptions{Lexers: []RegisterLexer{lua.RegisterLexer()}})
+	for token, err := tokens.Next(); !errors.Is(err, io.EOF); token, err = tokens.Next() {
+		require.NoError(t, err)
+		want = append(want, token)
+	}
+	options := LexOptions{Lexers: []RegisterLexer{LexWithLexer(channelLuaLexer{lua}, lua.directiveNames()...)}}
+	for token := range LexWithOptions(strings.NewReader(config), options) {
+		require.NoError(t, token.Error)
+		got = append(got, token)
+	}
+	require.Equal(t, want, got)
+
+	// the Lexer is not left blocked on sending the tokens of a directive that is not read to the end
+	tokens = NewTokenizer(strings.NewReader(config), options)
+	for _, value := range []string{"content_by_lua_block", " ngx.say('hi') "} {
+		token, err := tokens.Next()
+		require.NoError(t, err)
+		require.Equal(t, value, token.Value)
+	}
+	tokens.stop()
+	_, err := tokens.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
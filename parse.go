@@ -8,6 +8,7 @@
 package crossplane
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 )
 
 //nolint:gochecknoglobals
@@ -41,6 +43,13 @@ func (c blockCtx) getLastBlock() string {
 type fileCtx struct {
 	path string
 	ctx  blockCtx
+	// files that include this file, from the main config file down to the direct includer
+	chain []string
+}
+
+// key identifies a file parsed in a specific block context.
+func (f fileCtx) key() string {
+	return f.path + "\x00" + f.ctx.key()
 }
 
 type parser struct {
@@ -48,11 +57,32 @@ type parser struct {
 	options         *ParseOptions
 	handleError     func(*Config, error)
 	includes        []fileCtx
+	current         fileCtx
 	included        map[string]int
 	includeEdges    map[string][]string
 	includeInDegree map[string]int
+	// end of the closing "}" of the most recently parsed block
+	blockEnd Position
+	// source of the file being parsed and the offset up to which it has been attributed
+	// to directives, only used when recording trivia
+	src     []byte
+	srcEnd  int
+	closing string
+	// results of the file being parsed, if files are parsed concurrently
+	deferred *fileResult
+	// cancellation and limits
+	context    context.Context
+	fatal      error
+	depth      int
+	directives int
+	steps      int
+	line       int
 }
 
+// cancelCheckInterval is the number of directives, closing braces and consumed tokens after which
+// the parser checks if its context is done, besides before each file, as Context.Err may take a lock.
+const cancelCheckInterval = 1024
+
 // MatchFunc is the signature of the match function used to identify NGINX directives that
 // can be encountered when parsing an NGINX configuration that references dynamic or
 // non-core modules. The argument is the name of a directive found when parsing an NGINX
@@ -93,6 +123,21 @@ type ParseOptions struct {
 	// If true, comments will be parsed and added to the resulting Payload.
 	ParseComments bool
 
+	// If true, the source range of every directive and of each of its arguments
+	// will be added to the resulting Payload.
+	ParseRanges bool
+
+	// If true, the whitespace, comments and quoting around the tokens of every directive
+	// will be recorded in the resulting Payload so that Build can write unmodified
+	// directives back exactly as they were parsed.
+	ParseTrivia bool
+
+	// If true, the errors of the resulting Payload are written to JSON with the structured form
+	// of their ParseError in a "parse_error" field next to their message, so that the statement,
+	// block context and column of the errors can be read back from JSON. The field is not part
+	// of the JSON written by Python crossplane.
+	StructuredErrors bool
+
 	// If true, add an error to the payload when encountering a directive that
 	// is unrecognized. The unrecognized directive will not be included in the
 	// resulting Payload.
@@ -104,17 +149,75 @@ type ParseOptions struct {
 	// If true, checks that directives have a valid number of arguments.
 	SkipDirectiveArgsCheck bool
 
+	// If true, checks the syntax of the regular expressions of location, server_name, rewrite,
+	// if and map directives, with RegexCaptures. Directives with an invalid regular expression
+	// are kept in the payload, but an error is added for them.
+	ValidateRegexes bool
+
+	// If set, adds an error for the directives that are not available in the edition or the version
+	// of nginx of the target, and for the directives that were removed or are deprecated in it, like
+	// "ssl" or "spdy_chunk_size". The directives are kept in the payload.
+	Target *Target
+
 	// MatchFuncs are called in order when an unknown or non-core NGINX directive is
 	// encountered by the parser to determine the valid contexts and argument count of the
 	// directive. Set this option to enable parsing of directives belonging to non-core or
 	// dynamic NGINX modules that follow the usual grammar rules of an NGINX configuration.
 	MatchFuncs []MatchFunc
+
+	// If set, directives are looked up in this Registry instead of in the directives of nginx and
+	// NGINX Plus known by the parser, before calling MatchFuncs.
+	Directives *Registry
+
+	// Contexts are the block contexts of third-party modules, whose directives are checked with the
+	// DirectiveSpecs of the Directives registry allowing them in these contexts. The masks of the
+	// directives of nginx and of MatchFuncs have no bits for these contexts, so Directives must be
+	// set when Contexts are.
+	Contexts []BlockContext
+
+	// MapBodies are the bodies of the map-like block directives of third-party modules, by the name
+	// of the directive. They take precedence over the map-like directives of nginx, like map or geo.
+	MapBodies map[string]MapBody
+
+	// LexOptions is used to customize the lexing of the configuration files, for example
+	// to register external lexers for directives whose arguments don't follow the usual
+	// grammar rules of an NGINX configuration, like the *_by_lua_block directives.
+	LexOptions LexOptions
+
+	// Limits on the configuration being parsed, a limit of 0 means no limit. When a limit
+	// is exceeded, parsing stops and Parse returns an error wrapping a *LimitError.
+
+	// MaxFileSize is the maximum size of a config file in bytes.
+	MaxFileSize int64
+
+	// MaxTokenLength is the maximum length of a token in bytes.
+	MaxTokenLength int
+
+	// MaxNestingDepth is the maximum number of nested blocks.
+	MaxNestingDepth int
+
+	// MaxIncludedFiles is the maximum number of files parsed in addition to the main config file.
+	MaxIncludedFiles int
+
+	// MaxDirectives is the maximum number of directives, including comments, in all of the files.
+	MaxDirectives int
+
+	// Concurrency is the number of files that are opened, lexed and parsed at the same time,
+	// files are parsed one after another if it is 0 or 1. The payload is the same either way,
+	// and ErrorCallback is called in the same order from the goroutine that called Parse,
+	// but Open and Glob must be safe for concurrent use.
+	Concurrency int
 }
 
 // Parse parses an NGINX configuration file.
-//
-//nolint:funlen
 func Parse(filename string, options *ParseOptions) (*Payload, error) {
+	return ParseContext(context.Background(), filename, options)
+}
+
+// ParseContext is like Parse, but stops parsing and returns the error of ctx once ctx is done.
+//
+//nolint:funlen,gocognit,gocyclo
+func ParseContext(ctx context.Context, filename string, options *ParseOptions) (*Payload, error) {
 	payload := &Payload{
 		Status: "ok",
 		Errors: []PayloadError{},
@@ -123,14 +226,32 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 	if options.Glob == nil {
 		options.Glob = filepath.Glob
 	}
+	if options.Target != nil {
+		if err := options.Target.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range options.Contexts {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(options.Contexts) > 0 && options.Directives == nil {
+		return nil, errors.New("block contexts require a Directives registry allowing directives in them")
+	}
+	for directive, body := range options.MapBodies {
+		if err := body.validate(directive); err != nil {
+			return nil, err
+		}
+	}
 
 	handleError := func(config *Config, err error) {
 		var line *int
 		if e, ok := err.(*ParseError); ok {
 			line = e.Line
 		}
-		cerr := ConfigError{Line: line, Error: err}
-		perr := PayloadError{Line: line, Error: err, File: config.File}
+		cerr := ConfigError{Line: line, Error: err, structured: options.StructuredErrors}
+		perr := PayloadError{Line: line, Error: err, File: config.File, structured: options.StructuredErrors}
 		if options.ErrorCallback != nil {
 			perr.Callback = options.ErrorCallback(err)
 		}
@@ -144,56 +265,215 @@ func Parse(filename string, options *ParseOptions) (*Payload, error) {
 	}
 
 	// Start with the main nginx config file/context.
+	main := fileCtx{path: filename, ctx: blockCtx{}}
 	p := parser{
+		context:     ctx,
 		configDir:   filepath.Dir(filename),
 		options:     options,
 		handleError: handleError,
-		includes:    []fileCtx{{path: filename, ctx: blockCtx{}}},
-		included:    map[string]int{filename: 0},
+		includes:    []fileCtx{main},
+		included:    map[string]int{main.key(): 0},
 		// adjacency list where an edge exists between a file and the file it includes
 		includeEdges: map[string][]string{},
 		// number of times a file is included by another file
 		includeInDegree: map[string]int{filename: 0},
 	}
 
+	var err error
+	if options.Concurrency > 1 && !options.SingleFile {
+		err = p.parseConcurrently(payload)
+	} else {
+		err = p.parseSequentially(payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isAcyclic() {
+		return nil, errors.New("configs contain include cycle")
+	}
+
+	if options.CombineConfigs {
+		return payload.Combined()
+	}
+
+	return payload, nil
+}
+
+func (p *parser) parseSequentially(payload *Payload) error {
 	for len(p.includes) > 0 {
 		incl := p.includes[0]
 		p.includes = p.includes[1:]
 
-		file, err := p.openFile(incl.path)
+		config, err := p.parseFile(incl)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		payload.Config = append(payload.Config, config)
+	}
+	return nil
+}
 
-		tokens := Lex(file)
-		config := Config{
-			File:   incl.path,
-			Status: "ok",
-			Errors: []ConfigError{},
-			Parsed: Directives{},
-		}
-		parsed, err := p.parse(&config, tokens, incl.ctx, false)
-		if err != nil {
-			if options.StopParsingOnError {
-				return nil, err
-			}
-			handleError(&config, err)
-		} else {
-			config.Parsed = parsed
-		}
+// parseFile parses a config file, the returned error stops the parsing of the payload.
+//
+//nolint:funlen
+func (p *parser) parseFile(incl fileCtx) (Config, error) {
+	p.current = incl
+	options := p.options
 
-		payload.Config = append(payload.Config, config)
+	if err := p.context.Err(); err != nil {
+		return Config{}, err
 	}
 
-	if p.isAcyclic() {
-		return nil, errors.New("configs contain include cycle")
+	file, err := p.openFile(incl.path)
+	if err != nil {
+		return Config{}, err
+	}
+	closeFile := func() {}
+	if c, ok := file.(io.Closer); ok {
+		closeFile = func() { _ = c.Close() }
+	}
+	if options.MaxFileSize > 0 {
+		file = &limitReader{r: file, limit: options.MaxFileSize, remaining: options.MaxFileSize}
+	}
+	lexOptions := options.LexOptions
+	lexOptions.maxTokenLength = options.MaxTokenLength
+	var tokens *Tokenizer
+	if options.ParseTrivia {
+		if p.src, err = io.ReadAll(file); err != nil {
+			closeFile()
+			return Config{}, err
+		}
+		p.srcEnd = 0
+		tokens = NewTokenizerBytes(p.src, lexOptions)
+	} else {
+		tokens = NewTokenizer(file, lexOptions)
+	}
+	config := Config{
+		File:   incl.path,
+		Status: "ok",
+		Errors: []ConfigError{},
+		Parsed: Directives{},
+	}
+	if len(incl.ctx) > 0 {
+		config.Context = append([]string{}, incl.ctx...)
+	}
+	parsed, err := p.parse(&config, tokens, incl.ctx, false)
+	tokens.stop()
+	closeFile()
+	if err != nil && p.fatal != nil {
+		return config, p.fatal
 	}
+	if err != nil {
+		if options.StopParsingOnError {
+			return config, err
+		}
+		p.handleError(&config, err)
+	} else {
+		config.Parsed = parsed
+	}
+	if options.ParseTrivia {
+		config.Trivia = &Trivia{Closing: p.source(len(p.src))}
+	}
+	return config, nil
+}
 
-	if options.CombineConfigs {
-		return payload.Combined()
+// fileResult is the outcome of parsing a file concurrently with other files.
+type fileResult struct {
+	incl       fileCtx
+	config     Config
+	err        error
+	errors     []error           // errors handled while parsing the file, in order
+	includes   []deferredInclude // include directives of the file, in order
+	directives int
+}
+
+// deferredInclude is an include directive whose files are added to the files to parse
+// once the files before it have been parsed.
+type deferredInclude struct {
+	stmt   *Directive
+	fnames []string
+	ctx    blockCtx
+	errors int // number of errors handled before the include directive
+}
+
+// parseConcurrently parses the files of the payload with up to options.Concurrency files being
+// parsed at the same time. The files are parsed independently, then their results are added to
+// the payload in the order the files are parsed sequentially, so the payload is the same.
+//
+//nolint:funlen
+func (p *parser) parseConcurrently(payload *Payload) error {
+	ctx, cancel := context.WithCancel(p.context)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	sem := make(chan struct{}, p.options.Concurrency)
+	var results []chan *fileResult
+	start := func(incl fileCtx) {
+		result := make(chan *fileResult, 1)
+		results = append(results, result)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := &fileResult{incl: incl}
+			w := &parser{
+				configDir:   p.configDir,
+				options:     p.options,
+				handleError: func(_ *Config, err error) { res.errors = append(res.errors, err) },
+				context:     ctx,
+				deferred:    res,
+			}
+			res.config, res.err = w.parseFile(incl)
+			res.directives = w.directives
+			result <- res
+		}()
 	}
 
-	return payload, nil
+	directives := 0
+	for i := 0; ; i++ {
+		for _, incl := range p.includes {
+			start(incl)
+		}
+		p.includes = p.includes[:0]
+		if i == len(results) {
+			return nil
+		}
+
+		res := <-results[i]
+		p.current = res.incl
+		if max := p.options.MaxDirectives; max > 0 && directives+res.directives > max {
+			// parse the file again to stop at the same directive as the sequential parse
+			p.directives = directives
+			if _, err := p.parseFile(res.incl); err != nil {
+				return err
+			}
+		}
+		directives += res.directives
+		if res.err != nil {
+			return res.err
+		}
+
+		handled := 0
+		for _, incl := range res.includes {
+			for ; handled < incl.errors; handled++ {
+				p.handleError(&res.config, res.errors[handled])
+			}
+			p.line = incl.stmt.Line
+			if err := p.addIncludes(&res.config, incl.stmt, incl.fnames, incl.ctx); err != nil {
+				return err
+			}
+		}
+		for ; handled < len(res.errors); handled++ {
+			p.handleError(&res.config, res.errors[handled])
+		}
+		payload.Config = append(payload.Config, res.config)
+	}
 }
 
 func (p *parser) openFile(path string) (io.Reader, error) {
@@ -207,30 +487,49 @@ func (p *parser) openFile(path string) (io.Reader, error) {
 // parse Recursively parses directives from an nginx config context.
 //
 //nolint:gocyclo,funlen,gocognit,maintidx,nonamedreturns
-func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, consume bool) (parsed Directives, err error) {
-	var tokenOk bool
+func (p *parser) parse(parsing *Config, tokens *Tokenizer, ctx blockCtx, consume bool) (parsed Directives, err error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	// the top level of a file is not nested, so its depth is 1
+	if max := p.options.MaxNestingDepth; max > 0 && p.depth > max+1 {
+		return nil, p.limitExceeded(parsing, ErrMaxNestingDepth, int64(max), ctx)
+	}
+
 	// parse recursively by pulling from a flat stream of tokens
-	for t := range tokens {
-		if t.Error != nil {
-			var perr *ParseError
-			if errors.As(t.Error, &perr) {
-				perr.File = &parsing.File
-				perr.BlockCtx = ctx.getLastBlock()
-				return nil, perr
-			}
-			return nil, &ParseError{
-				What:        t.Error.Error(),
-				File:        &parsing.File,
-				Line:        &t.Line,
-				originalErr: t.Error,
-				BlockCtx:    ctx.getLastBlock(),
+	for {
+		t, tokenOk := nextToken(tokens)
+		if !tokenOk {
+			break
+		}
+
+		// blocks that are consumed ignore errors, so errors that stop the parsing are checked here
+		if p.fatal != nil {
+			return nil, p.fatal
+		}
+		p.steps++
+		if p.steps%cancelCheckInterval == 0 {
+			if err := p.context.Err(); err != nil {
+				p.fatal = err
+				return nil, err
 			}
 		}
+		p.line = t.Line
+
+		if t.Error != nil {
+			return nil, p.tokenError(parsing, t, ctx)
+		}
 
 		var commentsInArgs []string
+		var commentRanges []Range
+		var quotedArgs []bool
 
 		// we are parsing a block, so break if it's closing
 		if t.Value == "}" && !t.IsQuoted {
+			p.blockEnd = t.Range.End
+			if p.options.ParseTrivia && !consume {
+				p.closing = p.source(t.Range.End.Offset)
+				p.srcEnd = t.Range.End.Offset
+			}
 			break
 		}
 
@@ -248,6 +547,11 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 			fileName = parsing.File
 		}
 
+		p.directives++
+		if max := p.options.MaxDirectives; max > 0 && p.directives > max {
+			return nil, p.limitExceeded(parsing, ErrMaxDirectives, int64(max), ctx)
+		}
+
 		// the first token should always be an nginx directive
 		stmt := &Directive{
 			Directive: t.Value,
@@ -255,6 +559,19 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 			Args:      []string{},
 			File:      fileName,
 		}
+		column := t.Range.Start.Column
+		if p.options.ParseRanges {
+			stmtRange := t.Range
+			stmt.Range = &stmtRange
+		}
+		var trivia *Trivia
+		stmtStart := t.Range.Start.Offset
+		if p.options.ParseTrivia {
+			trivia = &Trivia{
+				Leading: p.source(t.Range.Start.Offset),
+				Tokens:  []string{p.tokenSource(t)},
+			}
+		}
 
 		// if token is comment
 		if strings.HasPrefix(t.Value, "#") && !t.IsQuoted {
@@ -262,44 +579,71 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 				comment := t.Value[1:]
 				stmt.Directive = "#"
 				stmt.Comment = &comment
+				if trivia != nil {
+					trivia.Raw = p.slice(stmtStart, t.Range.End.Offset)
+					p.recordTrivia(stmt, trivia, t.Range.End.Offset)
+				}
 				parsed = append(parsed, stmt)
 			}
 			continue
 		}
 
 		// parse arguments by reading tokens
-		t, tokenOk = <-tokens
+		t, tokenOk = nextToken(tokens)
 		if !tokenOk {
 			return nil, &ParseError{
 				What:        ErrPrematureLexEnd.Error(),
 				File:        &parsing.File,
 				Line:        &stmt.Line,
+				Column:      &column,
 				originalErr: ErrPrematureLexEnd,
 				BlockCtx:    ctx.getLastBlock(),
 			}
 		}
+		if isLimitError(t.Error) {
+			return nil, p.tokenError(parsing, t, ctx)
+		}
 		for t.IsQuoted || (t.Value != "{" && t.Value != ";" && t.Value != "}") {
 			if !strings.HasPrefix(t.Value, "#") || t.IsQuoted {
 				stmt.Args = append(stmt.Args, t.Value)
+				if p.options.ParseRanges {
+					stmt.ArgRanges = append(stmt.ArgRanges, t.Range)
+					quotedArgs = append(quotedArgs, t.IsQuoted)
+				}
+				if trivia != nil {
+					trivia.Tokens = append(trivia.Tokens, p.tokenSource(t))
+				}
 			} else if p.options.ParseComments {
 				commentsInArgs = append(commentsInArgs, t.Value[1:])
+				commentRanges = append(commentRanges, t.Range)
 			}
-			t, tokenOk = <-tokens
+			t, tokenOk = nextToken(tokens)
 			if !tokenOk {
 				return nil, &ParseError{
 					What:        ErrPrematureLexEnd.Error(),
 					File:        &parsing.File,
 					Line:        &stmt.Line,
+					Column:      &column,
 					originalErr: ErrPrematureLexEnd,
 					BlockCtx:    ctx.getLastBlock(),
 				}
 			}
+			if isLimitError(t.Error) {
+				return nil, p.tokenError(parsing, t, ctx)
+			}
+		}
+		if stmt.Range != nil {
+			stmt.Range.End = t.Range.End
+		}
+		if trivia != nil {
+			trivia.Raw = p.slice(stmtStart, t.Range.End.Offset)
 		}
 
 		// if inside "map-like" block - add contents to payload, but do not parse further
 		if len(ctx) > 0 {
-			if _, ok := mapBodies[ctx[len(ctx)-1]]; ok {
-				mapErr := analyzeMapBody(parsing.File, stmt, t.Value, ctx[len(ctx)-1])
+			if isMapBody(ctx[len(ctx)-1], p.options) {
+				mapErr := analyzeMapBody(parsing.File, stmt, t.Value, ctx[len(ctx)-1], p.options)
+				setErrorColumn(mapErr, column)
 				if mapErr != nil && p.options.StopParsingOnError {
 					return nil, mapErr
 				} else if mapErr != nil {
@@ -310,6 +654,10 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 					}
 					continue
 				}
+				if err := p.analyzeRegexes(parsing, stmt, ctx, column); err != nil {
+					return nil, err
+				}
+				p.recordTrivia(stmt, trivia, t.Range.End.Offset)
 				parsed = append(parsed, stmt)
 				continue
 			}
@@ -326,6 +674,7 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 
 		// raise errors if this statement is invalid
 		err = analyze(parsing.File, stmt, t.Value, ctx, p.options)
+		setErrorColumn(err, column)
 
 		if perr, ok := err.(*ParseError); ok && !p.options.StopParsingOnError {
 			p.handleError(parsing, perr)
@@ -345,7 +694,14 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 
 		// prepare arguments - strip parentheses
 		if stmt.Directive == "if" {
-			stmt = prepareIfArgs(stmt)
+			stmt = prepareIfArgs(stmt, quotedArgs)
+		}
+
+		if err := p.analyzeRegexes(parsing, stmt, ctx, column); err != nil {
+			return nil, err
+		}
+		if err := p.analyzeTarget(parsing, stmt, ctx, column); err != nil {
+			return nil, err
 		}
 
 		// add "includes" to the payload if this is an include statement
@@ -359,6 +715,7 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 					),
 					File:      &parsing.File,
 					Line:      &stmt.Line,
+					Column:    &column,
 					Statement: stmt.String(),
 					BlockCtx:  ctx.getLastBlock(),
 				}
@@ -385,6 +742,7 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 						What:      err.Error(),
 						File:      &parsing.File,
 						Line:      &stmt.Line,
+						Column:    &column,
 						Statement: stmt.String(),
 						BlockCtx:  ctx.getLastBlock(),
 					}
@@ -401,50 +759,223 @@ func (p *parser) parse(parsing *Config, tokens <-chan NgxToken, ctx blockCtx, co
 				}
 			}
 
-			for _, fname := range fnames {
-				// the included set keeps files from being parsed twice
-				// TODO: handle files included from multiple contexts
-				if _, ok := p.included[fname]; !ok {
-					p.included[fname] = len(p.included)
-					p.includes = append(p.includes, fileCtx{fname, ctx})
-				}
-				stmt.Includes = append(stmt.Includes, p.included[fname])
-				// add edge between the current file and it's included file and
-				// increase the included file's in degree
-				p.includeEdges[parsing.File] = append(p.includeEdges[parsing.File], fname)
-				p.includeInDegree[fname]++
+			if p.deferred != nil {
+				p.deferred.includes = append(p.deferred.includes, deferredInclude{
+					stmt:   stmt,
+					fnames: fnames,
+					ctx:    append(blockCtx{}, ctx...),
+					errors: len(p.deferred.errors),
+				})
+			} else if err := p.addIncludes(parsing, stmt, fnames, ctx); err != nil {
+				return nil, err
 			}
 		}
 
 		// if this statement terminated with "{" then it is a block
+		p.recordTrivia(stmt, trivia, t.Range.End.Offset)
 		if t.Value == "{" && !t.IsQuoted {
 			stmt.Block = make(Directives, 0)
-			inner := enterBlockCtx(stmt, ctx) // get context for block
+			inner := enterBlockCtx(stmt, ctx, p.options.Contexts) // get context for block
 			blocks, err := p.parse(parsing, tokens, inner, false)
 			if err != nil {
 				return nil, err
 			}
 			stmt.Block = append(stmt.Block, blocks...)
+			if stmt.Range != nil {
+				stmt.Range.End = p.blockEnd
+			}
+			if trivia != nil {
+				trivia.Closing = p.closing
+			}
 		}
 
 		parsed = append(parsed, stmt)
 
 		// add all comments found inside args after stmt is added
-		for _, comment := range commentsInArgs {
+		for i, comment := range commentsInArgs {
 			comment := comment
-			parsed = append(parsed, &Directive{
+			d := &Directive{
 				Directive: "#",
 				Line:      stmt.Line,
 				Args:      []string{},
 				File:      fileName,
 				Comment:   &comment,
-			})
+			}
+			if p.options.ParseRanges {
+				d.Range = &commentRanges[i]
+			}
+			if trivia != nil {
+				// the comment is part of the raw source of the directive it was found in
+				d.Trivia = &Trivia{Inline: true, Values: []string{"#" + comment}}
+			}
+			parsed = append(parsed, d)
 		}
 	}
 
+	if p.fatal != nil {
+		return nil, p.fatal
+	}
 	return parsed, nil
 }
 
+// addIncludes adds the files included by an include directive to the files to parse.
+func (p *parser) addIncludes(parsing *Config, stmt *Directive, fnames []string, ctx blockCtx) error {
+	for _, fname := range fnames {
+		// add edge between the current file and it's included file and
+		// increase the included file's in degree
+		p.includeEdges[parsing.File] = append(p.includeEdges[parsing.File], fname)
+		p.includeInDegree[fname]++
+
+		// a file that includes itself, directly or not, would be parsed in ever deeper
+		// contexts, so stop here and let the cycle be reported by isAcyclic
+		if fname == p.current.path || contains(p.current.chain, fname) {
+			continue
+		}
+
+		// the included set keeps files from being parsed twice in the same context,
+		// a file included from different contexts is parsed once for each of them
+		incl := fileCtx{
+			path:  fname,
+			ctx:   append(blockCtx{}, ctx...),
+			chain: append(append([]string{}, p.current.chain...), p.current.path),
+		}
+		if _, ok := p.included[incl.key()]; !ok {
+			if max := p.options.MaxIncludedFiles; max > 0 && len(p.included) > max {
+				return p.limitExceeded(parsing, ErrMaxIncludedFiles, int64(max), ctx)
+			}
+			p.included[incl.key()] = len(p.included)
+			p.includes = append(p.includes, incl)
+		}
+		stmt.Includes = append(stmt.Includes, p.included[incl.key()])
+	}
+	return nil
+}
+
+// tokenError returns the error for a token that the lexer failed to read. Errors for exceeded
+// limits stop the parsing.
+func (p *parser) tokenError(parsing *Config, t NgxToken, ctx blockCtx) error {
+	var perr *ParseError
+	if errors.As(t.Error, &perr) {
+		perr.File = &parsing.File
+		perr.BlockCtx = ctx.getLastBlock()
+		return perr
+	}
+	perr = &ParseError{
+		What:        t.Error.Error(),
+		File:        &parsing.File,
+		Line:        &t.Line,
+		Column:      &t.Range.Start.Column,
+		originalErr: t.Error,
+		BlockCtx:    ctx.getLastBlock(),
+	}
+	if isLimitError(t.Error) {
+		p.fatal = perr
+	}
+	return perr
+}
+
+func isLimitError(err error) bool {
+	var lerr *LimitError
+	return errors.As(err, &lerr)
+}
+
+// nextToken returns the next token, ok is false once all of the tokens have been read.
+func nextToken(tokens *Tokenizer) (t NgxToken, ok bool) {
+	t, err := tokens.Next()
+	return t, !errors.Is(err, io.EOF)
+}
+
+// limitExceeded stops the parsing with an error for an exceeded limit.
+func (p *parser) limitExceeded(parsing *Config, err error, limit int64, ctx blockCtx) error {
+	line := p.line
+	lerr := &LimitError{Err: err, Limit: limit}
+	p.fatal = &ParseError{
+		What:        lerr.Error(),
+		File:        &parsing.File,
+		Line:        &line,
+		BlockCtx:    ctx.getLastBlock(),
+		originalErr: lerr,
+	}
+	return p.fatal
+}
+
+// source returns the source text from the end of the last directive with recorded trivia up to offset.
+func (p *parser) source(offset int) string {
+	return p.slice(p.srcEnd, offset)
+}
+
+// tokenSource returns the source text of a token, including its quotes.
+func (p *parser) tokenSource(t NgxToken) string {
+	return p.slice(t.Range.Start.Offset, t.Range.End.Offset)
+}
+
+// slice returns the source text between two offsets, tokens of external lexers
+// may come without a range so invalid offsets result in an empty string.
+func (p *parser) slice(start, end int) string {
+	if start < 0 || start > end || end > len(p.src) {
+		return ""
+	}
+	return string(p.src[start:end])
+}
+
+// recordTrivia attaches trivia to a directive that is added to the payload, which accounts
+// for the source text up to end.
+func (p *parser) recordTrivia(stmt *Directive, trivia *Trivia, end int) {
+	if trivia == nil {
+		return
+	}
+	if stmt.IsComment() {
+		trivia.Values = []string{"#" + *stmt.Comment}
+	} else {
+		trivia.Values = append([]string{stmt.Directive}, stmt.Args...)
+	}
+	stmt.Trivia = trivia
+	p.srcEnd = end
+}
+
+// analyzeRegexes checks the regular expressions of a directive if ValidateRegexes is set. The error
+// is returned if parsing must stop, otherwise it is handled and the directive is kept.
+func (p *parser) analyzeRegexes(parsing *Config, stmt *Directive, ctx blockCtx, column int) error {
+	if !p.options.ValidateRegexes {
+		return nil
+	}
+	err := analyzeRegexes(parsing.File, stmt, ctx)
+	if err == nil {
+		return nil
+	}
+	setErrorColumn(err, column)
+	if p.options.StopParsingOnError {
+		return err
+	}
+	p.handleError(parsing, err)
+	return nil
+}
+
+// analyzeTarget checks that a directive can be used with the Target of the options, if it is set. The error
+// is returned if parsing must stop, otherwise it is handled and the directive is kept.
+func (p *parser) analyzeTarget(parsing *Config, stmt *Directive, ctx blockCtx, column int) error {
+	if p.options.Target == nil {
+		return nil
+	}
+	err := analyzeTarget(parsing.File, stmt, ctx, p.options.Target)
+	if err == nil {
+		return nil
+	}
+	setErrorColumn(err, column)
+	if p.options.StopParsingOnError {
+		return err
+	}
+	p.handleError(parsing, err)
+	return nil
+}
+
+// setErrorColumn sets the column of a parse error raised for a directive to the column of the directive.
+func setErrorColumn(err error, column int) {
+	if perr, ok := err.(*ParseError); ok && perr.Column == nil {
+		perr.Column = &column
+	}
+}
+
 // isAcyclic performs a topological sort to check if there are cycles created by configs' includes.
 // First, it adds any files who are not being referenced by another file to a queue (in degree of 0).
 // For every file in the queue, it will remove the reference it has towards its neighbors.
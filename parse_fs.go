@@ -0,0 +1,77 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+)
+
+// ParseFS parses an NGINX configuration file from a file system, e.g. an embed.FS, a zip.Reader
+// or an os.DirFS. Included files are opened and globbed in fsys too: relative include paths are
+// relative to the directory of filename, and absolute include paths are relative to the root of fsys.
+// The Open and Glob fields of options are ignored, and the names of the files in the payload are
+// the paths that were parsed, so an absolute include keeps its leading "/".
+func ParseFS(fsys fs.FS, filename string, options *ParseOptions) (*Payload, error) {
+	opts := *options
+	opts.Open = func(p string) (io.Reader, error) {
+		name, err := fsPath(p)
+		if err != nil {
+			return nil, err
+		}
+		return fsys.Open(name)
+	}
+	opts.Glob = func(pattern string) ([]string, error) {
+		name, err := fsPath(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := fs.Glob(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(filepath.ToSlash(pattern), "/") {
+			for i, m := range matches {
+				matches[i] = "/" + m
+			}
+		}
+		return matches, nil
+	}
+	return Parse(filename, &opts)
+}
+
+// ParseFiles parses an NGINX configuration from memory, files maps the names of the files to
+// their contents and filename is the name of the main config file. The names are resolved like
+// the paths of ParseFS.
+func ParseFiles(files map[string]string, filename string, options *ParseOptions) (*Payload, error) {
+	fsys := make(fstest.MapFS, len(files))
+	for name, content := range files {
+		name, err := fsPath(name)
+		if err != nil {
+			return nil, err
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return ParseFS(fsys, filename, options)
+}
+
+// fsPath converts a path used by the parser to a path in a fs.FS, which is slash separated and unrooted.
+func fsPath(p string) (string, error) {
+	name := strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: p, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
@@ -0,0 +1,86 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFS(t *testing.T) {
+	t.Parallel()
+	fsys := os.DirFS(getTestConfigPath("includes-globbed"))
+
+	payload, err := ParseFS(fsys, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+
+	expected, err := Parse(getTestConfigPath("includes-globbed", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, len(expected.Config), len(payload.Config))
+	for i, config := range payload.Config {
+		require.Equal(t, getTestConfigPath("includes-globbed", config.File), expected.Config[i].File)
+		require.True(t, equalBlocks(expected.Config[i].Parsed, config.Parsed))
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"/etc/nginx/nginx.conf":              "events {}\nhttp {\n    include conf.d/*.conf;\n    include /etc/nginx/extra.conf;\n}\n",
+		"/etc/nginx/conf.d/a.conf":           "server { listen 8001; }\n",
+		"/etc/nginx/conf.d/b.conf":           "server { listen 8002; }\n",
+		"/etc/nginx/conf.d/ignored.conf.bak": "this is not included\n",
+		"/etc/nginx/extra.conf":              "gzip on;\n",
+	}
+
+	payload, err := ParseFiles(files, "/etc/nginx/nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "ok", payload.Status)
+
+	var names []string
+	for _, config := range payload.Config {
+		names = append(names, config.File)
+	}
+	require.Equal(t, []string{
+		"/etc/nginx/nginx.conf",
+		"/etc/nginx/conf.d/a.conf",
+		"/etc/nginx/conf.d/b.conf",
+		"/etc/nginx/extra.conf",
+	}, names)
+	require.Equal(t, []string{"8002"}, payload.Config[2].Parsed[0].Block[0].Args)
+
+	t.Run("relative paths", func(t *testing.T) {
+		t.Parallel()
+		payload, err := ParseFiles(map[string]string{
+			"nginx.conf":   "http { include inc/*.conf; }",
+			"inc/one.conf": "gzip on;",
+		}, "nginx.conf", &ParseOptions{})
+		require.NoError(t, err)
+		require.Len(t, payload.Config, 2)
+		require.Equal(t, "inc/one.conf", payload.Config[1].File)
+	})
+
+	t.Run("missing include", func(t *testing.T) {
+		t.Parallel()
+		payload, err := ParseFiles(map[string]string{
+			"nginx.conf": "http { include missing.conf; }",
+		}, "nginx.conf", &ParseOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "failed", payload.Status)
+		require.ErrorContains(t, payload.Errors[0].Error, "missing.conf")
+	})
+
+	t.Run("missing main file", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseFiles(map[string]string{}, "nginx.conf", &ParseOptions{})
+		require.Error(t, err)
+	})
+}
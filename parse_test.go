@@ -8,10 +8,14 @@
 package crossplane
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -57,6 +61,7 @@ var parseFixtures = []parseFixture{
 					),
 					pStr(getTestConfigPath("includes-regular", "conf.d", "server.conf")),
 					pInt(5),
+					nil,
 					"include bar.conf",
 					"server",
 					nil,
@@ -90,8 +95,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-regular", "conf.d", "server.conf"),
-				Status: "failed",
+				File:    getTestConfigPath("includes-regular", "conf.d", "server.conf"),
+				Status:  "failed",
+				Context: []string{"http"},
 				Errors: []ConfigError{
 					{
 						Error: &ParseError{
@@ -101,6 +107,7 @@ var parseFixtures = []parseFixture{
 							),
 							pStr(getTestConfigPath("includes-regular", "conf.d", "server.conf")),
 							pInt(5),
+							nil,
 							"include bar.conf",
 							"server",
 							nil,
@@ -140,8 +147,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-regular", "foo.conf"),
-				Status: "ok",
+				File:    getTestConfigPath("includes-regular", "foo.conf"),
+				Status:  "ok",
+				Context: []string{"http", "server"},
 				Parsed: Directives{
 					{
 						Directive: "location",
@@ -230,8 +238,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-globbed", "servers", "server1.conf"),
-				Status: "ok",
+				File:    getTestConfigPath("includes-globbed", "servers", "server1.conf"),
+				Status:  "ok",
+				Context: []string{"http"},
 				Parsed: Directives{
 					{
 						Directive: "server",
@@ -254,8 +263,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-globbed", "servers", "server2.conf"),
-				Status: "ok",
+				File:    getTestConfigPath("includes-globbed", "servers", "server2.conf"),
+				Status:  "ok",
+				Context: []string{"http"},
 				Parsed: Directives{
 					{
 						Directive: "server",
@@ -278,8 +288,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-globbed", "locations", "location1.conf"),
-				Status: "ok",
+				File:    getTestConfigPath("includes-globbed", "locations", "location1.conf"),
+				Status:  "ok",
+				Context: []string{"http", "server"},
 				Parsed: Directives{
 					{
 						Directive: "location",
@@ -296,8 +307,9 @@ var parseFixtures = []parseFixture{
 				},
 			},
 			{
-				File:   getTestConfigPath("includes-globbed", "locations", "location2.conf"),
-				Status: "ok",
+				File:    getTestConfigPath("includes-globbed", "locations", "location2.conf"),
+				Status:  "ok",
+				Context: []string{"http", "server"},
 				Parsed: Directives{
 					{
 						Directive: "location",
@@ -425,6 +437,101 @@ var parseFixtures = []parseFixture{
 			},
 		},
 	}},
+	{"includes-contexts", "", ParseOptions{}, Payload{
+		Status: "failed",
+		Errors: []PayloadError{
+			{
+				File: getTestConfigPath("includes-contexts", "shared.conf"),
+				Error: &ParseError{
+					`"keepalive_timeout" directive is not allowed here`,
+					pStr(getTestConfigPath("includes-contexts", "shared.conf")),
+					pInt(2),
+					nil,
+					"keepalive_timeout 5s",
+					"stream",
+					nil,
+				},
+				Line: pInt(2),
+			},
+		},
+		Config: []Config{
+			{
+				File:   getTestConfigPath("includes-contexts", "nginx.conf"),
+				Status: "ok",
+				Parsed: Directives{
+					{
+						Directive: "http",
+						Args:      []string{},
+						Line:      1,
+						Block: Directives{
+							{
+								Directive: "include",
+								Args:      []string{"shared.conf"},
+								Line:      2,
+								Includes:  []int{1},
+							},
+						},
+					},
+					{
+						Directive: "stream",
+						Args:      []string{},
+						Line:      4,
+						Block: Directives{
+							{
+								Directive: "include",
+								Args:      []string{"shared.conf"},
+								Line:      5,
+								Includes:  []int{2},
+							},
+						},
+					},
+				},
+			},
+			{
+				File:    getTestConfigPath("includes-contexts", "shared.conf"),
+				Status:  "ok",
+				Context: []string{"http"},
+				Parsed: Directives{
+					{
+						Directive: "resolver",
+						Args:      []string{"127.0.0.1"},
+						Line:      1,
+					},
+					{
+						Directive: "keepalive_timeout",
+						Args:      []string{"5s"},
+						Line:      2,
+					},
+				},
+			},
+			{
+				File:    getTestConfigPath("includes-contexts", "shared.conf"),
+				Status:  "failed",
+				Context: []string{"stream"},
+				Errors: []ConfigError{
+					{
+						Error: &ParseError{
+							`"keepalive_timeout" directive is not allowed here`,
+							pStr(getTestConfigPath("includes-contexts", "shared.conf")),
+							pInt(2),
+							nil,
+							"keepalive_timeout 5s",
+							"stream",
+							nil,
+						},
+						Line: pInt(2),
+					},
+				},
+				Parsed: Directives{
+					{
+						Directive: "resolver",
+						Args:      []string{"127.0.0.1"},
+						Line:      1,
+					},
+				},
+			},
+		},
+	}},
 	{"simple", "-ignore-directives-1", ParseOptions{IgnoreDirectives: []string{"listen", "server_name"}}, Payload{
 		Status: "ok",
 		Config: []Config{
@@ -706,6 +813,7 @@ var parseFixtures = []parseFixture{
 					`unknown directive "proxy_passs"`,
 					pStr(getTestConfigPath("spelling-mistake", "nginx.conf")),
 					pInt(7),
+					nil,
 					"proxy_passs http://foo.bar",
 					"location",
 					nil,
@@ -723,6 +831,7 @@ var parseFixtures = []parseFixture{
 							`unknown directive "proxy_passs"`,
 							pStr(getTestConfigPath("spelling-mistake", "nginx.conf")),
 							pInt(7),
+							nil,
 							"proxy_passs http://foo.bar",
 							"location",
 							nil,
@@ -777,6 +886,7 @@ var parseFixtures = []parseFixture{
 					`directive "proxy_pass" is not terminated by ";"`,
 					pStr(getTestConfigPath("missing-semicolon-above", "nginx.conf")),
 					pInt(4),
+					nil,
 					`proxy_pass http://is.broken.example`,
 					`location`,
 					nil,
@@ -794,6 +904,7 @@ var parseFixtures = []parseFixture{
 							`directive "proxy_pass" is not terminated by ";"`,
 							pStr(getTestConfigPath("missing-semicolon-above", "nginx.conf")),
 							pInt(4),
+							nil,
 							`proxy_pass http://is.broken.example`,
 							"location",
 							nil,
@@ -847,6 +958,7 @@ var parseFixtures = []parseFixture{
 					`directive "proxy_pass" is not terminated by ";"`,
 					pStr(getTestConfigPath("missing-semicolon-below", "nginx.conf")),
 					pInt(7),
+					nil,
 					`proxy_pass http://is.broken.example`,
 					"location",
 					nil,
@@ -864,6 +976,7 @@ var parseFixtures = []parseFixture{
 							`directive "proxy_pass" is not terminated by ";"`,
 							pStr(getTestConfigPath("missing-semicolon-below", "nginx.conf")),
 							pInt(7),
+							nil,
 							`proxy_pass http://is.broken.example`,
 							"location",
 							nil,
@@ -993,6 +1106,7 @@ var parseFixtures = []parseFixture{
 					`premature end of file`,
 					pStr(getTestConfigPath("premature-eof", "nginx.conf")),
 					pInt(3),
+					nil,
 					"",
 					"",
 					ErrPrematureLexEnd,
@@ -1010,6 +1124,7 @@ var parseFixtures = []parseFixture{
 							`premature end of file`,
 							pStr(getTestConfigPath("premature-eof", "nginx.conf")),
 							pInt(3),
+							nil,
 							"",
 							"",
 							ErrPrematureLexEnd,
@@ -1092,6 +1207,7 @@ var parseFixtures = []parseFixture{
 					`unexpected "{"`,
 					pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 					pInt(7),
+					nil,
 					"i_am_lost ",
 					"map",
 					nil,
@@ -1104,6 +1220,7 @@ var parseFixtures = []parseFixture{
 					`invalid number of parameters`,
 					pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 					pInt(10),
+					nil,
 					"too many params",
 					"map",
 					nil,
@@ -1116,6 +1233,7 @@ var parseFixtures = []parseFixture{
 					`invalid number of parameters`,
 					pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 					pInt(14),
+					nil,
 					"C0 ",
 					"charset_map",
 					nil,
@@ -1133,6 +1251,7 @@ var parseFixtures = []parseFixture{
 							`unexpected "{"`,
 							pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 							pInt(7),
+							nil,
 							"i_am_lost ",
 							"map",
 							nil,
@@ -1144,6 +1263,7 @@ var parseFixtures = []parseFixture{
 							`invalid number of parameters`,
 							pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 							pInt(10),
+							nil,
 							"too many params",
 							"map",
 							nil,
@@ -1155,6 +1275,7 @@ var parseFixtures = []parseFixture{
 							`invalid number of parameters`,
 							pStr(getTestConfigPath("invalid-map", "nginx.conf")),
 							pInt(14),
+							nil,
 							"C0 ",
 							"charset_map",
 							nil,
@@ -1763,9 +1884,331 @@ func TestCombinedIncludes(t *testing.T) {
 	}
 }
 
+func TestIncludesFromMultipleContexts(t *testing.T) {
+	t.Parallel()
+	path := getTestConfigPath("includes-cycle", "valid", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{StopParsingOnError: true})
+	require.NoError(t, err)
+
+	// location2.conf is included from a server block and from a location block
+	contexts := [][]string{}
+	for _, config := range payload.Config {
+		contexts = append(contexts, config.Context)
+	}
+	require.Equal(t, [][]string{
+		nil,
+		{"http", "server"},
+		{"http", "server"},
+		{"http", "location"},
+	}, contexts)
+	require.Equal(t, getTestConfigPath("includes-cycle", "valid", "location2.conf"), payload.Config[2].File)
+	require.Equal(t, getTestConfigPath("includes-cycle", "valid", "location2.conf"), payload.Config[3].File)
+	require.Equal(t, []int{3}, payload.Config[1].Parsed[0].Block[0].Includes)
+}
+
 func TestDefaultUbuntu(t *testing.T) {
 	t.Parallel()
 	path := getTestConfigPath("ubuntu-default", "nginx.conf")
 	_, err := Parse(path, &ParseOptions{SingleFile: false, StopParsingOnError: true})
 	require.NoError(t, err, "unexpected parsing error when reading test file: %s", path)
 }
+
+func TestParseRanges(t *testing.T) {
+	t.Parallel()
+	config := "server {\n    if ($a = b) { return 404; }\n}\n"
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(path, []byte("http {\n    include server.conf;\n}\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "server.conf"), []byte(config), 0o600))
+
+	payload, err := Parse(path, &ParseOptions{ParseRanges: true})
+	require.NoError(t, err)
+	require.Equal(t, "ok", payload.Status)
+
+	server := payload.Config[1].Parsed[0]
+	require.Equal(t, &Range{Start: Position{1, 1, 0}, End: Position{3, 2, 42}}, server.Range)
+
+	ifStmt := server.Block[0]
+	require.Equal(t, []string{"$a", "=", "b"}, ifStmt.Args)
+	require.Equal(t, &Range{Start: Position{2, 5, 13}, End: Position{2, 32, 40}}, ifStmt.Range)
+	require.Equal(t, []Range{
+		{Start: Position{2, 9, 17}, End: Position{2, 11, 19}},
+		{Start: Position{2, 12, 20}, End: Position{2, 13, 21}},
+		{Start: Position{2, 14, 22}, End: Position{2, 15, 23}},
+	}, ifStmt.ArgRanges)
+	for i, r := range ifStmt.ArgRanges {
+		require.Equal(t, ifStmt.Args[i], config[r.Start.Offset:r.End.Offset])
+	}
+
+	ret := ifStmt.Block[0]
+	require.Equal(t, "return 404;", config[ret.Range.Start.Offset:ret.Range.End.Offset])
+
+	// ranges are left out by default
+	payload, err = Parse(path, &ParseOptions{})
+	require.NoError(t, err)
+	b, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "range")
+}
+
+func TestParseRanges_quotedIfArgs(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		config string
+		args   []string
+		// text of the ranges of the arguments
+		texts []string
+	}{
+		"quoted first and last": {
+			config: `if "( $a" = 'b )' { }`,
+			args:   []string{"$a", "=", "b"},
+			texts:  []string{"$a", "=", "b"},
+		},
+		"quoted single": {
+			config: `if "($a)" { }`,
+			args:   []string{"$a"},
+			texts:  []string{"$a"},
+		},
+		"quoted inside parentheses": {
+			config: `if ("$a" = "(b") { }`,
+			args:   []string{`"$a"`, "=", "(b"},
+			texts:  []string{`"$a"`, "=", `"(b"`},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			config := "http {\n    server {\n        " + tc.config + "\n    }\n}\n"
+			payload, err := ParseFiles(map[string]string{"nginx.conf": config}, "nginx.conf", &ParseOptions{ParseRanges: true})
+			require.NoError(t, err)
+			ifStmt := payload.Config[0].Parsed[0].Block[0].Block[0]
+			require.Equal(t, tc.args, ifStmt.Args)
+			require.Len(t, ifStmt.ArgRanges, len(tc.texts))
+			for i, r := range ifStmt.ArgRanges {
+				require.Equal(t, tc.texts[i], config[r.Start.Offset:r.End.Offset])
+				require.Equal(t, r.Start.Offset-strings.LastIndex(config[:r.Start.Offset], "\n"), r.Start.Column)
+			}
+		})
+	}
+}
+
+func TestParseErrorColumn(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(path, []byte("http {\n  server { listen; }\n}\n"), 0o600))
+
+	_, err := Parse(path, &ParseOptions{StopParsingOnError: true})
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	require.Equal(t, 2, *perr.Line)
+	require.Equal(t, 12, *perr.Column)
+}
+
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": "events {}\nhttp {\n    server {\n        location / {\n            return 200 \"hello world\";\n" +
+			"        }\n    }\n    include conf.d/*.conf;\n}\n",
+		"conf.d/a.conf": "gzip on;\n",
+		"conf.d/b.conf": "gzip_comp_level 5;\n",
+	}
+
+	testcases := map[string]struct {
+		options ParseOptions
+		err     error
+	}{
+		"file size":      {options: ParseOptions{MaxFileSize: 64}, err: ErrMaxFileSize},
+		"token length":   {options: ParseOptions{MaxTokenLength: 8}, err: ErrMaxTokenLength},
+		"nesting depth":  {options: ParseOptions{MaxNestingDepth: 2}, err: ErrMaxNestingDepth},
+		"included files": {options: ParseOptions{MaxIncludedFiles: 1}, err: ErrMaxIncludedFiles},
+		"directives":     {options: ParseOptions{MaxDirectives: 6}, err: ErrMaxDirectives},
+		"file size with trivia": {
+			options: ParseOptions{MaxFileSize: 64, ParseTrivia: true},
+			err:     ErrMaxFileSize,
+		},
+		"nesting depth in ignored block": {
+			options: ParseOptions{MaxNestingDepth: 1, IgnoreDirectives: []string{"http"}},
+			err:     ErrMaxNestingDepth,
+		},
+		"within limits": {
+			options: ParseOptions{
+				MaxFileSize:      1024,
+				MaxTokenLength:   16,
+				MaxNestingDepth:  3,
+				MaxIncludedFiles: 2,
+				MaxDirectives:    8,
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			payload, err := ParseFiles(files, "nginx.conf", &tc.options)
+			if tc.err == nil {
+				require.NoError(t, err)
+				require.Equal(t, "ok", payload.Status)
+				return
+			}
+
+			require.ErrorIs(t, err, tc.err)
+			var lerr *LimitError
+			require.ErrorAs(t, err, &lerr)
+			for _, other := range []error{ErrMaxFileSize, ErrMaxTokenLength, ErrMaxNestingDepth, ErrMaxIncludedFiles, ErrMaxDirectives} {
+				if other != tc.err {
+					require.NotErrorIs(t, err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ParseContext(ctx, getTestConfigPath("simple", "nginx.conf"), &ParseOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	payload, err := ParseContext(context.Background(), getTestConfigPath("simple", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "ok", payload.Status)
+}
+
+// countingContext counts the calls to its Err method.
+type countingContext struct {
+	context.Context
+	calls int
+}
+
+func (c *countingContext) Err() error {
+	c.calls++
+	return c.Context.Err()
+}
+
+func TestParseContext_checks(t *testing.T) {
+	t.Parallel()
+	var conf strings.Builder
+	conf.WriteString("http {\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&conf, "    server { listen %d; server_name a b c; }\n", i)
+	}
+	conf.WriteString("}\n")
+
+	// http and its "}", then server, listen, server_name and "}" for each server
+	steps := 2 + 1000*4
+	ctx := &countingContext{Context: context.Background()}
+	open := func(string) (io.Reader, error) { return strings.NewReader(conf.String()), nil }
+	_, err := ParseContext(ctx, "nginx.conf", &ParseOptions{Open: open})
+	require.NoError(t, err)
+	// the context is checked before the file and every cancelCheckInterval directives, not for every token
+	require.Equal(t, 1+steps/cancelCheckInterval, ctx.calls)
+
+	// a context canceled while parsing still stops it
+	cctx, cancel := context.WithCancel(context.Background())
+	open = func(string) (io.Reader, error) {
+		cancel()
+		return strings.NewReader(conf.String()), nil
+	}
+	_, err = ParseContext(cctx, "nginx.conf", &ParseOptions{Open: open})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestParseConcurrency(t *testing.T) {
+	t.Parallel()
+
+	// a tree of included files, with files included from several contexts and some errors
+	files := map[string]string{
+		"nginx.conf": "events {}\nhttp {\n    include conf.d/*.conf;\n    server {\n        include snippets/*.conf;\n    }\n}\n" +
+			"stream {\n    include stream.d/*.conf;\n}\n",
+	}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("conf.d/%02d.conf", i)] = fmt.Sprintf(
+			"server {\n    listen %d;\n    include snippets/*.conf;\n    location /%d {\n        include snippets/common.conf;\n    }\n}\n",
+			8000+i, i)
+		files[fmt.Sprintf("snippets/%02d.conf", i)] = fmt.Sprintf("add_header X-Snippet %d;\n", i)
+		files[fmt.Sprintf("stream.d/%02d.conf", i)] = fmt.Sprintf("server { listen %d; }\n", 9000+i)
+	}
+	files["snippets/common.conf"] = "gzip on;\nunknown_directive;\n"
+	files["conf.d/07.conf"] += "listen;\n"
+	files["stream.d/03.conf"] += "http {}\n"
+
+	parse := func(options ParseOptions) (string, []string, error) {
+		var callbacks []string
+		options.ErrorCallback = func(err error) interface{} {
+			callbacks = append(callbacks, err.Error())
+			return len(callbacks)
+		}
+		payload, err := ParseFiles(files, "nginx.conf", &options)
+		if err != nil {
+			return "", callbacks, err
+		}
+		b, err := json.Marshal(payload)
+		require.NoError(t, err)
+		return string(b), callbacks, nil
+	}
+
+	testcases := map[string]ParseOptions{
+		"default":             {},
+		"comments and trivia": {ParseComments: true, ParseRanges: true, ParseTrivia: true},
+		"stop on error":       {StopParsingOnError: true},
+		"combined":            {CombineConfigs: true},
+		"included files":      {MaxIncludedFiles: 30},
+		"directives":          {MaxDirectives: 150},
+		"directives of main":  {MaxDirectives: 5},
+	}
+
+	for name, options := range testcases {
+		options := options
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			expected, expectedCallbacks, expectedErr := parse(options)
+			for _, n := range []int{2, 4, 64} {
+				concurrent := options
+				concurrent.Concurrency = n
+				for i := 0; i < 5; i++ {
+					got, callbacks, err := parse(concurrent)
+					if expectedErr != nil {
+						require.EqualError(t, err, expectedErr.Error())
+					} else {
+						require.NoError(t, err)
+					}
+					require.Equal(t, expected, got)
+					require.Equal(t, expectedCallbacks, callbacks)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConcurrency_fixtures(t *testing.T) {
+	t.Parallel()
+	for _, fixture := range parseFixtures {
+		fixture := fixture
+		t.Run(fixture.name+fixture.suffix, func(t *testing.T) {
+			t.Parallel()
+			options := fixture.options
+			options.Concurrency = 4
+			path := getTestConfigPath(fixture.name, "nginx.conf")
+			payload, err := Parse(path, &options)
+			require.NoError(t, err)
+			if !equalPayloads(t, *payload, fixture.expected) {
+				b1, _ := json.Marshal(fixture.expected)
+				b2, _ := json.Marshal(payload)
+				t.Fatalf("expected: %s\nbut got: %s", b1, b2)
+			}
+		})
+	}
+
+	t.Run("include cycle", func(t *testing.T) {
+		t.Parallel()
+		path := getTestConfigPath("includes-cycle", "invalid", "nginx.conf")
+		_, expected := Parse(path, &ParseOptions{})
+		require.Error(t, expected)
+		_, err := Parse(path, &ParseOptions{Concurrency: 4})
+		require.EqualError(t, err, expected.Error())
+	})
+}
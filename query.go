@@ -0,0 +1,348 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Selector is a compiled query for finding directives, see CompileSelector for its syntax.
+type Selector struct {
+	expr  string
+	steps []selectorStep
+}
+
+type selectorStep struct {
+	name       string // directive name, or "*" for any directive
+	preds      []selectorPred
+	descendant bool // true if the step is a descendant of the step before it, false if it is a child
+}
+
+type selectorPred struct {
+	attr  string // argument index, "args" for any argument, or the name of a child directive
+	op    string // empty if the predicate only checks existence
+	value string
+	re    *regexp.Regexp
+}
+
+// Match is a directive found by a query.
+type Match struct {
+	Directive *Directive
+	// File is the config file the directive belongs to.
+	File string
+	// Line is the line of the directive in File.
+	Line int
+	// Parents holds the blocks the directive is in, outermost first.
+	Parents Directives
+}
+
+// CompileSelector compiles a selector expression. A selector is a list of directive names, separated
+// by whitespace to match descendants or by ">" to match direct children, e.g.
+//
+//	http > server[server_name~=example.com] location proxy_pass
+//
+// matches all proxy_pass directives in location blocks of server blocks directly in the http block,
+// if the server has a server_name with an argument matching the regular expression "example.com".
+// A name of "*" matches any directive. Each name can be followed by predicates in brackets:
+//
+//	[N op value]     the Nth argument of the directive, starting at 0
+//	[args op value]  any argument of the directive
+//	[name op value]  any argument of a child directive with that name
+//	[name]           the block has a child directive with that name
+//
+// where op is one of "=" (equal), "!=" (not equal), "^=" (prefix), "$=" (suffix), "*=" (substring)
+// and "~=" (regular expression). The value may be quoted with single or double quotes.
+func CompileSelector(expr string) (*Selector, error) {
+	s := &Selector{expr: expr}
+	descendant := true
+
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '>':
+			if len(s.steps) == 0 || !descendant {
+				return nil, fmt.Errorf("invalid selector %q: unexpected \">\" at offset %d", expr, i)
+			}
+			descendant = false
+			i++
+		case c == '[' || c == ']':
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q at offset %d", expr, c, i)
+		default:
+			step := selectorStep{descendant: descendant}
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n>[]", rune(expr[i])) {
+				i++
+			}
+			step.name = expr[start:i]
+			for i < len(expr) && expr[i] == '[' {
+				pred, n, err := compilePred(expr[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+				}
+				step.preds = append(step.preds, pred)
+				i += n + 1
+			}
+			s.steps = append(s.steps, step)
+			// the step right after this one is a descendant unless ">" is found
+			descendant = true
+			// a predicate must be followed by a separator
+			if i < len(expr) && !strings.ContainsRune(" \t\n>", rune(expr[i])) {
+				return nil, fmt.Errorf("invalid selector %q: unexpected %q at offset %d", expr, expr[i], i)
+			}
+			continue
+		}
+		if i == len(expr) && !descendant {
+			return nil, fmt.Errorf("invalid selector %q: expected directive after \">\"", expr)
+		}
+	}
+
+	if len(s.steps) == 0 {
+		return nil, fmt.Errorf("invalid selector %q: empty selector", expr)
+	}
+	return s, nil
+}
+
+// compilePred compiles the predicate at the start of s, which follows a "[". It returns the number
+// of bytes read, including the closing "]".
+//
+//nolint:gocognit
+func compilePred(s string) (selectorPred, int, error) {
+	var pred selectorPred
+	i := 0
+	for i < len(s) && !strings.ContainsRune("=!^$*~]", rune(s[i])) {
+		i++
+	}
+	pred.attr = strings.TrimSpace(s[:i])
+	if pred.attr == "" {
+		return pred, 0, fmt.Errorf("missing name in predicate")
+	}
+	if i == len(s) {
+		return pred, 0, fmt.Errorf("unterminated predicate")
+	}
+	if s[i] == ']' {
+		return pred, i + 1, nil
+	}
+
+	// operator
+	if s[i] == '=' {
+		pred.op = "="
+		i++
+	} else if i+1 < len(s) && s[i+1] == '=' {
+		pred.op = s[i : i+2]
+		i += 2
+	} else {
+		return pred, 0, fmt.Errorf("invalid operator in predicate %q", pred.attr)
+	}
+
+	// value, optionally quoted
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+		end := strings.IndexByte(s[i+1:], s[i])
+		if end < 0 {
+			return pred, 0, fmt.Errorf("unterminated quote in predicate %q", pred.attr)
+		}
+		pred.value = s[i+1 : i+1+end]
+		i += end + 2
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i == len(s) || s[i] != ']' {
+			return pred, 0, fmt.Errorf("unterminated predicate %q", pred.attr)
+		}
+	} else {
+		end := strings.IndexByte(s[i:], ']')
+		if end < 0 {
+			return pred, 0, fmt.Errorf("unterminated predicate %q", pred.attr)
+		}
+		pred.value = strings.TrimSpace(s[i : i+end])
+		i += end
+	}
+
+	if pred.op == "~=" {
+		re, err := regexp.Compile(pred.value)
+		if err != nil {
+			return pred, 0, fmt.Errorf("invalid regular expression in predicate %q: %w", pred.attr, err)
+		}
+		pred.re = re
+	}
+	return pred, i + 1, nil
+}
+
+// String returns the expression the selector was compiled from.
+func (s *Selector) String() string {
+	return s.expr
+}
+
+func (p *selectorPred) matchValue(v string) bool {
+	switch p.op {
+	case "=":
+		return v == p.value
+	case "!=":
+		return v != p.value
+	case "^=":
+		return strings.HasPrefix(v, p.value)
+	case "$=":
+		return strings.HasSuffix(v, p.value)
+	case "*=":
+		return strings.Contains(v, p.value)
+	case "~=":
+		return p.re.MatchString(v)
+	}
+	return false
+}
+
+func (p *selectorPred) matchAny(args []string) bool {
+	for _, arg := range args {
+		if p.matchValue(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *selectorPred) match(d *Directive, children func(*Directive) Directives) bool {
+	if n, err := strconv.Atoi(p.attr); err == nil {
+		return n >= 0 && n < len(d.Args) && (p.op == "" || p.matchValue(d.Args[n]))
+	}
+	if p.attr == "args" {
+		return p.op == "" && len(d.Args) > 0 || p.matchAny(d.Args)
+	}
+	for _, child := range children(d) {
+		if child.Directive == p.attr && (p.op == "" || p.matchAny(child.Args)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *selectorStep) match(d *Directive, children func(*Directive) Directives) bool {
+	if st.name != "*" && st.name != d.Directive {
+		return false
+	}
+	for i := range st.preds {
+		if !st.preds[i].match(d, children) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether a directive with the given parents, outermost first, is selected.
+func (s *Selector) match(d *Directive, parents Directives, children func(*Directive) Directives) bool {
+	last := len(s.steps) - 1
+	if !s.steps[last].match(d, children) {
+		return false
+	}
+	return s.matchParents(last, parents, children)
+}
+
+// matchParents reports whether the steps before step i match the parents of the directive matched by step i.
+func (s *Selector) matchParents(i int, parents Directives, children func(*Directive) Directives) bool {
+	if i == 0 {
+		return true
+	}
+	if !s.steps[i].descendant {
+		n := len(parents) - 1
+		return n >= 0 && s.steps[i-1].match(parents[n], children) && s.matchParents(i-1, parents[:n], children)
+	}
+	for n := len(parents) - 1; n >= 0; n-- {
+		if s.steps[i-1].match(parents[n], children) && s.matchParents(i-1, parents[:n], children) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the directives of the payload matched by the selector, in the order Walk visits them.
+// If followIncludes is true, the directives of included configs are treated as if they were in the
+// block of the include directive, both for matching the directives and for checking predicates,
+// and the include directives themselves are not matched.
+func (p *Payload) Query(s *Selector, followIncludes bool) []Match {
+	children := func(d *Directive) Directives { return d.Block }
+	if followIncludes {
+		children = func(d *Directive) Directives { return p.expandIncludes(d.Block, nil) }
+	}
+
+	var matches []Match
+	p.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if followIncludes && d.IsInclude() {
+			return true
+		}
+		parents := blockParents(ctx.Parents)
+		if s.match(d, parents, children) {
+			matches = append(matches, Match{Directive: d, File: ctx.Config.File, Line: d.Line, Parents: parents})
+		}
+		return true
+	}, followIncludes)
+	return matches
+}
+
+// Query returns the directives matched by the selector, in the order Walk visits them.
+func (ds Directives) Query(s *Selector) []Match {
+	children := func(d *Directive) Directives { return d.Block }
+
+	var matches []Match
+	ds.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		parents := blockParents(ctx.Parents)
+		if s.match(d, parents, children) {
+			matches = append(matches, Match{Directive: d, File: d.File, Line: d.Line, Parents: parents})
+		}
+		return true
+	})
+	return matches
+}
+
+// locate returns where a directive is in the payload, following includes, as if it was matched by a query.
+func (p *Payload) locate(target *Directive) (Match, bool) {
+	var m Match
+	found := false
+	p.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if d == target {
+			m = Match{Directive: d, File: ctx.Config.File, Line: d.Line, Parents: blockParents(ctx.Parents)}
+			found = true
+		}
+		return !found
+	}, true)
+	return m, found
+}
+
+// blockParents returns a copy of the parents that are blocks, leaving out include directives.
+func blockParents(parents Directives) Directives {
+	blocks := make(Directives, 0, len(parents))
+	for _, d := range parents {
+		if d.IsBlock() {
+			blocks = append(blocks, d)
+		}
+	}
+	return blocks
+}
+
+// expandIncludes returns the block with include directives replaced by the directives of the configs
+// they include, configs already being expanded are skipped to break include cycles.
+func (p *Payload) expandIncludes(block Directives, expanding []int) Directives {
+	var expanded Directives
+	for _, d := range block {
+		if !d.IsInclude() {
+			expanded = append(expanded, d)
+			continue
+		}
+		for _, idx := range d.Includes {
+			if idx < 0 || idx >= len(p.Config) || containsInt(expanding, idx) {
+				continue
+			}
+			expanded = append(expanded, p.expandIncludes(p.Config[idx].Parsed, append(expanding, idx))...)
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,127 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload_Query(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("query", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	testcases := map[string]struct {
+		selector       string
+		followIncludes bool
+		expected       []string
+	}{
+		"descendant": {
+			selector: "http proxy_pass",
+			expected: []string{"nginx.conf:5 http://backend", "nginx.conf:14 http://other"},
+		},
+		"follow includes": {
+			selector:       "http proxy_pass",
+			followIncludes: true,
+			expected:       []string{"nginx.conf:5 http://backend", "api.conf:1 http://api", "nginx.conf:14 http://other"},
+		},
+		"child": {
+			selector: "http > proxy_pass",
+			expected: nil,
+		},
+		"child directive regex": {
+			selector:       "http > server[server_name~=example\\.com] location proxy_pass",
+			followIncludes: true,
+			expected:       []string{"nginx.conf:5 http://backend", "api.conf:1 http://api"},
+		},
+		"arg index": {
+			selector:       "location[0=/api] *",
+			followIncludes: true,
+			expected:       []string{"api.conf:1 http://api"},
+		},
+		"quoted value": {
+			selector: `server[server_name="other.org"] > location > proxy_pass`,
+			expected: []string{"nginx.conf:14 http://other"},
+		},
+		"any arg": {
+			selector: "server_name[args$=.org]",
+			expected: []string{"nginx.conf:12 other.org"},
+		},
+		"child directive exists": {
+			selector:       "location[proxy_pass]",
+			followIncludes: true,
+			expected:       []string{"nginx.conf:4 /", "nginx.conf:7 /api", "nginx.conf:13 /"},
+		},
+		"not equal": {
+			selector: "location[0!=/] > include",
+			expected: []string{"nginx.conf:8 api.conf"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s, err := CompileSelector(tc.selector)
+			require.NoError(t, err)
+
+			var got []string
+			for _, m := range payload.Query(s, tc.followIncludes) {
+				got = append(got, fmt.Sprintf("%s:%d %s", filepath.Base(m.File), m.Line, m.Directive.Args[0]))
+			}
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestDirectives_Query(t *testing.T) {
+	t.Parallel()
+	block := Directives{
+		{Directive: "http", Block: Directives{
+			{Directive: "server", Block: Directives{
+				{Directive: "listen", Args: []string{"80"}, Line: 3},
+				{Directive: "listen", Args: []string{"443", "ssl"}, Line: 4},
+			}},
+		}},
+	}
+	s, err := CompileSelector("server > listen[args=ssl]")
+	require.NoError(t, err)
+
+	matches := block.Query(s)
+	require.Len(t, matches, 1)
+	require.Equal(t, 4, matches[0].Line)
+	require.Equal(t, []string{"http", "server"}, []string{matches[0].Parents[0].Directive, matches[0].Parents[1].Directive})
+}
+
+func TestCompileSelector_invalid(t *testing.T) {
+	t.Parallel()
+	for _, expr := range []string{
+		"",
+		"> server",
+		"http >",
+		"http > > server",
+		"server[",
+		"server[server_name",
+		"server[=foo]",
+		"server[server_name!foo]",
+		"server[server_name='foo]",
+		"server[server_name~=(]",
+		"server[0=a]x",
+	} {
+		expr := expr
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+			_, err := CompileSelector(expr)
+			require.Error(t, err)
+		})
+	}
+}
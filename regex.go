@@ -0,0 +1,526 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RegexError is returned by RegexCaptures for an invalid regular expression.
+type RegexError struct {
+	What string
+	// Offset is the offset in bytes in the regular expression where the error was found.
+	Offset int
+}
+
+func (e *RegexError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.What, e.Offset)
+}
+
+// RegexCaptures checks the syntax of a regular expression of an nginx config, which nginx compiles
+// with PCRE, and returns the number of its capture groups, named groups included. Regular expressions
+// that PCRE would reject, like ones with unbalanced parentheses, unknown escapes or misplaced quantifiers,
+// return a *RegexError. The check is syntactic only, the character properties and the names of the
+// POSIX classes used are not checked.
+func RegexCaptures(expr string) (int, error) {
+	r := &regexChecker{expr: expr, names: map[string]bool{}}
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	return r.captures, nil
+}
+
+type regexChecker struct {
+	expr     string
+	pos      int
+	captures int
+	names    map[string]bool
+	// offsets of the open groups
+	groups []int
+	// whether a quantifier may follow
+	repeatable bool
+	// the highest group number of a backreference and where it is
+	maxRef, maxRefPos int
+}
+
+func (r *regexChecker) fail(offset int, format string, args ...interface{}) error {
+	return &RegexError{What: fmt.Sprintf(format, args...), Offset: offset}
+}
+
+//nolint:gocyclo,funlen
+func (r *regexChecker) check() error {
+	for r.pos < len(r.expr) {
+		c := r.expr[r.pos]
+		start := r.pos
+		r.pos++
+		switch c {
+		case '\\':
+			if err := r.escape(false); err != nil {
+				return err
+			}
+		case '[':
+			if err := r.class(start); err != nil {
+				return err
+			}
+			r.repeatable = true
+		case '(':
+			if err := r.group(start); err != nil {
+				return err
+			}
+		case ')':
+			if len(r.groups) == 0 {
+				return r.fail(start, "unmatched closing parenthesis")
+			}
+			r.groups = r.groups[:len(r.groups)-1]
+			r.repeatable = true
+		case '|', '^', '$':
+			// anchors can't be repeated either
+			r.repeatable = false
+		case '*', '+', '?':
+			if !r.repeatable {
+				return r.fail(start, "quantifier does not follow a repeatable item")
+			}
+			r.quantified()
+		case '{':
+			lo, hi, ok := r.interval()
+			if !ok {
+				// a "{" that does not start a quantifier is a literal
+				r.repeatable = true
+				continue
+			}
+			if !r.repeatable {
+				return r.fail(start, "quantifier does not follow a repeatable item")
+			}
+			if lo > 65535 || hi > 65535 {
+				return r.fail(start, "number too big in {} quantifier")
+			}
+			if hi >= 0 && hi < lo {
+				return r.fail(start, "numbers out of order in {} quantifier")
+			}
+			r.quantified()
+		default:
+			r.repeatable = true
+		}
+	}
+
+	if len(r.groups) > 0 {
+		return r.fail(len(r.expr), "missing closing parenthesis")
+	}
+	if r.maxRef > r.captures {
+		return r.fail(r.maxRefPos, "reference to non-existent subpattern")
+	}
+	return nil
+}
+
+// quantified skips the "?" or "+" that make a quantifier lazy or possessive.
+func (r *regexChecker) quantified() {
+	if r.pos < len(r.expr) && (r.expr[r.pos] == '?' || r.expr[r.pos] == '+') {
+		r.pos++
+	}
+	r.repeatable = false
+}
+
+// interval parses a quantifier like "{2}", "{2,}" or "{2,5}" after its "{", hi is -1 if it has no maximum.
+func (r *regexChecker) interval() (lo, hi int, ok bool) {
+	end := strings.IndexByte(r.expr[r.pos:], '}')
+	if end < 0 {
+		return 0, 0, false
+	}
+	from, to, comma := strings.Cut(r.expr[r.pos:r.pos+end], ",")
+	if !isDigits(from) || (to != "" && !isDigits(to)) {
+		return 0, 0, false
+	}
+	lo, hi = atoiOr(from, 1<<20), -1
+	if !comma {
+		hi = lo
+	} else if to != "" {
+		hi = atoiOr(to, 1<<20)
+	}
+	r.pos += end + 1
+	return lo, hi, true
+}
+
+// escape checks an escape sequence after its "\".
+//
+//nolint:gocyclo
+func (r *regexChecker) escape(inClass bool) error {
+	start := r.pos - 1
+	if r.pos == len(r.expr) {
+		return r.fail(start, `\ at end of pattern`)
+	}
+	c := r.expr[r.pos]
+	r.pos++
+	r.repeatable = true
+
+	switch {
+	case c == 'Q':
+		// quoted until \E
+		if end := strings.Index(r.expr[r.pos:], `\E`); end >= 0 {
+			r.pos += end + 2
+		} else {
+			r.pos = len(r.expr)
+		}
+	case c == 'x':
+		if r.pos < len(r.expr) && r.expr[r.pos] == '{' {
+			return r.braced(start, isHex)
+		}
+		for i := 0; i < 2 && r.pos < len(r.expr) && isHex(r.expr[r.pos]); i++ {
+			r.pos++
+		}
+	case c == 'o':
+		if r.pos == len(r.expr) || r.expr[r.pos] != '{' {
+			return r.fail(start, `missing opening brace after \o`)
+		}
+		return r.braced(start, func(c byte) bool { return c >= '0' && c <= '7' })
+	case c == 'c':
+		if r.pos == len(r.expr) {
+			return r.fail(start, `\c at end of pattern`)
+		}
+		r.pos++
+	case c == 'p' || c == 'P':
+		if r.pos == len(r.expr) {
+			return r.fail(start, `malformed \P or \p sequence`)
+		}
+		if r.expr[r.pos] == '{' {
+			return r.braced(start, func(c byte) bool { return c != '}' })
+		}
+		r.pos++
+	case c == 'k' && !inClass:
+		return r.reference(start)
+	case c == 'g' && !inClass:
+		return r.reference(start)
+	case c >= '1' && c <= '9' && !inClass:
+		// a number of two digits or more that starts with an octal digit is a character code unless
+		// as many groups come before it
+		end := r.pos
+		for end < len(r.expr) && r.expr[end] >= '0' && r.expr[end] <= '9' {
+			end++
+		}
+		num := atoiOr(r.expr[start+1:end], 1<<20)
+		if num < 10 || num <= r.captures || c >= '8' {
+			r.pos = end
+			r.addRef(start, num)
+			break
+		}
+		fallthrough
+	case c >= '0' && c <= '9':
+		// octal
+		for i := 0; i < 2 && r.pos < len(r.expr) && r.expr[r.pos] >= '0' && r.expr[r.pos] <= '7'; i++ {
+			r.pos++
+		}
+	case c == 'b' || c == 'B' || c == 'A' || c == 'z' || c == 'Z' || c == 'G' || c == 'K':
+		if inClass && c != 'b' {
+			return r.fail(start, `escape sequence is invalid in character class`)
+		}
+	case strings.IndexByte("dDwWsShHvVnrtfaeE", c) >= 0:
+	case strings.IndexByte("RXNC", c) >= 0:
+		if inClass {
+			return r.fail(start, `escape sequence is invalid in character class`)
+		}
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		// unknown letters are errors, other escaped characters like "\_" or "\/" are literals
+		return r.fail(start, `unrecognized character follows \`)
+	}
+	return nil
+}
+
+// braced skips a "{...}" of an escape sequence, checking its characters with valid.
+func (r *regexChecker) braced(start int, valid func(c byte) bool) error {
+	end := strings.IndexByte(r.expr[r.pos:], '}')
+	if end < 2 {
+		return r.fail(start, "malformed escape sequence")
+	}
+	for i := r.pos + 1; i < r.pos+end; i++ {
+		if !valid(r.expr[i]) {
+			return r.fail(start, "malformed escape sequence")
+		}
+	}
+	r.pos += end + 1
+	return nil
+}
+
+// reference checks a backreference like \k<name>, \k{name}, \g1, \g{-1} or \g<name>.
+func (r *regexChecker) reference(start int) error {
+	if r.pos == len(r.expr) {
+		return r.fail(start, `\k or \g is not followed by a braced, angle-bracketed or quoted name or number`)
+	}
+	open := r.expr[r.pos]
+	closing := map[byte]byte{'<': '>', '{': '}', '\'': '\''}[open]
+	if closing == 0 {
+		// \g followed by a number
+		end := r.pos
+		if end < len(r.expr) && (r.expr[end] == '-' || r.expr[end] == '+') {
+			end++
+		}
+		for end < len(r.expr) && r.expr[end] >= '0' && r.expr[end] <= '9' {
+			end++
+		}
+		ref := r.expr[r.pos:end]
+		if r.expr[start+1] == 'k' || ref == "" || ref == "-" || ref == "+" {
+			return r.fail(start, `\k or \g is not followed by a braced, angle-bracketed or quoted name or number`)
+		}
+		r.pos = end
+		if n, err := strconv.Atoi(ref); err == nil && n > 0 && ref[0] != '+' {
+			r.addRef(start, n)
+		}
+		return nil
+	}
+	end := strings.IndexByte(r.expr[r.pos+1:], closing)
+	if end <= 0 {
+		return r.fail(start, `\k or \g is not followed by a braced, angle-bracketed or quoted name or number`)
+	}
+	ref := r.expr[r.pos+1 : r.pos+1+end]
+	r.pos += end + 2
+	if n, err := strconv.Atoi(ref); err == nil && n > 0 {
+		r.addRef(start, n)
+	}
+	return nil
+}
+
+func (r *regexChecker) addRef(start, n int) {
+	if n > r.maxRef {
+		r.maxRef, r.maxRefPos = n, start
+	}
+}
+
+// class checks a character class after its "[".
+func (r *regexChecker) class(start int) error {
+	if r.pos < len(r.expr) && r.expr[r.pos] == '^' {
+		r.pos++
+	}
+	// a "]" first in the class is a literal
+	if r.pos < len(r.expr) && r.expr[r.pos] == ']' {
+		r.pos++
+	}
+
+	prev := -1
+	for r.pos < len(r.expr) {
+		c := r.expr[r.pos]
+		r.pos++
+		switch {
+		case c == ']':
+			return nil
+		case c == '[' && r.pos < len(r.expr) && strings.IndexByte(":.=", r.expr[r.pos]) >= 0:
+			// a POSIX class like [:alpha:]
+			delim := r.expr[r.pos]
+			if end := strings.Index(r.expr[r.pos+1:], string(delim)+"]"); end >= 0 {
+				r.pos += end + 3
+				prev = -1
+				continue
+			}
+			prev = int(c)
+		case c == '\\':
+			escStart := r.pos
+			if err := r.escape(true); err != nil {
+				return err
+			}
+			prev = -1
+			if r.pos == escStart+1 && !isVariableChar(r.expr[escStart]) {
+				prev = int(r.expr[escStart])
+			}
+		case c == '-' && prev >= 0 && r.pos < len(r.expr) && r.expr[r.pos] != ']':
+			next := int(r.expr[r.pos])
+			if next == '\\' && r.pos+1 < len(r.expr) && strings.IndexByte("dDwWsShHvVpPN", r.expr[r.pos+1]) >= 0 {
+				return r.fail(r.pos-2, "invalid range in character class")
+			}
+			if next == '\\' && r.pos+1 < len(r.expr) && !isVariableChar(r.expr[r.pos+1]) {
+				next = int(r.expr[r.pos+1])
+			} else if next == '\\' || next == '[' {
+				prev = -1
+				continue
+			}
+			if next < prev {
+				return r.fail(r.pos-2, "range out of order in character class")
+			}
+			prev = -1
+		default:
+			prev = int(c)
+		}
+	}
+	return r.fail(start, "missing terminating ] for character class")
+}
+
+// group checks the start of a group after its "(".
+//
+//nolint:gocyclo,funlen
+func (r *regexChecker) group(start int) error {
+	r.repeatable = false
+	rest := r.expr[r.pos:]
+
+	switch {
+	case len(rest) > 1 && rest[0] == '*' && (rest[1] == ':' || (rest[1] >= 'A' && rest[1] <= 'Z')):
+		// verbs like (*FAIL) or (*UTF)
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return r.fail(start, "(*VERB) not terminated")
+		}
+		r.pos += end + 1
+		return nil
+	case len(rest) > 1 && rest[0] == '*' && rest[1] >= 'a' && rest[1] <= 'z':
+		// assertions like (*pla:...)
+		end := strings.IndexByte(rest, ':')
+		if end < 0 {
+			return r.fail(start, "(*alpha_assertion) not recognized")
+		}
+		r.pos += end + 1
+		r.groups = append(r.groups, start)
+		return nil
+	case !strings.HasPrefix(rest, "?"):
+		r.captures++
+		r.groups = append(r.groups, start)
+		return nil
+	}
+
+	r.pos++
+	rest = rest[1:]
+	switch {
+	case rest == "":
+		return r.fail(start, "unrecognized character after (? or (?-")
+	case strings.HasPrefix(rest, "#"):
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return r.fail(start, "missing ) after (?# comment")
+		}
+		r.pos += end + 1
+		return nil
+	case strings.HasPrefix(rest, "<=") || strings.HasPrefix(rest, "<!"):
+		r.pos += 2
+	case strings.HasPrefix(rest, "P<"), strings.HasPrefix(rest, "<"), strings.HasPrefix(rest, "'"):
+		// a named group
+		if rest[0] == 'P' {
+			r.pos++
+			rest = rest[1:]
+		}
+		closing := map[byte]byte{'<': '>', '\'': '\''}[rest[0]]
+		end := strings.IndexByte(rest[1:], closing)
+		if end < 0 {
+			return r.fail(start, "syntax error in subpattern name (missing terminator?)")
+		}
+		name := rest[1 : 1+end]
+		if name == "" || (name[0] >= '0' && name[0] <= '9') || strings.IndexFunc(name, func(c rune) bool {
+			return c > 0x7f || !isVariableChar(byte(c))
+		}) >= 0 {
+			return r.fail(start, "subpattern name expected")
+		}
+		if r.names[name] {
+			return r.fail(start, "two named subpatterns have the same name (PCRE2_DUPNAMES not set)")
+		}
+		r.names[name] = true
+		r.captures++
+		r.pos += end + 2
+		r.groups = append(r.groups, start)
+		return nil
+	case strings.HasPrefix(rest, "P="), strings.HasPrefix(rest, "P>"), strings.HasPrefix(rest, "&"),
+		strings.HasPrefix(rest, "R)"), rest[0] >= '0' && rest[0] <= '9', rest[0] == '+',
+		rest[0] == '-' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9':
+		// backreferences and recursions, like (?P=name), (?&name), (?R) or (?1)
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return r.fail(start, "missing closing parenthesis")
+		}
+		if n, err := strconv.Atoi(rest[:end]); err == nil && n > 0 && rest[0] != '+' {
+			r.addRef(start, n)
+		}
+		r.pos += end + 1
+		r.repeatable = true
+		return nil
+	case strings.HasPrefix(rest, "C"):
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return r.fail(start, "missing closing parenthesis after (?C")
+		}
+		r.pos += end + 1
+		return nil
+	case strings.HasPrefix(rest, "("):
+		// a condition, which is a reference like (?(1)...) or (?(<name>)...), or an assertion
+		r.groups = append(r.groups, start)
+		if strings.HasPrefix(rest, "(?") {
+			r.pos++
+			return r.group(r.pos - 1)
+		}
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return r.fail(start, "malformed number or name after (?(")
+		}
+		r.pos += end + 1
+		return nil
+	case strings.IndexByte(":=!>|", rest[0]) >= 0:
+		r.pos++
+	default:
+		// options like (?i) or (?i-s:...)
+		end := strings.IndexAny(rest, ":)")
+		if end < 0 || strings.Trim(rest[:end], "imnsxJU-^") != "" {
+			return r.fail(start, "unrecognized character after (? or (?-")
+		}
+		r.pos += end + 1
+		if rest[end] == ')' {
+			return nil
+		}
+	}
+	r.groups = append(r.groups, start)
+	return nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// regexArgs returns the regular expressions of a directive: the paths of regex locations, the
+// regex server names, the patterns of rewrite directives, the operands of the regex operators
+// of if directives, and the regex keys of map blocks, for a directive in a map block.
+func regexArgs(stmt *Directive, ctx blockCtx) []string {
+	if len(ctx) > 0 && ctx[len(ctx)-1] == "map" {
+		if strings.HasPrefix(stmt.Directive, "~") {
+			return []string{strings.TrimPrefix(stmt.Directive[1:], "*")}
+		}
+		return nil
+	}
+
+	var exprs []string
+	switch stmt.Directive {
+	case "location":
+		if modifier, path := locationPath(stmt.Args); modifier == "~" || modifier == "~*" {
+			exprs = append(exprs, path)
+		}
+	case "server_name":
+		for _, name := range stmt.Args {
+			if strings.HasPrefix(name, "~") {
+				exprs = append(exprs, name[1:])
+			}
+		}
+	case "rewrite":
+		if len(stmt.Args) > 0 {
+			exprs = append(exprs, stmt.Args[0])
+		}
+	case "if":
+		for i := 1; i < len(stmt.Args); i++ {
+			if isRegexOperator(stmt.Args[i-1]) {
+				exprs = append(exprs, stmt.Args[i])
+			}
+		}
+	}
+	return exprs
+}
+
+// analyzeRegexes returns a ParseError for the first invalid regular expression of a directive.
+func analyzeRegexes(fname string, stmt *Directive, ctx blockCtx) error {
+	for _, expr := range regexArgs(stmt, ctx) {
+		if _, err := RegexCaptures(expr); err != nil {
+			return &ParseError{
+				What:      fmt.Sprintf(`invalid regular expression "%s" in "%s" directive: %s`, expr, stmt.Directive, err),
+				File:      &fname,
+				Line:      &stmt.Line,
+				Statement: stmt.String(),
+				BlockCtx:  ctx.getLastBlock(),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexCaptures(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]int{
+		``:                                 0,
+		`\.php$`:                           0,
+		`^/users/(\d+)/(\w+)$`:             2,
+		`^/(?<name>[^/]+)/(?'id'\d+)$`:     2,
+		`(?P<name>a)(?:b)(?=c)(?!d)(?<=e)`: 1,
+		`(?i)^/img/.*\.(gif|jpe?g|png)$`:   1,
+		`^(?i:www\.)?example\.com$`:        0,
+		`a{2}b{2,}c{2,5}d{,x}`:             0,
+		`[]a-z\]-][^\d\s][[:alpha:]]`:      0,
+		`\Q(unbalanced\E(x)`:               1,
+		`(a)\1(?P=n)?(?<n>b)\k<n>\g{-1}`:   2,
+		`\x41\x{263a}\o{101}\101\p{L}\cA`:  0,
+		`(?#comment)(*UTF)a*+b++c?+`:       0,
+		`(?(1)a|b)(x)(?(?=y)y|z)`:          1,
+		`\12`:                              0,
+		`^/foo\_bar\/\-$`:                  0,
+	}
+	for expr, expected := range testcases {
+		captures, err := RegexCaptures(expr)
+		require.NoError(t, err, expr)
+		require.Equal(t, expected, captures, expr)
+	}
+}
+
+func TestRegexCaptures_invalid(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]string{
+		`^/(foo`:         "missing closing parenthesis at offset 6",
+		`foo)`:           "unmatched closing parenthesis at offset 3",
+		`*foo`:           "quantifier does not follow a repeatable item at offset 0",
+		`(|+)`:           "quantifier does not follow a repeatable item at offset 2",
+		`a**`:            "quantifier does not follow a repeatable item at offset 2",
+		`^*`:             "quantifier does not follow a repeatable item at offset 1",
+		`a$+`:            "quantifier does not follow a repeatable item at offset 2",
+		`^{2}`:           "quantifier does not follow a repeatable item at offset 1",
+		`a{3,2}`:         "numbers out of order in {} quantifier at offset 1",
+		`a{70000}`:       "number too big in {} quantifier at offset 1",
+		`[a-z`:           "missing terminating ] for character class at offset 0",
+		`[z-a]`:          "range out of order in character class at offset 1",
+		`[a-\d]`:         "invalid range in character class at offset 1",
+		`\y`:             `unrecognized character follows \ at offset 0`,
+		`foo\`:           `\ at end of pattern at offset 3`,
+		`(a)\2`:          "reference to non-existent subpattern at offset 3",
+		`(?<n>a)(?<n>b)`: "two named subpatterns have the same name (PCRE2_DUPNAMES not set) at offset 7",
+		`(?<1a>x)`:       "subpattern name expected at offset 0",
+		`(?Z)`:           "unrecognized character after (? or (?- at offset 0",
+		`\x{zz}`:         "malformed escape sequence at offset 0",
+		`\k`:             `\k or \g is not followed by a braced, angle-bracketed or quoted name or number at offset 0`,
+	}
+	for expr, expected := range testcases {
+		_, err := RegexCaptures(expr)
+		require.EqualError(t, err, expected, expr)
+		var rerr *RegexError
+		require.ErrorAs(t, err, &rerr)
+	}
+}
+
+func TestParse_validateRegexes(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    map $uri $new {
+        ~^/old/(.*)$ /new/$1;
+        ~^/bad/(.*  /bad;
+    }
+    server {
+        server_name ~^(www\.)?example\.com$ ~^(?<sub>.+\.example\.com;
+        location ~ ^/(foo {
+            return 200;
+        }
+        location ~* \.(png|jpg)$ {
+            if ($http_referer !~ "[a-") {
+                return 403;
+            }
+            rewrite "^/img/(.*){2,1}$" /images/$1 last;
+        }
+    }
+}
+`,
+	}
+
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{ValidateRegexes: true})
+	require.NoError(t, err)
+	errs := payload.Config[0].Errors
+	require.Len(t, errs, 5)
+	var lines []int
+	for _, e := range errs {
+		lines = append(lines, *e.Line)
+	}
+	require.Equal(t, []int{4, 7, 8, 12, 15}, lines)
+	require.EqualError(t, errs[2].Error,
+		`invalid regular expression "^/(foo" in "location" directive: missing closing parenthesis at offset 6 in nginx.conf:8`)
+	require.EqualError(t, errs[3].Error,
+		`invalid regular expression "[a-" in "if" directive: missing terminating ] for character class at offset 0 in nginx.conf:12`)
+
+	// the directives are kept
+	server := payload.Config[0].Parsed[0].Block[1]
+	require.Equal(t, "location", server.Block[1].Directive)
+	require.Equal(t, "return", server.Block[1].Block[0].Directive)
+
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{ValidateRegexes: true, StopParsingOnError: true})
+	require.EqualError(t, err,
+		`invalid regular expression "^/bad/(.*" in "~^/bad/(.*" directive: missing closing parenthesis at offset 9 in nginx.conf:4`)
+
+	// regexes are only checked when asked
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+	require.Empty(t, payload.Config[0].Errors)
+}
+
+func TestLint_regexCaptures(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    map $uri $new {
+        ~^/old/(.*)$ /new/$1$2;
+    }
+    server {
+        location ~ ^/users/(\d+)$ {
+            proxy_set_header X-User $1;
+            add_header X-Extra $2;
+            location /nested/ {
+                return 200 $3;
+            }
+            if ($arg_page ~ ^(\d+)-(\d+)$) {
+                return 200 $1$2;
+            }
+            rewrite ^/users/(\d+)/(\w+)$ /u/$1/$2/$3 last;
+            limit_except GET {
+                deny $5;
+            }
+        }
+    }
+}
+`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+
+	diagnostics := payload.Lint(&LintOptions{Rules: []Rule{DefaultRules()[4]}})
+	require.Equal(t, []string{
+		"nginx.conf:3 regex-captures",
+		"nginx.conf:8 regex-captures",
+		"nginx.conf:15 regex-captures",
+		"nginx.conf:17 regex-captures",
+	}, diagnosticStrings(diagnostics))
+	require.Equal(t, `$2 refers to a capture that "^/old/(.*)$" does not have, it has 1`, diagnostics[0].Message)
+	require.Equal(t, `$3 refers to a capture that "^/users/(\\d+)/(\\w+)$" does not have, it has 2`, diagnostics[2].Message)
+}
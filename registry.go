@@ -0,0 +1,499 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Context is a block context where directives can be used, given by the names of the blocks around it
+// separated by ">", like "http>server". Locations do not nest, a location in a location is in the
+// "http>location" context.
+type Context string
+
+const (
+	ContextMain                    Context = "main"
+	ContextEvents                  Context = "events"
+	ContextMail                    Context = "mail"
+	ContextMailServer              Context = "mail>server"
+	ContextStream                  Context = "stream"
+	ContextStreamServer            Context = "stream>server"
+	ContextStreamUpstream          Context = "stream>upstream"
+	ContextHTTP                    Context = "http"
+	ContextHTTPServer              Context = "http>server"
+	ContextHTTPLocation            Context = "http>location"
+	ContextHTTPUpstream            Context = "http>upstream"
+	ContextHTTPServerIf            Context = "http>server>if"
+	ContextHTTPLocationIf          Context = "http>location>if"
+	ContextHTTPLocationLimitExcept Context = "http>location>limit_except"
+	ContextMgmt                    Context = "mgmt"
+)
+
+// key returns the key of the context in the contexts map.
+func (c Context) key() string {
+	if c == ContextMain {
+		return ""
+	}
+	return string(c)
+}
+
+// custom returns true if the context is not one of the contexts of nginx.
+func (c Context) custom() bool {
+	_, ok := contexts[c.key()]
+	return !ok
+}
+
+// valid returns true if the context is made of block names separated by ">".
+func (c Context) valid() bool {
+	if c == "" {
+		return false
+	}
+	for _, name := range strings.Split(string(c), ">") {
+		if name == "" || strings.ContainsAny(name, " \t\n;{}") {
+			return false
+		}
+	}
+	return true
+}
+
+func contextOf(key string) Context {
+	if key == "" {
+		return ContextMain
+	}
+	return Context(key)
+}
+
+// BlockContext is a block context of a third-party module, like the "rtmp>server>application" context
+// of the application blocks of the RTMP module. Directives are allowed in it by the DirectiveSpecs of
+// the ParseOptions.Directives registry which have it in their contexts.
+type BlockContext struct {
+	Context Context
+	// If Collapse is true, a block is in the context wherever it is nested in the parent context, the
+	// way a location in a location is in the "http>location" context. Otherwise, only the blocks right
+	// in the parent context are.
+	Collapse bool
+}
+
+// parent returns the context of the block and the name of the block.
+func (c BlockContext) parent() (blockCtx, string) {
+	names := strings.Split(string(c.Context), ">")
+	return names[:len(names)-1], names[len(names)-1]
+}
+
+func (c BlockContext) validate() error {
+	if !c.Context.valid() {
+		return fmt.Errorf(`invalid block context "%s"`, c.Context)
+	}
+	if !c.Context.custom() {
+		return fmt.Errorf(`block context "%s" is a context of nginx`, c.Context)
+	}
+	return nil
+}
+
+// hasBlockContext returns true if a context is one of the block contexts.
+func hasBlockContext(blockContexts []BlockContext, ctx blockCtx) bool {
+	for _, c := range blockContexts {
+		if c.Context.key() == ctx.key() {
+			return true
+		}
+	}
+	return false
+}
+
+// DirectiveSpec describes a way to use a directive: the contexts where it is allowed, the number of
+// its arguments, and whether it is a block, a flag or an expression. A directive used in different
+// ways, like "server" in "http" and in "upstream", has a DirectiveSpec for each of them.
+type DirectiveSpec struct {
+	Name     string    `json:"name" yaml:"name"`
+	Contexts []Context `json:"contexts" yaml:"contexts"`
+	// Args are the numbers of arguments the directive can take, from 0 to 7.
+	Args []int `json:"args,omitempty" yaml:"args,omitempty"`
+	// If Variadic is true, the directive can take MinArgs or more arguments, with MinArgs from 0 to 2.
+	Variadic bool `json:"variadic,omitempty" yaml:"variadic,omitempty"`
+	MinArgs  int  `json:"min_args,omitempty" yaml:"min_args,omitempty"`
+	// If Flag is true, the directive can take one argument which is "on" or "off".
+	Flag bool `json:"flag,omitempty" yaml:"flag,omitempty"`
+	// If Block is true, the directive is followed by a block.
+	Block bool `json:"block,omitempty" yaml:"block,omitempty"`
+	// If Expr is true, the arguments of the directive are an expression in parentheses, like for "if".
+	Expr bool `json:"expr,omitempty" yaml:"expr,omitempty"`
+	// Direct is the NGX_DIRECT_CONF flag of the directives of the main context whose configuration is
+	// set directly by nginx, like "worker_processes". It is kept in the mask but not used by the parser.
+	Direct bool `json:"direct,omitempty" yaml:"direct,omitempty"`
+}
+
+// maxArgs is the largest number of arguments given by DirectiveSpec.Args, like NGX_CONF_TAKE7.
+const maxArgs = 7
+
+// Mask returns the bit mask of the DirectiveSpec, which can be returned by a MatchFunc. The custom
+// contexts of the DirectiveSpec have no bits, they are only used by a Registry.
+func (s DirectiveSpec) Mask() uint {
+	var mask uint
+	for _, c := range s.Contexts {
+		mask |= contexts[c.key()]
+	}
+	mask |= argsMask(s.Args, s.Variadic, s.MinArgs)
+	if s.Flag {
+		mask |= ngxConfFlag
+	}
+	if s.Block {
+		mask |= ngxConfBlock
+	}
+	if s.Expr {
+		mask |= ngxConfExpr
+	}
+	if s.Direct {
+		mask |= ngxDirectConf
+	}
+	return mask
+}
+
+// argsMask returns the bits of a mask for numbers of arguments, and for MinArgs or more arguments if
+// variadic is true.
+func argsMask(args []int, variadic bool, minArgs int) uint {
+	var mask uint
+	for _, n := range args {
+		if n >= 0 && n <= maxArgs {
+			mask |= 1 << n
+		}
+	}
+	if variadic {
+		switch minArgs {
+		case 0:
+			mask |= ngxConfAny
+		case 1:
+			mask |= ngxConf1More
+		default:
+			mask |= ngxConf2More
+		}
+	}
+	return mask
+}
+
+// customContexts returns the contexts of the DirectiveSpec which are not contexts of nginx.
+func (s DirectiveSpec) customContexts() []Context {
+	var custom []Context
+	for _, c := range s.Contexts {
+		if c.custom() {
+			custom = append(custom, c)
+		}
+	}
+	return custom
+}
+
+// allows returns true if the directive is allowed in a context.
+func (s DirectiveSpec) allows(ctx Context) bool {
+	for _, c := range s.Contexts {
+		if c == ctx {
+			return true
+		}
+	}
+	return false
+}
+
+func (s DirectiveSpec) validate() error {
+	if s.Name == "" {
+		return errors.New("directive spec without a name")
+	}
+	if len(s.Contexts) == 0 {
+		return fmt.Errorf(`"%s" directive spec has no contexts`, s.Name)
+	}
+	for _, c := range s.Contexts {
+		if !c.valid() {
+			return fmt.Errorf(`"%s" directive spec has an invalid context "%s"`, s.Name, c)
+		}
+	}
+	for _, n := range s.Args {
+		if n < 0 || n > maxArgs {
+			return fmt.Errorf(`"%s" directive spec has an invalid number of arguments %d`, s.Name, n)
+		}
+	}
+	if s.Variadic && (s.MinArgs < 0 || s.MinArgs > 2) {
+		return fmt.Errorf(`"%s" directive spec has an invalid minimum number of arguments %d`, s.Name, s.MinArgs)
+	}
+	if len(s.Args) == 0 && !s.Variadic && !s.Flag {
+		return fmt.Errorf(`"%s" directive spec takes no arguments, use "args: [0]" for a directive without arguments`, s.Name)
+	}
+	return nil
+}
+
+// DirectiveSpecsFromMasks returns the DirectiveSpecs of a directive described by bit masks, like the
+// masks returned by a MatchFunc.
+func DirectiveSpecsFromMasks(name string, masks []uint) []DirectiveSpec {
+	specs := make([]DirectiveSpec, 0, len(masks))
+	for _, mask := range masks {
+		s := DirectiveSpec{
+			Name:   name,
+			Flag:   mask&ngxConfFlag != 0,
+			Block:  mask&ngxConfBlock != 0,
+			Expr:   mask&ngxConfExpr != 0,
+			Direct: mask&ngxDirectConf != 0,
+		}
+		for _, c := range sortedContexts() {
+			if mask&contexts[c] != 0 {
+				s.Contexts = append(s.Contexts, contextOf(c))
+			}
+		}
+		for n := 0; n <= maxArgs; n++ {
+			if mask&(1<<n) != 0 {
+				s.Args = append(s.Args, n)
+			}
+		}
+		switch {
+		case mask&ngxConfAny != 0:
+			s.Variadic, s.MinArgs = true, 0
+		case mask&ngxConf1More != 0:
+			s.Variadic, s.MinArgs = true, 1
+		case mask&ngxConf2More != 0:
+			s.Variadic, s.MinArgs = true, 2
+		}
+		specs = append(specs, s)
+	}
+	return specs
+}
+
+// sortedContexts returns the keys of the contexts map in the order of their bits.
+func sortedContexts() []string {
+	keys := make([]string, 0, len(contexts))
+	for key := range contexts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return contexts[keys[i]] < contexts[keys[j]] })
+	return keys
+}
+
+// specsFromTable returns the DirectiveSpecs of the directives of a table for which keep returns true,
+// sorted by name.
+func specsFromTable(table map[string][]uint, keep func(name string) bool) []DirectiveSpec {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		if keep == nil || keep(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var specs []DirectiveSpec
+	for _, name := range names {
+		specs = append(specs, DirectiveSpecsFromMasks(name, table[name])...)
+	}
+	return specs
+}
+
+// CoreDirectiveSpecs returns the DirectiveSpecs of the directives of nginx which are not only available
+// in NGINX Plus.
+func CoreDirectiveSpecs() []DirectiveSpec {
+	return specsFromTable(directives, func(name string) bool { return !directiveVersions[name].plus })
+}
+
+// PlusDirectiveSpecs returns the DirectiveSpecs of the directives only available in NGINX Plus.
+func PlusDirectiveSpecs() []DirectiveSpec {
+	return specsFromTable(directives, func(name string) bool { return directiveVersions[name].plus })
+}
+
+// AppProtectWAFv4DirectiveSpecs returns the DirectiveSpecs of the directives of the App Protect v4 module.
+func AppProtectWAFv4DirectiveSpecs() []DirectiveSpec {
+	return specsFromTable(appProtectWAFv4Directives, nil)
+}
+
+// AppProtectWAFv5DirectiveSpecs returns the DirectiveSpecs of the directives of the App Protect v5 module.
+func AppProtectWAFv5DirectiveSpecs() []DirectiveSpec {
+	return specsFromTable(appProtectWAFv5Directives, nil)
+}
+
+// LuaDirectiveSpecs returns the DirectiveSpecs of the directives of the Lua module.
+func LuaDirectiveSpecs() []DirectiveSpec {
+	return specsFromTable(LuaDirectives, nil)
+}
+
+// LoadDirectiveSpecs reads a list of DirectiveSpecs in JSON or YAML, like:
+//
+//   - name: my_directive
+//     contexts: [http, http>server, http>location]
+//     args: [1, 2]
+//   - name: my_block
+//     contexts: [http]
+//     args: [0]
+//     block: true
+func LoadDirectiveSpecs(r io.Reader) ([]DirectiveSpec, error) {
+	var specs []DirectiveSpec
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&specs); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid directive specs: %w", err)
+	}
+	for _, s := range specs {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return specs, nil
+}
+
+// Registry holds the DirectiveSpecs of a set of directives, which can be composed from the directives
+// of nginx, of NGINX Plus, of modules and of specs loaded with LoadDirectiveSpecs:
+//
+//	registry, err := crossplane.NewRegistry(crossplane.CoreDirectiveSpecs(), crossplane.LuaDirectiveSpecs(), specs)
+//
+// Set ParseOptions.Directives to parse configs with the directives of a Registry, or use its Match
+// method as a MatchFunc.
+type Registry struct {
+	specs map[string][]DirectiveSpec
+	masks map[string][]uint
+}
+
+// NewRegistry returns a Registry with the DirectiveSpecs of the given lists.
+func NewRegistry(lists ...[]DirectiveSpec) (*Registry, error) {
+	r := &Registry{
+		specs: map[string][]DirectiveSpec{},
+		masks: map[string][]uint{},
+	}
+	for _, specs := range lists {
+		if err := r.Add(specs...); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds DirectiveSpecs to the Registry. The DirectiveSpecs of a directive already in the Registry
+// are added to its DirectiveSpecs, unless they have the same mask as one of them.
+func (r *Registry) Add(specs ...DirectiveSpec) error {
+	for _, s := range specs {
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	for _, s := range specs {
+		if r.has(s) {
+			continue
+		}
+		r.specs[s.Name] = append(r.specs[s.Name], s)
+		r.masks[s.Name] = append(r.masks[s.Name], s.Mask())
+	}
+	return nil
+}
+
+// has returns true if the Registry has a DirectiveSpec with the same mask and custom contexts as s.
+func (r *Registry) has(s DirectiveSpec) bool {
+	mask := s.Mask()
+	custom := s.customContexts()
+	for i, other := range r.specs[s.Name] {
+		if r.masks[s.Name][i] != mask || len(other.customContexts()) != len(custom) {
+			continue
+		}
+		same := true
+		for _, c := range other.customContexts() {
+			same = same && other.allows(c) && s.allows(c)
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes a directive from the Registry.
+func (r *Registry) Delete(name string) {
+	delete(r.specs, name)
+	delete(r.masks, name)
+}
+
+// Match returns the bit masks of a directive. It is a MatchFunc.
+func (r *Registry) Match(directive string) ([]uint, bool) {
+	masks, ok := r.masks[directive]
+	return masks, ok
+}
+
+// Lookup returns the DirectiveSpecs of a directive.
+func (r *Registry) Lookup(name string) ([]DirectiveSpec, bool) {
+	specs, ok := r.specs[name]
+	return specs, ok
+}
+
+// Names returns the names of the directives of the Registry, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Specs returns the DirectiveSpecs of the Registry, sorted by name.
+func (r *Registry) Specs() []DirectiveSpec {
+	var specs []DirectiveSpec
+	for _, name := range r.Names() {
+		specs = append(specs, r.specs[name]...)
+	}
+	return specs
+}
+
+// Contexts returns the contexts where a directive is allowed, the contexts of nginx in the order of
+// their nesting, and then the custom contexts.
+func (r *Registry) Contexts(name string) []Context {
+	var mask uint
+	var custom []Context
+	for i, s := range r.specs[name] {
+		mask |= r.masks[name][i]
+		for _, c := range s.customContexts() {
+			if !containsContext(custom, c) {
+				custom = append(custom, c)
+			}
+		}
+	}
+	var ctxs []Context
+	for _, c := range sortedContexts() {
+		if mask&contexts[c] != 0 {
+			ctxs = append(ctxs, contextOf(c))
+		}
+	}
+	return append(ctxs, custom...)
+}
+
+// Directives returns the names of the directives allowed in a context, sorted, like the directives
+// that can be completed in a block.
+func (r *Registry) Directives(ctx Context) []string {
+	var names []string
+	for _, name := range r.Names() {
+		if len(r.masksIn(name, ctx)) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// masksIn returns the masks of the DirectiveSpecs of a directive allowed in a context.
+func (r *Registry) masksIn(name string, ctx Context) []uint {
+	if r == nil {
+		return nil
+	}
+	var masks []uint
+	for i, s := range r.specs[name] {
+		if (ctx.custom() && s.allows(ctx)) || (!ctx.custom() && r.masks[name][i]&contexts[ctx.key()] != 0) {
+			masks = append(masks, r.masks[name][i])
+		}
+	}
+	return masks
+}
+
+func containsContext(list []Context, ctx Context) bool {
+	for _, c := range list {
+		if c == ctx {
+			return true
+		}
+	}
+	return false
+}
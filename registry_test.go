@@ -0,0 +1,356 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectiveSpecsFromMasks(t *testing.T) {
+	t.Parallel()
+	specs := DirectiveSpecsFromMasks("server", directives["server"])
+	require.Equal(t, []DirectiveSpec{
+		{Name: "server", Contexts: []Context{ContextHTTP}, Args: []int{0}, Block: true},
+		{Name: "server", Contexts: []Context{ContextHTTPUpstream}, Variadic: true, MinArgs: 1},
+		{Name: "server", Contexts: []Context{ContextMail}, Args: []int{0}, Block: true},
+		{Name: "server", Contexts: []Context{ContextStream}, Args: []int{0}, Block: true},
+		{Name: "server", Contexts: []Context{ContextStreamUpstream}, Variadic: true, MinArgs: 1},
+	}, specs)
+
+	specs = DirectiveSpecsFromMasks("if", directives["if"])
+	require.Equal(t, []DirectiveSpec{
+		{Name: "if", Contexts: []Context{ContextHTTPServer, ContextHTTPLocation}, Variadic: true, MinArgs: 1, Block: true, Expr: true},
+	}, specs)
+}
+
+// TestDirectiveSpec_Mask checks that the masks of the DirectiveSpecs of the tables are the masks of the tables.
+func TestDirectiveSpec_Mask(t *testing.T) {
+	t.Parallel()
+	for _, table := range []map[string][]uint{directives, appProtectWAFv4Directives, appProtectWAFv5Directives, LuaDirectives} {
+		for name, masks := range table {
+			specs := DirectiveSpecsFromMasks(name, masks)
+			require.Len(t, specs, len(masks))
+			for i, s := range specs {
+				require.Equal(t, masks[i], s.Mask(), "%s: %#x", name, masks[i])
+			}
+		}
+	}
+
+	specs := DirectiveSpecsFromMasks("worker_processes", directives["worker_processes"])
+	require.Equal(t, []DirectiveSpec{
+		{Name: "worker_processes", Contexts: []Context{ContextMain}, Args: []int{1}, Direct: true},
+	}, specs)
+}
+
+// TestRegistry_directives checks that a Registry of the core and NGINX Plus directives has the masks of
+// every directive known by the parser.
+func TestRegistry_directives(t *testing.T) {
+	t.Parallel()
+	registry, err := NewRegistry(CoreDirectiveSpecs(), PlusDirectiveSpecs())
+	require.NoError(t, err)
+	require.Len(t, registry.Names(), len(directives))
+	for name, want := range directives {
+		masks, ok := registry.Match(name)
+		require.True(t, ok, name)
+		require.Equal(t, want, masks, name)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	core := CoreDirectiveSpecs()
+	plus := PlusDirectiveSpecs()
+	registry, err := NewRegistry(core)
+	require.NoError(t, err)
+
+	_, ok := registry.Lookup("zone_sync")
+	require.False(t, ok)
+	specs, ok := registry.Lookup("proxy_pass")
+	require.True(t, ok)
+	require.Equal(t, []int{1}, specs[0].Args)
+
+	require.Equal(t, []Context{ContextStreamServer, ContextHTTPLocation, ContextHTTPLocationIf, ContextHTTPLocationLimitExcept},
+		registry.Contexts("proxy_pass"))
+	require.Nil(t, registry.Contexts("unknown"))
+
+	events := registry.Directives(ContextEvents)
+	require.Contains(t, events, "worker_connections")
+	require.NotContains(t, events, "proxy_pass")
+	require.Nil(t, registry.Directives("rtmp"))
+
+	require.NoError(t, registry.Add(plus...))
+	_, ok = registry.Lookup("zone_sync")
+	require.True(t, ok)
+	require.Len(t, registry.Names(), len(directives))
+
+	// adding the same specs again does not change the registry
+	require.NoError(t, registry.Add(core...))
+	require.Equal(t, len(core)+len(plus), len(registry.Specs()))
+
+	registry.Delete("zone_sync")
+	_, ok = registry.Lookup("zone_sync")
+	require.False(t, ok)
+
+	masks, ok := registry.Match("proxy_pass")
+	require.True(t, ok)
+	require.Equal(t, directives["proxy_pass"], masks)
+
+	err = registry.Add(DirectiveSpec{Name: "bad", Contexts: []Context{"http>>server"}, Args: []int{1}})
+	require.EqualError(t, err, `"bad" directive spec has an invalid context "http>>server"`)
+
+	// custom contexts
+	require.NoError(t, registry.Add(
+		DirectiveSpec{Name: "live", Contexts: []Context{"rtmp>server>application"}, Flag: true},
+		DirectiveSpec{Name: "live", Contexts: []Context{"rtmp>server"}, Flag: true},
+		DirectiveSpec{Name: "live", Contexts: []Context{"rtmp>server"}, Flag: true},
+		DirectiveSpec{Name: "proxy_pass", Contexts: []Context{"rtmp>server"}, Args: []int{1}},
+	))
+	specs, _ = registry.Lookup("live")
+	require.Len(t, specs, 2)
+	require.Equal(t, []Context{"rtmp>server>application", "rtmp>server"}, registry.Contexts("live"))
+	require.Equal(t, []string{"live", "proxy_pass"}, registry.Directives("rtmp>server"))
+	require.Contains(t, registry.Contexts("proxy_pass"), Context("rtmp>server"))
+}
+
+func TestLoadDirectiveSpecs(t *testing.T) {
+	t.Parallel()
+	want := []DirectiveSpec{
+		{Name: "my_directive", Contexts: []Context{ContextHTTP, ContextHTTPServer}, Args: []int{1, 2}},
+		{Name: "my_block", Contexts: []Context{ContextHTTP}, Args: []int{0}, Block: true},
+		{Name: "my_list", Contexts: []Context{ContextMain}, Variadic: true, MinArgs: 1},
+	}
+
+	testcases := map[string]struct {
+		input string
+		want  []DirectiveSpec
+		err   string
+	}{
+		"yaml": {
+			input: `
+- name: my_directive
+  contexts: [http, http>server]
+  args: [1, 2]
+- name: my_block
+  contexts: [http]
+  args: [0]
+  block: true
+- name: my_list
+  contexts: [main]
+  variadic: true
+  min_args: 1
+`,
+			want: want,
+		},
+		"json": {
+			input: `[
+  {"name": "my_directive", "contexts": ["http", "http>server"], "args": [1, 2]},
+  {"name": "my_block", "contexts": ["http"], "args": [0], "block": true},
+  {"name": "my_list", "contexts": ["main"], "variadic": true, "min_args": 1}
+]`,
+			want: want,
+		},
+		"empty": {
+			input: "",
+		},
+		"unknown field": {
+			input: `[{"name": "x", "contexts": ["http"], "arguments": [1]}]`,
+			err:   "invalid directive specs: yaml: unmarshal errors:\n  line 1: field arguments not found in type crossplane.DirectiveSpec",
+		},
+		"no name": {
+			input: `[{"contexts": ["http"], "args": [1]}]`,
+			err:   "directive spec without a name",
+		},
+		"no contexts": {
+			input: `[{"name": "x", "args": [1]}]`,
+			err:   `"x" directive spec has no contexts`,
+		},
+		"no arguments": {
+			input: `[{"name": "x", "contexts": ["http"]}]`,
+			err:   `"x" directive spec takes no arguments, use "args: [0]" for a directive without arguments`,
+		},
+		"too many arguments": {
+			input: `[{"name": "x", "contexts": ["http"], "args": [8]}]`,
+			err:   `"x" directive spec has an invalid number of arguments 8`,
+		},
+		"invalid minimum": {
+			input: `[{"name": "x", "contexts": ["http"], "variadic": true, "min_args": 3}]`,
+			err:   `"x" directive spec has an invalid minimum number of arguments 3`,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			specs, err := LoadDirectiveSpecs(strings.NewReader(tc.input))
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, specs)
+		})
+	}
+}
+
+func TestDirectiveSpec_json(t *testing.T) {
+	t.Parallel()
+	b, err := json.Marshal(DirectiveSpecsFromMasks("access_log", directives["access_log"])[:1])
+	require.NoError(t, err)
+	require.JSONEq(t, `[{
+		"name": "access_log",
+		"contexts": ["http", "http>server", "http>location", "http>location>if", "http>location>limit_except"],
+		"variadic": true,
+		"min_args": 1
+	}]`, string(b))
+
+	specs, err := LoadDirectiveSpecs(strings.NewReader(string(b)))
+	require.NoError(t, err)
+	require.Equal(t, directives["access_log"][0], specs[0].Mask())
+}
+
+func TestParse_directives(t *testing.T) {
+	t.Parallel()
+	specs, err := LoadDirectiveSpecs(strings.NewReader(`
+- name: my_directive
+  contexts: [http>server]
+  args: [1]
+`))
+	require.NoError(t, err)
+	registry, err := NewRegistry(CoreDirectiveSpecs(), specs)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"nginx.conf": `http {
+    server {
+        my_directive a;
+        my_directive a b;
+        zone_sync;
+    }
+}
+`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{Directives: registry, ErrorOnUnknownDirectives: true})
+	require.NoError(t, err)
+	errs := payload.Config[0].Errors
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0].Error, `invalid number of arguments in "my_directive" directive in nginx.conf:4`)
+	require.EqualError(t, errs[1].Error, `unknown directive "zone_sync" in nginx.conf:5`)
+
+	// the directives of the registry can also be matched by a MatchFunc, after the directives known by the parser
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{MatchFuncs: []MatchFunc{registry.Match}, ErrorOnUnknownDirectives: true})
+	require.NoError(t, err)
+	errs = payload.Config[0].Errors
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0].Error, `invalid number of arguments in "my_directive" directive in nginx.conf:4`)
+	require.EqualError(t, errs[1].Error, `"zone_sync" directive is not allowed here in nginx.conf:5`)
+}
+
+func TestParse_contexts(t *testing.T) {
+	t.Parallel()
+	specs, err := LoadDirectiveSpecs(strings.NewReader(`
+- name: rtmp
+  contexts: [main]
+  args: [0]
+  block: true
+- name: server
+  contexts: [rtmp]
+  args: [0]
+  block: true
+- name: listen
+  contexts: [rtmp>server]
+  args: [1]
+- name: application
+  contexts: [rtmp>server, rtmp>server>application]
+  args: [1]
+  block: true
+- name: live
+  contexts: [rtmp>server>application]
+  flag: true
+`))
+	require.NoError(t, err)
+	registry, err := NewRegistry(CoreDirectiveSpecs(), specs)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"nginx.conf": `rtmp {
+    server {
+        listen 1935;
+        live on;
+        application live {
+            live on;
+            listen 1936;
+            application nested {
+                live maybe;
+            }
+        }
+    }
+}
+`,
+	}
+
+	options := &ParseOptions{
+		Directives: registry,
+		Contexts: []BlockContext{
+			{Context: "rtmp"},
+			{Context: "rtmp>server"},
+			{Context: "rtmp>server>application", Collapse: true},
+		},
+	}
+	payload, err := ParseFiles(files, "nginx.conf", options)
+	require.NoError(t, err)
+	errs := payload.Config[0].Errors
+	require.Len(t, errs, 3)
+	require.EqualError(t, errs[0].Error, `"live" directive is not allowed here in nginx.conf:4`)
+	require.EqualError(t, errs[1].Error, `"listen" directive is not allowed here in nginx.conf:7`)
+	require.EqualError(t, errs[2].Error, `invalid value "maybe" in "live" directive, it must be "on" or "off" in nginx.conf:9`)
+
+	// without the contexts, the directives in unknown contexts are not checked
+	payload, err = ParseFiles(files, "nginx.conf", &ParseOptions{Directives: registry})
+	require.NoError(t, err)
+	require.Empty(t, payload.Config[0].Errors)
+
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{Contexts: []BlockContext{{Context: "http>server"}}})
+	require.EqualError(t, err, `block context "http>server" is a context of nginx`)
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{Contexts: []BlockContext{{Context: "rtmp>"}}})
+	require.EqualError(t, err, `invalid block context "rtmp>"`)
+
+	// the masks of MatchFuncs have no bits for the contexts, so they need a registry
+	_, err = ParseFiles(files, "nginx.conf", &ParseOptions{
+		Contexts:   options.Contexts,
+		MatchFuncs: []MatchFunc{registry.Match},
+	})
+	require.EqualError(t, err, "block contexts require a Directives registry allowing directives in them")
+}
+
+func TestPayload_Append_contexts(t *testing.T) {
+	t.Parallel()
+	registry, err := NewRegistry(
+		[]DirectiveSpec{{Name: "live", Contexts: []Context{"rtmp>server>application"}, Flag: true}},
+	)
+	require.NoError(t, err)
+	options := &ParseOptions{
+		Directives: registry,
+		Contexts:   []BlockContext{{Context: "rtmp>server>application", Collapse: true}},
+	}
+
+	files := map[string]string{
+		"nginx.conf": "rtmp { server { application a { application b { } } } }",
+	}
+	payload, err := ParseFiles(files, "nginx.conf", options)
+	require.NoError(t, err)
+	b := payload.Config[0].Parsed[0].Block[0].Block[0].Block[0]
+
+	err = payload.Append(b, Directives{{Directive: "live", Args: []string{"maybe"}, Line: 1}}, options)
+	require.EqualError(t, err, `invalid value "maybe" in "live" directive, it must be "on" or "off" in nginx.conf:1`)
+	require.NoError(t, payload.Append(b, Directives{{Directive: "live", Args: []string{"on"}}}, options))
+}
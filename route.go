@@ -0,0 +1,302 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoServer is returned by Route when no http server listens on the address and port of a request.
+var ErrNoServer = errors.New("no server listens on the address and port")
+
+// RouteRequest is a request to route to the server and location of the http block that handle it.
+type RouteRequest struct {
+	// Addr is the local address the request is received on, like "10.0.0.1" or "::1". If it is
+	// empty, the servers listening on any address of Port handle the request.
+	Addr string
+	Port int
+	// Host is the host name of the request, from its Host header.
+	Host string
+	// Path is the decoded path of the request, without its query string.
+	Path string
+}
+
+// Route is the server and the location chosen to handle a request.
+type Route struct {
+	Server *Server
+	// Location is nil if no location of the server matches the request.
+	Location *Location
+	// ServerMatch and LocationMatch tell the file and the line of the server and the location.
+	ServerMatch   Match
+	LocationMatch Match
+	// RegexErrors holds an error for each regular expression of a server name or a location that the
+	// regexp package could not compile, as it uses PCRE syntax like backreferences or lookarounds.
+	// They are treated as not matching, so the route may not be the one nginx chooses if there are any.
+	RegexErrors []error
+}
+
+// Route returns the server and the location of the http block that handle a request for a URL,
+// like "https://api.example.com/v2/users". The request is received on the port of the URL or on the
+// default port of its scheme, with any local address.
+func (p *Payload) Route(rawURL string) (*Route, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	r := RouteRequest{Host: u.Hostname(), Path: u.Path}
+	if port := u.Port(); port != "" {
+		if r.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid port in %q: %w", rawURL, err)
+		}
+	} else if u.Scheme == "https" {
+		r.Port = 443
+	} else {
+		r.Port = 80
+	}
+	return p.RouteRequest(r)
+}
+
+// RouteRequest returns the server and the location of the http block that handle a request, chosen
+// like nginx does. The server is chosen among the servers that listen on the address and port of
+// the request by its server names: an exact name first, then the longest wildcard name starting with
+// an asterisk, then the longest wildcard name ending with an asterisk, then the first matching regular
+// expression, and finally the default server. The location is the location with an exact match if
+// there is one, otherwise the longest matching prefix location, unless it has the "^~" modifier or a
+// regular expression location matches, in which case it is the first regular expression location that
+// matches, in the order of the config. Locations inside of the chosen location are searched the same way.
+func (p *Payload) RouteRequest(r RouteRequest) (*Route, error) {
+	http := p.HTTP()
+	if http == nil {
+		return nil, fmt.Errorf("%w: no http block", ErrNoServer)
+	}
+	var regexErrors []error
+	server := chooseServer(http.Servers, r, &regexErrors)
+	if server == nil {
+		return nil, fmt.Errorf("%w: %s:%d", ErrNoServer, r.Addr, r.Port)
+	}
+
+	route := &Route{Server: server}
+	route.ServerMatch, _ = p.locate(server.Directive)
+	route.Location, _ = findLocation(normalizePath(r.Path), server.Locations, &regexErrors)
+	route.RegexErrors = regexErrors
+	if route.Location != nil {
+		route.LocationMatch, _ = p.locate(route.Location.Directive)
+	}
+	return route, nil
+}
+
+// chooseServer returns the server that handles a request, or nil if no server listens on its address and port.
+// The server names that cannot be compiled are added to regexErrors.
+//
+//nolint:gocognit
+func chooseServer(servers []*Server, r RouteRequest, regexErrors *[]error) *Server {
+	addr := strings.Trim(r.Addr, "[]")
+	defaultListen := &Listen{Port: 80}
+
+	matches := func(l *Listen, specific bool) bool {
+		if l.Port != r.Port || strings.HasPrefix(l.Address, "unix:") {
+			return false
+		}
+		if addr == "" {
+			return !specific
+		}
+		if specific {
+			return !isWildcardAddress(l.Address) && strings.Trim(l.Address, "[]") == addr
+		}
+		return isWildcardAddress(l.Address)
+	}
+
+	// servers listening on the address itself take precedence over servers listening on any address
+	var candidates []*Server
+	var defaultServer *Server
+	for _, specific := range []bool{true, false} {
+		for _, s := range servers {
+			listen := s.Listen
+			if len(listen) == 0 {
+				listen = []*Listen{defaultListen}
+			}
+			for _, l := range listen {
+				if matches(l, specific) {
+					candidates = append(candidates, s)
+					if defaultServer == nil && l.DefaultServer {
+						defaultServer = s
+					}
+					break
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if defaultServer == nil {
+		defaultServer = candidates[0]
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(r.Host), ".")
+
+	// exact names
+	for _, s := range candidates {
+		for _, name := range s.ServerNames {
+			if strings.ToLower(name) == host {
+				return s
+			}
+		}
+	}
+
+	// the longest wildcard names starting with an asterisk, then ending with an asterisk
+	for _, leading := range []bool{true, false} {
+		var best *Server
+		longest := 0
+		for _, s := range candidates {
+			for _, name := range s.ServerNames {
+				name = strings.ToLower(name)
+				if n := matchWildcard(name, host, leading); n > longest {
+					best, longest = s, n
+				}
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+
+	// regular expressions, in the order of the config
+	for _, s := range candidates {
+		for _, name := range s.ServerNames {
+			if !strings.HasPrefix(name, "~") {
+				continue
+			}
+			re, err := compileNginxRegex(name[1:], false)
+			if err != nil {
+				*regexErrors = append(*regexErrors, regexError(s.Directive, name[1:], err))
+				continue
+			}
+			if re.MatchString(host) {
+				return s
+			}
+		}
+	}
+
+	return defaultServer
+}
+
+func isWildcardAddress(addr string) bool {
+	return addr == "" || addr == "*" || addr == "0.0.0.0" || addr == "[::]"
+}
+
+// matchWildcard returns the length of a wildcard server name that matches host, or 0 if it does not match.
+// Leading wildcards are names like "*.example.com" or ".example.com", which also matches "example.com",
+// and trailing wildcards are names like "www.example.*".
+func matchWildcard(name, host string, leading bool) int {
+	switch {
+	case leading && strings.HasPrefix(name, "*."):
+		if strings.HasSuffix(host, name[1:]) && len(host) > len(name)-1 {
+			return len(name)
+		}
+	case leading && strings.HasPrefix(name, "."):
+		if host == name[1:] || strings.HasSuffix(host, name) {
+			return len(name)
+		}
+	case !leading && strings.HasSuffix(name, ".*"):
+		if strings.HasPrefix(host, name[:len(name)-1]) && len(host) > len(name)-1 {
+			return len(name)
+		}
+	}
+	return 0
+}
+
+// findLocation returns the location among locations that handles a request for path, or nil if none does.
+// It also returns true if the search is over, when an exact or a regular expression location matched.
+// The regular expressions that cannot be compiled are added to regexErrors.
+func findLocation(path string, locations []*Location, regexErrors *[]error) (*Location, bool) {
+	var prefix *Location
+	for _, l := range locations {
+		switch l.Modifier {
+		case "=":
+			if l.Path == path {
+				return l, true
+			}
+		case "", "^~":
+			if !l.IsNamed() && strings.HasPrefix(path, l.Path) && (prefix == nil || len(l.Path) > len(prefix.Path)) {
+				prefix = l
+			}
+		}
+	}
+
+	current := prefix
+	if prefix != nil {
+		if nested, done := findLocation(path, prefix.Locations, regexErrors); nested != nil {
+			current = nested
+			if done {
+				return current, true
+			}
+		}
+		if prefix.Modifier == "^~" {
+			return current, false
+		}
+	}
+
+	for _, l := range locations {
+		if !l.IsRegex() {
+			continue
+		}
+		re, err := compileNginxRegex(l.Path, l.Modifier == "~*")
+		if err != nil {
+			*regexErrors = append(*regexErrors, regexError(l.Directive, l.Path, err))
+			continue
+		}
+		if !re.MatchString(path) {
+			continue
+		}
+		if nested, _ := findLocation(path, l.Locations, regexErrors); nested != nil {
+			return nested, true
+		}
+		return l, true
+	}
+	return current, false
+}
+
+// compileNginxRegex compiles a PCRE regular expression of an nginx config with the regexp package,
+// which supports most of the syntax used in configs.
+func compileNginxRegex(expr string, caseless bool) (*regexp.Regexp, error) {
+	// named groups may be written as (?<name>...) or (?'name'...) in PCRE
+	expr = pcreNamedGroup.ReplaceAllString(expr, "(?P<${1}${2}>")
+	if caseless {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func regexError(d *Directive, expr string, err error) error {
+	return fmt.Errorf("cannot match regular expression %q of %q directive on line %d: %w", expr, d.Directive, d.Line, err)
+}
+
+//nolint:gochecknoglobals
+var pcreNamedGroup = regexp.MustCompile(`\(\?(?:<(\w+)>|'(\w+)')`)
+
+// normalizePath merges the slashes and resolves the "." and ".." segments of a path like nginx does.
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
@@ -0,0 +1,123 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload_Route(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("route", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	// the expected route is written as the file and line of the server, then of the location
+	testcases := map[string]struct {
+		url      string
+		expected string
+	}{
+		"exact name":                {"http://example.com/", "nginx.conf:3 nginx.conf:6"},
+		"host is case insensitive":  {"http://WWW.Example.COM./", "nginx.conf:3 nginx.conf:6"},
+		"exact location":            {"http://example.com/exact", "nginx.conf:3 nginx.conf:9"},
+		"exact location prefix":     {"http://example.com/exact/more", "nginx.conf:3 nginx.conf:6"},
+		"nested regex":              {"http://example.com/images/a.png", "nginx.conf:3 nginx.conf:13"},
+		"regex before prefix":       {"http://example.com/images/a.jpg", "nginx.conf:3 nginx.conf:20"},
+		"prefix without regex":      {"http://example.com/images/a.svg", "nginx.conf:3 nginx.conf:12"},
+		"no regex after ^~":         {"http://example.com/static/a.gif", "nginx.conf:3 nginx.conf:17"},
+		"case insensitive regex":    {"http://example.com/A.JPG", "nginx.conf:3 nginx.conf:20"},
+		"nested prefix":             {"http://example.com/api/v2/users", "nginx.conf:3 nginx.conf:24"},
+		"normalized path":           {"http://example.com//api/v1/../v2/users", "nginx.conf:3 nginx.conf:24"},
+		"leading wildcard":          {"http://foo.example.com/", "nginx.conf:40 -"},
+		"trailing wildcard":         {"http://mail.example.org/", "nginx.conf:44 -"},
+		"regex name":                {"http://alice.users.example.org/", "nginx.conf:48 -"},
+		"default server":            {"http://unknown.org/", "nginx.conf:32 nginx.conf:36"},
+		"default server of port":    {"https://unknown.org/", "nginx.conf:32 nginx.conf:36"},
+		"included server and regex": {"https://api.example.com/v2/users", "api.conf:1 api.conf:7"},
+		"included server prefix":    {"https://api.example.com/v2/groups", "api.conf:1 api.conf:4"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			route, err := payload.Route(tc.url)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, routeString(route))
+		})
+	}
+}
+
+func TestPayload_RouteRequest(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("route", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	// servers listening on the address of the request take precedence
+	route, err := payload.RouteRequest(RouteRequest{Addr: "10.0.0.1", Port: 80, Host: "example.com", Path: "/"})
+	require.NoError(t, err)
+	require.Equal(t, "nginx.conf:52 -", routeString(route))
+	require.Equal(t, []string{"internal"}, route.Server.ServerNames)
+
+	route, err = payload.RouteRequest(RouteRequest{Addr: "10.0.0.2", Port: 80, Host: "example.com", Path: "/"})
+	require.NoError(t, err)
+	require.Equal(t, "nginx.conf:3 nginx.conf:6", routeString(route))
+
+	_, err = payload.RouteRequest(RouteRequest{Port: 8080, Host: "example.com", Path: "/"})
+	require.ErrorIs(t, err, ErrNoServer)
+
+	_, err = payload.Route("http://example.com:x/")
+	require.Error(t, err)
+}
+
+func routeString(r *Route) string {
+	s := fmt.Sprintf("%s:%d", filepath.Base(r.ServerMatch.File), r.ServerMatch.Line)
+	if r.Location == nil {
+		return s + " -"
+	}
+	return fmt.Sprintf("%s %s:%d", s, filepath.Base(r.LocationMatch.File), r.LocationMatch.Line)
+}
+
+func TestPayload_Route_regexErrors(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"nginx.conf": `http {
+    server {
+        listen 80;
+        server_name example.com ~^(\w)\1\.example\.com$ ~^www\.;
+        location = /exact {
+        }
+        location ~ ^/(?=users)(\w+)$ {
+        }
+        location ~ ^/(\w+)$ {
+        }
+    }
+}
+`,
+	}
+	payload, err := ParseFiles(files, "nginx.conf", &ParseOptions{})
+	require.NoError(t, err)
+
+	// regular expressions that regexp cannot compile are treated as not matching and reported
+	route, err := payload.Route("http://aa.example.com/users")
+	require.NoError(t, err)
+	require.Equal(t, "nginx.conf:2 nginx.conf:9", routeString(route))
+	require.Len(t, route.RegexErrors, 2)
+	require.EqualError(t, route.RegexErrors[0], `cannot match regular expression "^(\\w)\\1\\.example\\.com$" of "server" directive `+
+		"on line 2: error parsing regexp: invalid escape sequence: `\\1`")
+	require.ErrorContains(t, route.RegexErrors[1], `cannot match regular expression "^/(?=users)(\\w+)$" of "location" directive on line 7`)
+
+	// no regular expression is evaluated for an exact name and an exact location
+	route, err = payload.Route("http://example.com/exact")
+	require.NoError(t, err)
+	require.Equal(t, "nginx.conf:2 nginx.conf:5", routeString(route))
+	require.Empty(t, route.RegexErrors)
+}
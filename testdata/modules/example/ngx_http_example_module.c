@@ -0,0 +1,49 @@
+
+/*
+ * Copyright (C) Example
+ */
+
+
+#include <ngx_config.h>
+#include <ngx_core.h>
+#include <ngx_http.h>
+
+
+static ngx_command_t  ngx_http_example_commands[] = {
+
+    { ngx_string("example"),
+      NGX_HTTP_MAIN_CONF|NGX_HTTP_SRV_CONF|NGX_HTTP_LOC_CONF|NGX_CONF_FLAG,
+      ngx_conf_set_flag_slot,
+      NGX_HTTP_LOC_CONF_OFFSET,
+      offsetof(ngx_http_example_loc_conf_t, enable),
+      NULL },
+
+    /* { ngx_string("example_commented"), NGX_HTTP_MAIN_CONF|NGX_CONF_TAKE1, ... }, */
+
+#if (NGX_HTTP_SSL)
+
+    { ngx_string("example_zone"),
+      NGX_HTTP_MAIN_CONF|NGX_CONF_TAKE12,
+      ngx_http_example_zone,
+      0,
+      0,
+      NULL },
+
+#endif
+
+    { ngx_string("example_block"),
+      NGX_HTTP_SRV_CONF|NGX_CONF_BLOCK|NGX_CONF_NOARGS,
+      ngx_http_example_block,
+      NGX_HTTP_SRV_CONF_OFFSET,
+      0,
+      NULL },
+
+    { ngx_string("example_seven"),
+      NGX_HTTP_LOC_CONF|NGX_CONF_TAKE7,
+      ngx_http_example_seven,
+      NGX_HTTP_LOC_CONF_OFFSET,
+      0,
+      NULL },
+
+      ngx_null_command
+};
@@ -0,0 +1,22 @@
+
+/*
+ * Copyright (C) Example
+ */
+
+
+#include <ngx_config.h>
+#include <ngx_core.h>
+#include <ngx_stream.h>
+
+
+static ngx_command_t  ngx_stream_example_commands[] = {
+
+    { ngx_string("example"),
+      NGX_STREAM_MAIN_CONF|NGX_STREAM_SRV_CONF|NGX_CONF_FLAG,
+      ngx_conf_set_flag_slot,
+      NGX_STREAM_SRV_CONF_OFFSET,
+      offsetof(ngx_stream_example_srv_conf_t, enable),
+      NULL },
+
+      ngx_null_command
+};
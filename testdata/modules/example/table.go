@@ -0,0 +1,21 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+//nolint:gochecknoglobals
+var exampleDirectives = map[string][]uint{
+	"example": {
+		ngxHTTPMainConf | ngxHTTPSrvConf | ngxHTTPLocConf | ngxConfFlag,
+	},
+	"example_block": {
+		ngxHTTPSrvConf | ngxConfBlock | ngxConfTake1,
+	},
+	"example_removed": {
+		ngxHTTPMainConf | ngxConfTake1,
+	},
+}
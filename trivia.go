@@ -0,0 +1,184 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"strings"
+)
+
+// usesTrivia returns true if a config can be built with buildWithTrivia: it was parsed without errors,
+// so that its trivia account for all of its source, and the trivia of its directives are complete.
+func usesTrivia(config Config) bool {
+	return config.Trivia != nil && config.Status == "ok" && triviaCovers(config.Parsed)
+}
+
+// triviaCovers returns true if every directive of a block that has trivia has its raw source, and the
+// closing text of its block if its raw source opens one.
+func triviaCovers(block Directives) bool {
+	for _, stmt := range block {
+		t := stmt.Trivia
+		if t == nil {
+			continue
+		}
+		if !t.Inline && t.Raw == "" {
+			return false
+		}
+		if strings.HasSuffix(t.Raw, "{") != strings.HasSuffix(t.Closing, "}") {
+			return false
+		}
+		if !triviaCovers(stmt.Block) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildWithTrivia writes a config parsed with ParseOptions.ParseTrivia. Directives that have not been
+// modified since they were parsed are written exactly as they were parsed, including the whitespace
+// and comments around them. Modified directives keep their surrounding whitespace and the original
+// quoting of their unchanged tokens, and directives without trivia are indented like their siblings.
+func buildWithTrivia(sb *strings.Builder, config Config, options *BuildOptions) {
+	buildTriviaBlock(sb, config.Parsed, "", options)
+	sb.WriteString(config.Trivia.Closing)
+}
+
+//nolint:gocognit
+func buildTriviaBlock(sb *strings.Builder, block Directives, indent string, options *BuildOptions) {
+	indent = blockIndent(block, indent)
+	rawWritten := false
+
+	for _, stmt := range block {
+		t := stmt.Trivia
+
+		// comments found between the args of a directive are part of its raw source
+		if t != nil && t.Inline {
+			if !rawWritten && stmt.IsComment() {
+				sb.WriteString(" #")
+				sb.WriteString(*stmt.Comment)
+			}
+			continue
+		}
+
+		if t == nil {
+			buildWithoutTrivia(sb, stmt, indent, options)
+			rawWritten = false
+			continue
+		}
+
+		sb.WriteString(t.Leading)
+		wasBlock := t.Closing != ""
+		if t.unmodified(stmt) && stmt.IsBlock() == wasBlock {
+			sb.WriteString(t.Raw)
+			rawWritten = true
+		} else {
+			if ext, ok := options.extBuilders[stmt.Directive]; ok && !stmt.IsComment() {
+				sb.WriteString(ext.Build(stmt))
+				rawWritten = false
+				continue
+			}
+			buildHeadWithTrivia(sb, stmt, t)
+			rawWritten = false
+		}
+
+		if stmt.IsBlock() {
+			own := indentOf(t.Leading, indent)
+			buildTriviaBlock(sb, stmt.Block, own+indentUnit(options), options)
+			if wasBlock {
+				sb.WriteString(t.Closing)
+			} else {
+				sb.WriteString("\n")
+				sb.WriteString(own)
+				sb.WriteString("}")
+			}
+		}
+	}
+}
+
+// buildHeadWithTrivia writes a modified directive up to its ";" or "{", reusing the original
+// quoting of the tokens that have not changed.
+func buildHeadWithTrivia(sb *strings.Builder, stmt *Directive, t *Trivia) {
+	if stmt.IsComment() {
+		sb.WriteString("#")
+		sb.WriteString(*stmt.Comment)
+		return
+	}
+
+	// the tokens of an "if" don't line up with its args since parentheses are stripped
+	aligned := len(t.Tokens) == len(t.Values) && stmt.Directive != "if"
+	token := func(i int, value string) string {
+		if aligned && i < len(t.Values) && t.Values[i] == value {
+			return t.Tokens[i]
+		}
+		return Enquote(value)
+	}
+
+	sb.WriteString(token(0, stmt.Directive))
+	if stmt.Directive == "if" {
+		sb.WriteString(" (")
+		for i, arg := range stmt.Args {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(Enquote(arg))
+		}
+		sb.WriteString(")")
+	} else {
+		for i, arg := range stmt.Args {
+			sb.WriteString(" ")
+			sb.WriteString(token(i+1, arg))
+		}
+	}
+
+	if stmt.IsBlock() {
+		sb.WriteString(" {")
+	} else {
+		sb.WriteString(";")
+	}
+}
+
+// buildWithoutTrivia writes a directive that was not parsed, e.g. one that was added to the payload,
+// on a new line with the given indentation.
+func buildWithoutTrivia(sb *strings.Builder, stmt *Directive, indent string, options *BuildOptions) {
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(indent)
+
+	var body strings.Builder
+	buildBlock(&body, nil, Directives{stmt}, 0, 0, options)
+	sb.WriteString(strings.ReplaceAll(body.String(), "\n", "\n"+indent))
+}
+
+// blockIndent returns the indentation of the first directive of a block that starts on its own line,
+// or def if there is no such directive.
+func blockIndent(block Directives, def string) string {
+	for _, stmt := range block {
+		if stmt.Trivia != nil && strings.Contains(stmt.Trivia.Leading, "\n") {
+			return indentOf(stmt.Trivia.Leading, def)
+		}
+	}
+	return def
+}
+
+// indentOf returns the whitespace that leading text ends with after its last new line,
+// or def if the text has no new line.
+func indentOf(leading string, def string) string {
+	i := strings.LastIndexByte(leading, '\n')
+	if i < 0 {
+		return def
+	}
+	last := leading[i+1:]
+	return last[:len(last)-len(strings.TrimLeft(last, " \t"))]
+}
+
+func indentUnit(options *BuildOptions) string {
+	if options.Tabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", options.Indent)
+}
@@ -0,0 +1,174 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrivia_roundTrip(t *testing.T) {
+	t.Parallel()
+	lua := &Lua{}
+	fixtures := []string{
+		"comments-between-args",
+		"directive-with-space",
+		"empty-value-map",
+		"if-expr",
+		"lua-block-larger",
+		"lua-block-simple",
+		"lua-block-tricky",
+		"messy",
+		"quote-behavior",
+		"quoted-right-brace",
+		"russian-text",
+		"simple",
+		"with-comments",
+	}
+	for _, name := range fixtures {
+		name := name
+		for _, comments := range []bool{true, false} {
+			comments := comments
+			t.Run(fmt.Sprintf("%s/comments=%t", name, comments), func(t *testing.T) {
+				t.Parallel()
+				options := luaParseOptions()
+				options.ParseComments = comments
+				options.ParseTrivia = true
+				options.SingleFile = true
+				path := getTestConfigPath(name, "nginx.conf")
+				payload, err := Parse(path, &options)
+				require.NoError(t, err)
+
+				var buf bytes.Buffer
+				err = Build(&buf, payload.Config[0], &BuildOptions{Builders: []RegisterBuilder{lua.RegisterBuilder()}})
+				require.NoError(t, err)
+
+				original, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, string(original), buf.String())
+			})
+		}
+	}
+}
+
+// TestTrivia_roundTripErrors checks that configs that failed to parse, whose trivia may not match their
+// source, are built like configs parsed without trivia.
+func TestTrivia_roundTripErrors(t *testing.T) {
+	t.Parallel()
+	fixtures := []string{
+		"if-check",
+		"missing-semicolon-above",
+		"missing-semicolon-below",
+		"premature-eof",
+	}
+	for _, name := range fixtures {
+		name := name
+		for _, comments := range []bool{true, false} {
+			comments := comments
+			t.Run(fmt.Sprintf("%s/comments=%t", name, comments), func(t *testing.T) {
+				t.Parallel()
+				path := getTestConfigPath(name, "nginx.conf")
+				options := ParseOptions{ParseComments: comments, SingleFile: true}
+				payload, err := Parse(path, &options)
+				require.NoError(t, err)
+				require.Equal(t, "failed", payload.Config[0].Status)
+				var expected bytes.Buffer
+				require.NoError(t, Build(&expected, payload.Config[0], &BuildOptions{}))
+
+				options.ParseTrivia = true
+				payload, err = Parse(path, &options)
+				require.NoError(t, err)
+				require.NotNil(t, payload.Config[0].Trivia)
+				var buf bytes.Buffer
+				require.NoError(t, Build(&buf, payload.Config[0], &BuildOptions{}))
+				require.Equal(t, expected.String(), buf.String())
+			})
+		}
+	}
+}
+
+func TestTrivia_incomplete(t *testing.T) {
+	t.Parallel()
+	config := "http {\n  server {\n    listen 80;\n  }\n}\n"
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(path, []byte(config), os.ModePerm))
+
+	payload, err := Parse(path, &ParseOptions{ParseTrivia: true})
+	require.NoError(t, err)
+	payload.Config[0].Parsed[0].Block[0].Trivia.Closing = ""
+
+	var buf bytes.Buffer
+	require.NoError(t, Build(&buf, payload.Config[0], &BuildOptions{}))
+	require.Equal(t, "http {\n    server {\n        listen 80;\n    }\n}", buf.String())
+}
+
+func TestTrivia_edits(t *testing.T) {
+	t.Parallel()
+	config := "# top\nevents {\n  worker_connections 1024;\n}\n\nhttp {\n" +
+		"\tlog_format main '$remote_addr' \"$status\";  # formats\n" +
+		"\tserver {\n\t\tlisten   80;\n\t\tserver_name 'example.com';\n\t}\n}\n"
+
+	testcases := map[string]struct {
+		edit     func(p Directives)
+		expected string
+	}{
+		"unmodified": {
+			edit:     func(p Directives) {},
+			expected: config,
+		},
+		"changed arg keeps quoting of other args": {
+			edit: func(p Directives) {
+				p[2].Block[0].Args[2] = "$body_bytes_sent"
+			},
+			expected: strings.Replace(config, `"$status";`, `$body_bytes_sent;`, 1),
+		},
+		"changed arg in nested block": {
+			edit: func(p Directives) {
+				p[2].Block[2].Block[0].Args[0] = "8080"
+			},
+			expected: strings.Replace(config, "listen   80;", "listen 8080;", 1),
+		},
+		"added directive is indented like its siblings": {
+			edit: func(p Directives) {
+				server := p[2].Block[2]
+				server.Block = append(server.Block, &Directive{Directive: "root", Args: []string{"/srv/www"}})
+			},
+			expected: strings.Replace(config, "'example.com';\n", "'example.com';\n\t\troot /srv/www;\n", 1),
+		},
+		"removed directive": {
+			edit: func(p Directives) {
+				events := p[1]
+				events.Block = Directives{}
+			},
+			expected: strings.Replace(config, "\n  worker_connections 1024;", "", 1),
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "nginx.conf")
+			require.NoError(t, os.WriteFile(path, []byte(config), os.ModePerm))
+
+			payload, err := Parse(path, &ParseOptions{ParseComments: true, ParseTrivia: true})
+			require.NoError(t, err)
+			tc.edit(payload.Config[0].Parsed)
+
+			var buf bytes.Buffer
+			require.NoError(t, Build(&buf, payload.Config[0], &BuildOptions{}))
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
@@ -8,6 +8,8 @@
 package crossplane
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -23,6 +25,8 @@ type PayloadError struct {
 	Line     *int        `json:"line"`
 	Error    error       `json:"error"`
 	Callback interface{} `json:"callback,omitempty"`
+	// structured adds the structured form of Error to JSON, see ParseOptions.StructuredErrors.
+	structured bool
 }
 
 type Config struct {
@@ -30,11 +34,134 @@ type Config struct {
 	Status string        `json:"status"`
 	Errors []ConfigError `json:"errors"`
 	Parsed Directives    `json:"parsed"`
+	// Context is the block context the file was parsed in, e.g. ["http", "server"] for a file
+	// included from a server block. It is empty for the main config file.
+	Context []string `json:"context,omitempty"`
+	// Trivia is only set when parsing with ParseOptions.ParseTrivia, its Closing field holds
+	// the source text after the last directive of the file.
+	Trivia *Trivia `json:"trivia,omitempty"`
 }
 
 type ConfigError struct {
 	Line  *int  `json:"line"`
 	Error error `json:"error"`
+	// structured adds the structured form of Error to JSON, see ParseOptions.StructuredErrors.
+	structured bool
+}
+
+// An error is written to JSON as its message, like Python crossplane does. With
+// ParseOptions.StructuredErrors, it is followed by the structured form of the error if it is
+// a ParseError, so that it can be read back from JSON.
+type payloadErrorJSON struct {
+	File       string          `json:"file"`
+	Line       *int            `json:"line"`
+	Error      *string         `json:"error"`
+	ParseError *parseErrorJSON `json:"parse_error,omitempty"`
+	Callback   interface{}     `json:"callback,omitempty"`
+}
+
+type configErrorJSON struct {
+	Line       *int            `json:"line"`
+	Error      *string         `json:"error"`
+	ParseError *parseErrorJSON `json:"parse_error,omitempty"`
+}
+
+func errorToJSON(err error, structured bool) (*string, *parseErrorJSON) {
+	if err == nil {
+		return nil, nil
+	}
+	msg := err.Error()
+	var perr *ParseError
+	if structured && errors.As(err, &perr) {
+		pe := perr.toJSON()
+		return &msg, &pe
+	}
+	return &msg, nil
+}
+
+func errorFromJSON(msg *string, pe *parseErrorJSON) error {
+	if pe != nil {
+		return pe.toParseError()
+	}
+	if msg == nil {
+		return nil
+	}
+	// a message without structured form, e.g. from Python crossplane, is a ParseError
+	// if it looks like one
+	if perr := parseErrorMessage(*msg); perr.File != nil && perr.Error() == *msg {
+		return perr
+	}
+	return errors.New(*msg)
+}
+
+func (e PayloadError) MarshalJSON() ([]byte, error) {
+	msg, pe := errorToJSON(e.Error, e.structured)
+	return json.Marshal(payloadErrorJSON{File: e.File, Line: e.Line, Error: msg, ParseError: pe, Callback: e.Callback})
+}
+
+func (e *PayloadError) UnmarshalJSON(b []byte) error {
+	var pe payloadErrorJSON
+	if err := json.Unmarshal(b, &pe); err != nil {
+		return err
+	}
+	*e = PayloadError{
+		File:       pe.File,
+		Line:       pe.Line,
+		Error:      errorFromJSON(pe.Error, pe.ParseError),
+		Callback:   pe.Callback,
+		structured: pe.ParseError != nil,
+	}
+	return nil
+}
+
+func (e ConfigError) MarshalJSON() ([]byte, error) {
+	msg, pe := errorToJSON(e.Error, e.structured)
+	return json.Marshal(configErrorJSON{Line: e.Line, Error: msg, ParseError: pe})
+}
+
+func (e *ConfigError) UnmarshalJSON(b []byte) error {
+	var ce configErrorJSON
+	if err := json.Unmarshal(b, &ce); err != nil {
+		return err
+	}
+	*e = ConfigError{Line: ce.Line, Error: errorFromJSON(ce.Error, ce.ParseError), structured: ce.ParseError != nil}
+	return nil
+}
+
+// UnmarshalJSON reads a payload written by Parse or by Python crossplane. Missing errors and
+// configs are read as empty lists, like Parse emits them.
+func (p *Payload) UnmarshalJSON(b []byte) error {
+	type payload Payload // avoids recursion
+	var pl payload
+	if err := json.Unmarshal(b, &pl); err != nil {
+		return err
+	}
+	*p = Payload(pl)
+	if p.Errors == nil {
+		p.Errors = []PayloadError{}
+	}
+	if p.Config == nil {
+		p.Config = []Config{}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads a config written by Parse or by Python crossplane. Missing errors and
+// directives are read as empty lists, like Parse emits them.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config // avoids recursion
+	var cfg config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	*c = Config(cfg)
+	if c.Errors == nil {
+		c.Errors = []ConfigError{}
+	}
+	if c.Parsed == nil {
+		c.Parsed = Directives{}
+	}
+	return nil
 }
 
 type Directive struct {
@@ -45,9 +172,71 @@ type Directive struct {
 	Includes  []int      `json:"includes,omitempty"`
 	Block     Directives `json:"block,omitempty"`
 	Comment   *string    `json:"comment,omitempty"`
+	// Range spans the directive from the start of its name to the end of its ";" or closing "}".
+	// It is only set when parsing with ParseOptions.ParseRanges.
+	Range *Range `json:"range,omitempty"`
+	// ArgRanges holds the range of each of Args. It is only set when parsing with ParseOptions.ParseRanges.
+	ArgRanges []Range `json:"arg_ranges,omitempty"`
+	// Trivia holds the source text around the tokens of the directive. It is only set when parsing
+	// with ParseOptions.ParseTrivia.
+	Trivia *Trivia `json:"trivia,omitempty"`
 }
 type Directives []*Directive
 
+// Trivia is the source text of a directive that is not captured by its name and arguments:
+// the whitespace and comments around it, and the original quoting of its tokens. Build uses it
+// to write a directive that has not been modified since it was parsed exactly as it was parsed.
+type Trivia struct {
+	// Leading is the text between the end of the previous directive, or the "{" of the
+	// enclosing block, and the start of the directive.
+	Leading string `json:"leading,omitempty"`
+	// Raw is the source text of the directive, from its name up to and including its ";" or "{".
+	Raw string `json:"raw,omitempty"`
+	// Closing is the text of a block from the end of its last directive up to and including its "}".
+	Closing string `json:"closing,omitempty"`
+	// Tokens is the source text of the directive name and of each argument, including quotes.
+	Tokens []string `json:"tokens,omitempty"`
+	// Values is the directive name and arguments as they were parsed, it is used to tell
+	// whether the directive has been modified since.
+	Values []string `json:"values,omitempty"`
+	// Inline is true for a comment found between the arguments of the directive before it,
+	// the comment is part of the Raw source of that directive.
+	Inline bool `json:"inline,omitempty"`
+}
+
+// unmodified returns true if the directive still has the name and arguments it was parsed with.
+func (t *Trivia) unmodified(d *Directive) bool {
+	if d.IsComment() {
+		return len(t.Values) == 1 && t.Values[0] == "#"+*d.Comment
+	}
+	return len(t.Values) == len(d.Args)+1 && t.Values[0] == d.Directive && equals(t.Values[1:], d.Args)
+}
+
+// Position is a location in a config file.
+type Position struct {
+	Line   int `json:"line"`   // line number, starting at 1
+	Column int `json:"column"` // column number, starting at 1 (byte count)
+	Offset int `json:"offset"` // byte offset, starting at 0
+}
+
+// advance returns the position right after s, when s starts at p.
+func (p Position) advance(s string) Position {
+	p.Offset += len(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.Line += strings.Count(s, "\n")
+		p.Column = len(s) - i
+	} else {
+		p.Column += len(s)
+	}
+	return p
+}
+
+// Range is the span of source text between Start and End, End being the position right after it.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
 // IsBlock returns true if this is a block directive.
 func (d Directive) IsBlock() bool {
 	return d.Block != nil
@@ -8,9 +8,12 @@
 package crossplane
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDirective_String(t *testing.T) {
@@ -293,3 +296,89 @@ func TestDirective_Equal(t *testing.T) {
 		assert.Equal(t, eq, ef.equal)
 	}
 }
+
+func TestPayload_JSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"bad-args", "invalid-map", "spelling-mistake", "includes-regular"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			payload, err := Parse(getTestConfigPath(name, "nginx.conf"), &ParseOptions{
+				ErrorOnUnknownDirectives: true,
+				StructuredErrors:         true,
+			})
+			require.NoError(t, err)
+
+			b, err := json.Marshal(payload)
+			require.NoError(t, err)
+
+			var decoded Payload
+			require.NoError(t, json.Unmarshal(b, &decoded))
+			require.Equal(t, len(payload.Errors), len(decoded.Errors))
+			for i, e := range payload.Errors {
+				require.Equal(t, e.Error.Error(), decoded.Errors[i].Error.Error())
+				var perr *ParseError
+				if errors.As(e.Error, &perr) {
+					var decodedErr *ParseError
+					require.True(t, errors.As(decoded.Errors[i].Error, &decodedErr))
+					require.Equal(t, perr.Statement, decodedErr.Statement)
+					require.Equal(t, perr.BlockCtx, decodedErr.BlockCtx)
+					require.Equal(t, perr.Column, decodedErr.Column)
+				}
+			}
+
+			b2, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			require.JSONEq(t, string(b), string(b2))
+
+			require.NoError(t, BuildFiles(decoded, t.TempDir(), &BuildOptions{}))
+		})
+	}
+}
+
+func TestPayload_MarshalJSON_structuredErrors(t *testing.T) {
+	t.Parallel()
+	path := getTestConfigPath("spelling-mistake", "nginx.conf")
+	payload, err := Parse(path, &ParseOptions{ErrorOnUnknownDirectives: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, payload.Errors)
+
+	// errors are written like Python crossplane writes them by default
+	b, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "parse_error")
+
+	var decoded Payload
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	var perr *ParseError
+	require.True(t, errors.As(decoded.Errors[0].Error, &perr))
+	require.Equal(t, payload.Errors[0].Error.Error(), perr.Error())
+	require.Empty(t, perr.Statement)
+
+	payload, err = Parse(path, &ParseOptions{ErrorOnUnknownDirectives: true, StructuredErrors: true})
+	require.NoError(t, err)
+	b, err = json.Marshal(payload)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"parse_error":{"what":`)
+}
+
+func TestPayload_UnmarshalJSON_python(t *testing.T) {
+	t.Parallel()
+	// errors written by Python crossplane only have a message
+	content := `{"status":"failed","errors":[{"file":"nginx.conf","line":2,"error":"unknown directive \"foo\" in nginx.conf:2"},` +
+		`{"file":"nginx.conf","line":null,"error":"[Errno 2] No such file or directory: 'x.conf'"}],` +
+		`"config":[{"file":"nginx.conf","status":"failed","errors":[{"line":2,"error":"unknown directive \"foo\" in nginx.conf:2"}],` +
+		`"parsed":[{"directive":"events","line":1,"args":[],"block":[]}]}]}`
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal([]byte(content), &payload))
+	require.Len(t, payload.Errors, 2)
+
+	var perr *ParseError
+	require.True(t, errors.As(payload.Errors[0].Error, &perr))
+	require.Equal(t, `unknown directive "foo"`, perr.What)
+	require.Equal(t, 2, *perr.Line)
+	require.False(t, errors.As(payload.Errors[1].Error, &perr))
+	require.Equal(t, "[Errno 2] No such file or directory: 'x.conf'", payload.Errors[1].Error.Error())
+	require.Equal(t, `unknown directive "foo" in nginx.conf:2`, payload.Config[0].Errors[0].Error.Error())
+}
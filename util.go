@@ -67,13 +67,40 @@ func validExpr(d *Directive) bool {
 			(l > 2))
 }
 
-// prepareIfArgs removes parentheses from an `if` directive's arguments.
-func prepareIfArgs(d *Directive) *Directive {
+// prepareIfArgs removes parentheses from an `if` directive's arguments. quoted tells which
+// arguments were quoted, it is only needed to adjust the ArgRanges of the directive.
+func prepareIfArgs(d *Directive, quoted []bool) *Directive {
 	b := 0
 	e := len(d.Args) - 1
 	if len(d.Args) > 0 && strings.HasPrefix(d.Args[0], "(") && strings.HasSuffix(d.Args[e], ")") {
+		first := d.Args[0]
 		d.Args[0] = strings.TrimLeftFunc(strings.TrimPrefix(d.Args[0], "("), unicode.IsSpace)
+		leading := first[:len(first)-len(d.Args[0])]
+		last := d.Args[e]
 		d.Args[e] = strings.TrimRightFunc(strings.TrimSuffix(d.Args[e], ")"), unicode.IsSpace)
+		trailing := last[len(d.Args[e]):]
+
+		// keep the argument ranges on the remaining text of the arguments, inside the quotes
+		// of quoted arguments since only part of their text remains
+		if len(d.ArgRanges) == len(d.Args) {
+			ends := []int{0}
+			if e > 0 {
+				ends = append(ends, e)
+			}
+			for _, i := range ends {
+				if i < len(quoted) && quoted[i] {
+					d.ArgRanges[i].Start = d.ArgRanges[i].Start.advance(`"`)
+					d.ArgRanges[i].End.Offset--
+					d.ArgRanges[i].End.Column--
+				}
+			}
+			d.ArgRanges[0].Start = d.ArgRanges[0].Start.advance(leading)
+			if !strings.Contains(trailing, "\n") {
+				d.ArgRanges[e].End.Offset -= len(trailing)
+				d.ArgRanges[e].End.Column -= len(trailing)
+			}
+		}
+
 		if len(d.Args[0]) == 0 {
 			b++
 		}
@@ -81,6 +108,9 @@ func prepareIfArgs(d *Directive) *Directive {
 			e--
 		}
 		d.Args = d.Args[b : e+1]
+		if len(d.ArgRanges) > e {
+			d.ArgRanges = d.ArgRanges[b : e+1]
+		}
 	}
 	return d
 }
@@ -0,0 +1,454 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Variable is a definition of, or a reference to, a variable in a directive of a payload.
+type Variable struct {
+	// Name is the name of the variable without the "$", like "host".
+	Name      string
+	Directive *Directive
+	File      string
+	Line      int
+	// Capture is true for a variable defined by a named capture of a regular expression.
+	Capture bool
+}
+
+// VariableAnalysis holds the variables defined and referenced by the directives of a payload.
+type VariableAnalysis struct {
+	// Definitions holds the variables defined by set, map, geo, split_clients and other directives
+	// defining variables, and by the named captures of regular expressions, in the order of the payload.
+	Definitions []Variable
+	// References holds the variables referenced in the arguments of directives, in the order of
+	// the payload. Regex captures like "$1" are not references.
+	References []Variable
+}
+
+// Variables returns the variables defined and referenced by the directives of the payload. Arguments
+// that are not evaluated by nginx, like regular expressions or the code of the perl and lua modules,
+// are not searched for references.
+func (p *Payload) Variables() *VariableAnalysis {
+	a := &VariableAnalysis{}
+	seen := map[*Directive]bool{}
+	visit := func(d *Directive, ctx *WalkContext) bool {
+		if seen[d] {
+			return false
+		}
+		seen[d] = true
+		parent := ""
+		if parents := blockParents(ctx.Parents); len(parents) > 0 {
+			parent = parents[len(parents)-1].Directive
+		}
+		a.analyze(d, parent, ctx.Config.File)
+		return true
+	}
+	// configs that are not included are walked after the included ones
+	p.Inspect(visit, true)
+	p.Inspect(visit, false)
+	return a
+}
+
+// Undefined returns the references to variables that are neither built into nginx nor defined in the payload.
+func (a *VariableAnalysis) Undefined() []Variable {
+	defined := map[string]bool{}
+	for _, v := range a.Definitions {
+		defined[v.Name] = true
+	}
+	var undefined []Variable
+	for _, v := range a.References {
+		if !defined[v.Name] && !IsBuiltinVariable(v.Name) {
+			undefined = append(undefined, v)
+		}
+	}
+	return undefined
+}
+
+// Unused returns the definitions of variables that are never referenced. Named captures of regular
+// expressions and variables read by nginx itself, like $limit_rate, are not reported.
+func (a *VariableAnalysis) Unused() []Variable {
+	referenced := map[string]bool{}
+	for _, v := range a.References {
+		referenced[v.Name] = true
+	}
+	var unused []Variable
+	for _, v := range a.Definitions {
+		if !referenced[v.Name] && !settableVariables[v.Name] && !v.Capture {
+			unused = append(unused, v)
+		}
+	}
+	return unused
+}
+
+// Shadowed returns the definitions of variables that have the name of a built-in variable, other
+// than the ones that may be set, like $args or $limit_rate.
+func (a *VariableAnalysis) Shadowed() []Variable {
+	var shadowed []Variable
+	for _, v := range a.Definitions {
+		if IsBuiltinVariable(v.Name) && !settableVariables[v.Name] {
+			shadowed = append(shadowed, v)
+		}
+	}
+	return shadowed
+}
+
+func (a *VariableAnalysis) define(d *Directive, file, arg string) {
+	if name, ok := variableName(arg); ok {
+		a.Definitions = append(a.Definitions, Variable{Name: name, Directive: d, File: file, Line: d.Line})
+	}
+}
+
+func (a *VariableAnalysis) reference(d *Directive, file string, args ...string) {
+	for _, arg := range args {
+		for _, name := range VariableNames(arg) {
+			if !isDigits(name) {
+				a.References = append(a.References, Variable{Name: name, Directive: d, File: file, Line: d.Line})
+			}
+		}
+	}
+}
+
+func (a *VariableAnalysis) captures(d *Directive, file, expr string) {
+	for _, m := range namedGroup.FindAllStringSubmatch(expr, -1) {
+		name := m[1] + m[2] + m[3]
+		a.Definitions = append(a.Definitions, Variable{Name: name, Directive: d, File: file, Line: d.Line, Capture: true})
+	}
+}
+
+// analyze adds the variables of a directive, parent is the name of the block it is in.
+//
+//nolint:gocyclo,funlen
+func (a *VariableAnalysis) analyze(d *Directive, parent, file string) {
+	if d.IsComment() {
+		return
+	}
+
+	// the bodies of map-like blocks do not have directives
+	switch parent {
+	case "map":
+		if strings.HasPrefix(d.Directive, "~") {
+			a.captures(d, file, strings.TrimPrefix(d.Directive[1:], "*"))
+		}
+		a.reference(d, file, d.Args...)
+		return
+	case "geoip2":
+		a.define(d, file, d.Directive)
+		a.reference(d, file, d.Args...)
+		return
+	case "geo", "split_clients", "types", "charset_map", "match", "otel_exporter":
+		return
+	}
+
+	args := d.Args
+	switch d.Directive {
+	case "set", "js_var":
+		if len(args) > 0 {
+			a.define(d, file, args[0])
+			a.reference(d, file, args[1:]...)
+		}
+	case "map", "auth_request_set", "auth_jwt_claim_set", "auth_jwt_header_set":
+		if len(args) > 1 {
+			a.reference(d, file, args[0])
+			a.define(d, file, args[1])
+			a.reference(d, file, args[2:]...)
+		}
+	case "geo":
+		// geo takes the address as an optional first argument
+		if len(args) > 0 {
+			a.reference(d, file, args[:len(args)-1]...)
+			a.define(d, file, args[len(args)-1])
+		}
+	case "split_clients":
+		if len(args) > 1 {
+			a.reference(d, file, args[0])
+			a.define(d, file, args[1])
+		}
+	case "js_set", "perl_set":
+		if len(args) > 0 {
+			a.define(d, file, args[0])
+		}
+	case "location":
+		// the paths of locations do not have variables
+		if modifier, path := locationPath(args); modifier == "~" || modifier == "~*" {
+			a.captures(d, file, path)
+		}
+	case "server_name":
+		for _, name := range args {
+			if strings.HasPrefix(name, "~") {
+				a.captures(d, file, name[1:])
+			}
+		}
+	case "rewrite":
+		if len(args) > 0 {
+			a.captures(d, file, args[0])
+			a.reference(d, file, args[1:]...)
+		}
+	case "if":
+		for i, arg := range args {
+			if i > 0 && isRegexOperator(args[i-1]) {
+				a.captures(d, file, arg)
+			} else {
+				a.reference(d, file, arg)
+			}
+		}
+	case "perl":
+		// the arguments are perl code
+	default:
+		if !strings.Contains(d.Directive, "_by_lua") {
+			a.reference(d, file, args...)
+		}
+	}
+}
+
+func isRegexOperator(s string) bool {
+	return s == "~" || s == "~*" || s == "!~" || s == "!~*"
+}
+
+// variableName returns the name of the variable of an argument that defines a variable, like "$name".
+func variableName(arg string) (string, bool) {
+	names := VariableNames(arg)
+	if len(names) != 1 || !strings.HasPrefix(arg, "$") || (arg != "$"+names[0] && arg != "${"+names[0]+"}") {
+		return "", false
+	}
+	return names[0], true
+}
+
+// VariableNames returns the names of the variables referenced in an argument, in order, like "scheme"
+// and "host" for "$scheme://${host}". Regex captures are returned with their number, like "1" for "$1".
+func VariableNames(arg string) []string {
+	var names []string
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != '$' || i+1 == len(arg) {
+			continue
+		}
+		if arg[i+1] == '{' {
+			if end := strings.IndexByte(arg[i+2:], '}'); end > 0 {
+				names = append(names, arg[i+2:i+2+end])
+				i += end + 2
+			}
+			continue
+		}
+		if c := arg[i+1]; c >= '1' && c <= '9' {
+			// captures have a single digit
+			names = append(names, arg[i+1:i+2])
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(arg) && isVariableChar(arg[j]) {
+			j++
+		}
+		if j > i+1 {
+			names = append(names, arg[i+1:j])
+		}
+		i = j - 1
+	}
+	return names
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// IsBuiltinVariable returns true if name is a variable of nginx or of one of its modules, like "host"
+// or "http_user_agent".
+func IsBuiltinVariable(name string) bool {
+	if builtinVariables[name] {
+		return true
+	}
+	for _, prefix := range builtinVariablePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedGroup matches the named groups of a regular expression, written as (?<name>...), (?'name'...) or (?P<name>...).
+//
+//nolint:gochecknoglobals
+var namedGroup = regexp.MustCompile(`\(\?(?:<(\w+)>|'(\w+)'|P<(\w+)>)`)
+
+// settableVariables are built-in variables that may be set, or variables read by nginx that are set by configs.
+//
+//nolint:gochecknoglobals
+var settableVariables = map[string]bool{
+	"args":          true,
+	"limit_rate":    true,
+	"memcached_key": true,
+}
+
+// builtinVariablePrefixes are the prefixes of the built-in variables named after a header, an argument or a cookie.
+//
+//nolint:gochecknoglobals
+var builtinVariablePrefixes = []string{
+	"arg_",
+	"cookie_",
+	"http_",
+	"jwt_claim_",
+	"jwt_header_",
+	"proxy_protocol_tlv_",
+	"sent_http_",
+	"sent_trailer_",
+	"upstream_cookie_",
+	"upstream_http_",
+	"upstream_trailer_",
+}
+
+// builtinVariables are the variables of the http and stream modules of nginx.
+//
+//nolint:gochecknoglobals
+var builtinVariables = map[string]bool{
+	// core
+	"args":                       true,
+	"binary_remote_addr":         true,
+	"body_bytes_sent":            true,
+	"bytes_received":             true,
+	"bytes_sent":                 true,
+	"connection":                 true,
+	"connection_requests":        true,
+	"connection_time":            true,
+	"content_length":             true,
+	"content_type":               true,
+	"document_root":              true,
+	"document_uri":               true,
+	"host":                       true,
+	"hostname":                   true,
+	"https":                      true,
+	"is_args":                    true,
+	"limit_rate":                 true,
+	"msec":                       true,
+	"nginx_version":              true,
+	"pid":                        true,
+	"pipe":                       true,
+	"protocol":                   true,
+	"proxy_protocol_addr":        true,
+	"proxy_protocol_port":        true,
+	"proxy_protocol_server_addr": true,
+	"proxy_protocol_server_port": true,
+	"query_string":               true,
+	"realpath_root":              true,
+	"remote_addr":                true,
+	"remote_port":                true,
+	"remote_user":                true,
+	"request":                    true,
+	"request_body":               true,
+	"request_body_file":          true,
+	"request_completion":         true,
+	"request_filename":           true,
+	"request_id":                 true,
+	"request_length":             true,
+	"request_method":             true,
+	"request_time":               true,
+	"request_uri":                true,
+	"scheme":                     true,
+	"server_addr":                true,
+	"server_name":                true,
+	"server_port":                true,
+	"server_protocol":            true,
+	"session_time":               true,
+	"status":                     true,
+	"tcpinfo_rcv_space":          true,
+	"tcpinfo_rtt":                true,
+	"tcpinfo_rttvar":             true,
+	"tcpinfo_snd_cwnd":           true,
+	"time_iso8601":               true,
+	"time_local":                 true,
+	"uri":                        true,
+	// modules
+	"ancient_browser":           true,
+	"date_gmt":                  true,
+	"date_local":                true,
+	"fastcgi_path_info":         true,
+	"fastcgi_script_name":       true,
+	"geoip_area_code":           true,
+	"geoip_city":                true,
+	"geoip_city_continent_code": true,
+	"geoip_city_country_code":   true,
+	"geoip_city_country_code3":  true,
+	"geoip_city_country_name":   true,
+	"geoip_country_code":        true,
+	"geoip_country_code3":       true,
+	"geoip_country_name":        true,
+	"geoip_dma_code":            true,
+	"geoip_latitude":            true,
+	"geoip_longitude":           true,
+	"geoip_org":                 true,
+	"geoip_postal_code":         true,
+	"geoip_region":              true,
+	"geoip_region_name":         true,
+	"gzip_ratio":                true,
+	"http2":                     true,
+	"http3":                     true,
+	"invalid_referer":           true,
+	"jwt_payload":               true,
+	"limit_conn_status":         true,
+	"limit_req_status":          true,
+	"modern_browser":            true,
+	"msie":                      true,
+	"proxy_add_x_forwarded_for": true,
+	"proxy_host":                true,
+	"proxy_port":                true,
+	"realip_remote_addr":        true,
+	"realip_remote_port":        true,
+	"secure_link":               true,
+	"secure_link_expires":       true,
+	"slice_range":               true,
+	"uid_got":                   true,
+	"uid_reset":                 true,
+	"uid_set":                   true,
+	// connections of the stub_status module
+	"connections_active":  true,
+	"connections_reading": true,
+	"connections_waiting": true,
+	"connections_writing": true,
+	// ssl
+	"ssl_alpn_protocol":          true,
+	"ssl_cipher":                 true,
+	"ssl_ciphers":                true,
+	"ssl_client_cert":            true,
+	"ssl_client_escaped_cert":    true,
+	"ssl_client_fingerprint":     true,
+	"ssl_client_i_dn":            true,
+	"ssl_client_i_dn_legacy":     true,
+	"ssl_client_raw_cert":        true,
+	"ssl_client_s_dn":            true,
+	"ssl_client_s_dn_legacy":     true,
+	"ssl_client_serial":          true,
+	"ssl_client_v_end":           true,
+	"ssl_client_v_remain":        true,
+	"ssl_client_v_start":         true,
+	"ssl_client_verify":          true,
+	"ssl_curve":                  true,
+	"ssl_curves":                 true,
+	"ssl_early_data":             true,
+	"ssl_preread_alpn_protocols": true,
+	"ssl_preread_protocol":       true,
+	"ssl_preread_server_name":    true,
+	"ssl_protocol":               true,
+	"ssl_server_name":            true,
+	"ssl_session_id":             true,
+	"ssl_session_reused":         true,
+	// upstream
+	"upstream_addr":             true,
+	"upstream_bytes_received":   true,
+	"upstream_bytes_sent":       true,
+	"upstream_cache_status":     true,
+	"upstream_connect_time":     true,
+	"upstream_first_byte_time":  true,
+	"upstream_header_time":      true,
+	"upstream_last_server_name": true,
+	"upstream_queue_time":       true,
+	"upstream_response_length":  true,
+	"upstream_response_time":    true,
+	"upstream_session_time":     true,
+	"upstream_status":           true,
+}
@@ -0,0 +1,97 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func variableStrings(vars []Variable) []string {
+	s := make([]string, 0, len(vars))
+	for _, v := range vars {
+		s = append(s, fmt.Sprintf("%s:%d", v.Name, v.Line))
+	}
+	return s
+}
+
+func parseVariablesConfig(t *testing.T) *Payload {
+	t.Helper()
+	lua := &Lua{}
+	payload, err := Parse(getTestConfigPath("variables", "nginx.conf"), &ParseOptions{
+		LexOptions: LexOptions{Lexers: []RegisterLexer{lua.RegisterLexer()}},
+	})
+	require.NoError(t, err)
+	return payload
+}
+
+func TestPayload_Variables(t *testing.T) {
+	t.Parallel()
+	a := parseVariablesConfig(t).Variables()
+
+	require.Equal(t, []string{
+		"connection_upgrade:3", "proto:6", "unused_map:8", "internal:11", "variant:14", "sub:22",
+		"host:23", "limit_rate:24", "user:25", "backend:27", "page:34",
+	}, variableStrings(a.Definitions))
+	require.Equal(t, []string{
+		"http_upgrade:3", "proto:6", "request_uri:8", "remote_addr:11", "remote_addr:14",
+		"remote_addr:18", "upstrem_addr:18", "request:18", "variant:18", "internal:26", "user:27",
+		"sub:29", "connection_upgrade:30", "backend:31", "uri:34", "page:35", "missing:35",
+	}, variableStrings(a.References))
+
+	require.Equal(t, []string{"upstrem_addr:18", "missing:35"}, variableStrings(a.Undefined()))
+	require.Equal(t, []string{"unused_map:8", "host:23"}, variableStrings(a.Unused()))
+	require.Equal(t, []string{"host:23"}, variableStrings(a.Shadowed()))
+	require.True(t, a.Definitions[1].Capture)
+	require.Equal(t, "map", a.Definitions[0].Directive.Directive)
+	require.Equal(t, getTestConfigPath("variables", "nginx.conf"), a.Definitions[0].File)
+}
+
+func TestVariableRules(t *testing.T) {
+	t.Parallel()
+	diagnostics := parseVariablesConfig(t).Lint(&LintOptions{Rules: VariableRules()})
+	require.Equal(t, []string{
+		"nginx.conf:8 unused-variable",
+		"nginx.conf:18 undefined-variable",
+		"nginx.conf:23 unused-variable",
+		"nginx.conf:23 shadowed-variable",
+		"nginx.conf:35 undefined-variable",
+	}, diagnosticStrings(diagnostics))
+	require.Equal(t, `unknown "upstrem_addr" variable`, diagnostics[1].Message)
+	require.Equal(t, SeverityError, diagnostics[1].Severity)
+}
+
+func TestVariableNames(t *testing.T) {
+	t.Parallel()
+	testcases := map[string][]string{
+		"":                            nil,
+		"plain":                       nil,
+		"$":                           nil,
+		"$host":                       {"host"},
+		"$scheme://${host}:8080$uri":  {"scheme", "host", "uri"},
+		"${host}name":                 {"host"},
+		"${unterminated":              nil,
+		"/new/$1$23":                  {"1", "2"},
+		"^/path$":                     nil,
+		"$http_x_forwarded_for,$a-$b": {"http_x_forwarded_for", "a", "b"},
+	}
+	for arg, expected := range testcases {
+		require.Equal(t, expected, VariableNames(arg), arg)
+	}
+}
+
+func TestIsBuiltinVariable(t *testing.T) {
+	t.Parallel()
+	require.True(t, IsBuiltinVariable("host"))
+	require.True(t, IsBuiltinVariable("http_user_agent"))
+	require.True(t, IsBuiltinVariable("upstream_http_location"))
+	require.False(t, IsBuiltinVariable("http_"))
+	require.False(t, IsBuiltinVariable("upstrem_addr"))
+}
@@ -0,0 +1,149 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+// WalkContext describes where a directive visited by Walk or Inspect is located.
+// It is only valid for the duration of the callback it is passed to.
+type WalkContext struct {
+	// Payload is the payload being walked, it is nil when walking Directives.
+	Payload *Payload
+	// Config is the config file the directive belongs to, it is nil when walking Directives.
+	Config *Config
+	// Parents holds the ancestors of the directive, outermost first. When following includes,
+	// the include directives that led to the config of the directive are part of its ancestors.
+	Parents Directives
+	// FollowIncludes is true if the walk descends into the configs of include directives.
+	FollowIncludes bool
+
+	// indexes of the configs being walked, used to break include cycles
+	configs []int
+}
+
+// BlockCtx returns the block context of the directive as the parser analyzes it, e.g. ["http", "server"]
+// for a directive in a server block, and ["http", "location"] for a directive in a nested location. It
+// starts with the context the config at the root of the walk was parsed in.
+func (c *WalkContext) BlockCtx() []string {
+	var ctx blockCtx
+	if root := c.root(); root != nil {
+		ctx = append(ctx, root.Context...)
+	}
+	for _, p := range c.Parents {
+		if p.IsBlock() {
+			ctx = enterBlockCtx(p, ctx, nil)
+		}
+	}
+	return ctx
+}
+
+// root returns the config the walk started from, which is the config of the directive unless
+// includes are followed.
+func (c *WalkContext) root() *Config {
+	if len(c.configs) == 0 {
+		return c.Config
+	}
+	return &c.Payload.Config[c.configs[0]]
+}
+
+// Parent returns the directive whose block or included config contains the directive,
+// or nil for a directive at the top level of the walk.
+func (c *WalkContext) Parent() *Directive {
+	if len(c.Parents) == 0 {
+		return nil
+	}
+	return c.Parents[len(c.Parents)-1]
+}
+
+// A Visitor's Pre method is invoked for each directive encountered by Walk, before its children.
+// If Pre returns false, the children of the directive are skipped and Post is not invoked for it.
+// Otherwise the children are visited and Post is invoked afterwards.
+type Visitor interface {
+	Pre(d *Directive, ctx *WalkContext) bool
+	Post(d *Directive, ctx *WalkContext)
+}
+
+// Walk traverses the configs of the payload in depth-first order with v. If followIncludes is true,
+// the walk starts at the main config and the configs of each include directive are walked as children
+// of the directive, otherwise every config is walked separately in the order of the payload.
+func (p *Payload) Walk(v Visitor, followIncludes bool) {
+	w := &walker{v: v, ctx: WalkContext{Payload: p, FollowIncludes: followIncludes}}
+	for i := range p.Config {
+		w.walkConfig(i)
+		if followIncludes {
+			break
+		}
+	}
+}
+
+// Inspect traverses the payload like Walk, calling f for each directive before its children.
+// If f returns false, the children of the directive are skipped.
+func (p *Payload) Inspect(f func(d *Directive, ctx *WalkContext) bool, followIncludes bool) {
+	p.Walk(inspector(f), followIncludes)
+}
+
+// Walk traverses the directives in depth-first order with v.
+func (ds Directives) Walk(v Visitor) {
+	w := &walker{v: v}
+	w.walk(ds)
+}
+
+// Inspect traverses the directives like Walk, calling f for each directive before its children.
+// If f returns false, the children of the directive are skipped.
+func (ds Directives) Inspect(f func(d *Directive, ctx *WalkContext) bool) {
+	ds.Walk(inspector(f))
+}
+
+type inspector func(d *Directive, ctx *WalkContext) bool
+
+func (f inspector) Pre(d *Directive, ctx *WalkContext) bool { return f(d, ctx) }
+func (f inspector) Post(*Directive, *WalkContext)           {}
+
+type walker struct {
+	v   Visitor
+	ctx WalkContext
+}
+
+func (w *walker) walkConfig(idx int) {
+	config := w.ctx.Config
+	w.ctx.Config = &w.ctx.Payload.Config[idx]
+	w.ctx.configs = append(w.ctx.configs, idx)
+	w.walk(w.ctx.Config.Parsed)
+	w.ctx.configs = w.ctx.configs[:len(w.ctx.configs)-1]
+	w.ctx.Config = config
+}
+
+func (w *walker) walk(block Directives) {
+	for _, d := range block {
+		if !w.v.Pre(d, &w.ctx) {
+			continue
+		}
+
+		w.ctx.Parents = append(w.ctx.Parents, d)
+		w.walk(d.Block)
+		if w.ctx.FollowIncludes && d.IsInclude() {
+			for _, idx := range d.Includes {
+				// skip invalid indexes and include cycles
+				if idx < 0 || idx >= len(w.ctx.Payload.Config) || containsInt(w.ctx.configs, idx) {
+					continue
+				}
+				w.walkConfig(idx)
+			}
+		}
+		w.ctx.Parents = w.ctx.Parents[:len(w.ctx.Parents)-1]
+
+		w.v.Post(d, &w.ctx)
+	}
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, s := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
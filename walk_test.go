@@ -0,0 +1,183 @@
+/**
+ * Copyright (c) F5, Inc.
+ *
+ * This source code is licensed under the Apache License, Version 2.0 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package crossplane
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingVisitor struct {
+	events []string
+	skip   string
+}
+
+func (v *recordingVisitor) Pre(d *Directive, ctx *WalkContext) bool {
+	file := ""
+	if ctx.Config != nil {
+		file = filepath.Base(ctx.Config.File)
+	}
+	v.events = append(v.events, "pre "+d.Directive+" ["+strings.Join(ctx.BlockCtx(), ",")+"] "+file)
+	return d.Directive != v.skip
+}
+
+func (v *recordingVisitor) Post(d *Directive, ctx *WalkContext) {
+	v.events = append(v.events, "post "+d.Directive)
+}
+
+func TestPayload_Walk(t *testing.T) {
+	t.Parallel()
+	payload, err := Parse(getTestConfigPath("includes-regular", "nginx.conf"), &ParseOptions{})
+	require.NoError(t, err)
+
+	testcases := map[string]struct {
+		followIncludes bool
+		skip           string
+		events         []string
+	}{
+		"follow includes": {
+			followIncludes: true,
+			events: []string{
+				"pre events [] nginx.conf",
+				"post events",
+				"pre http [] nginx.conf",
+				"pre include [http] nginx.conf",
+				"pre server [http] server.conf",
+				"pre listen [http,server] server.conf",
+				"post listen",
+				"pre server_name [http,server] server.conf",
+				"post server_name",
+				"pre include [http,server] server.conf",
+				"pre location [http,server] foo.conf",
+				"pre return [http,location] foo.conf",
+				"post return",
+				"post location",
+				"post include",
+				"pre include [http,server] server.conf",
+				"post include",
+				"post server",
+				"post include",
+				"post http",
+			},
+		},
+		"skip subtree": {
+			followIncludes: true,
+			skip:           "server",
+			events: []string{
+				"pre events [] nginx.conf",
+				"post events",
+				"pre http [] nginx.conf",
+				"pre include [http] nginx.conf",
+				"pre server [http] server.conf",
+				"post include",
+				"post http",
+			},
+		},
+		"each config separately": {
+			skip: "http",
+			events: []string{
+				"pre events [] nginx.conf",
+				"post events",
+				"pre http [] nginx.conf",
+				"pre server [http] server.conf",
+				"pre listen [http,server] server.conf",
+				"post listen",
+				"pre server_name [http,server] server.conf",
+				"post server_name",
+				"pre include [http,server] server.conf",
+				"post include",
+				"pre include [http,server] server.conf",
+				"post include",
+				"post server",
+				"pre location [http,server] foo.conf",
+				"pre return [http,location] foo.conf",
+				"post return",
+				"post location",
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			v := &recordingVisitor{skip: tc.skip}
+			payload.Walk(v, tc.followIncludes)
+			require.Equal(t, tc.events, v.events)
+		})
+	}
+}
+
+func TestPayload_Inspect_includeCycle(t *testing.T) {
+	t.Parallel()
+	payload := &Payload{
+		Config: []Config{
+			{
+				File: "location1.conf",
+				Parsed: Directives{
+					{Directive: "location", Args: []string{"/foo"}, Block: Directives{
+						{Directive: "include", Args: []string{"location2.conf"}, Includes: []int{1}},
+					}},
+				},
+			},
+			{
+				File: "location2.conf",
+				Parsed: Directives{
+					{Directive: "location", Args: []string{"/bar"}, Block: Directives{
+						{Directive: "include", Args: []string{"location1.conf"}, Includes: []int{0}},
+					}},
+				},
+			},
+		},
+	}
+
+	var locations []string
+	payload.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		if d.Directive == "location" {
+			locations = append(locations, d.Args[0])
+		}
+		return true
+	}, true)
+	require.Equal(t, []string{"/foo", "/bar"}, locations)
+}
+
+func TestDirectives_Inspect(t *testing.T) {
+	t.Parallel()
+	block := Directives{
+		{Directive: "http", Block: Directives{
+			{Directive: "server", Block: Directives{
+				{Directive: "listen", Args: []string{"80"}},
+				{Directive: "location", Args: []string{"/"}, Block: Directives{
+					{Directive: "location", Args: []string{"/foo"}, Block: Directives{
+						{Directive: "root", Args: []string{"/srv"}},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	var parents []string
+	var rootCtx []string
+	block.Inspect(func(d *Directive, ctx *WalkContext) bool {
+		require.Nil(t, ctx.Config)
+		switch d.Directive {
+		case "listen":
+			parents = append(parents, ctx.Parent().Directive)
+			parents = append(parents, ctx.BlockCtx()...)
+		case "root":
+			rootCtx = ctx.BlockCtx()
+		}
+		return true
+	})
+	require.Equal(t, []string{"server", "http", "server"}, parents)
+	// nested locations are in the same context, as when parsing
+	require.Equal(t, []string{"http", "location"}, rootCtx)
+}